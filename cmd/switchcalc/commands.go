@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"switchcalc/pkg/calculator"
+)
+
+// command is a subcommand run from the command line instead of the
+// desktop interface. It returns the exit status.
+type command struct {
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]command{
+	"eval":            {"Evaluate an expression and print the result", runEval},
+	"filter":          {"Evaluate each line of stdin and print the results", runFilter},
+	"repl":            {"Calculate interactively in the terminal", runREPL},
+	"run":             {"Evaluate a worksheet file and print its results", runRun},
+	"search-provider": {"Show results in the GNOME Shell search", runSearchProvider},
+	"serve":           {"Answer JSON-RPC requests on a Unix socket", runServe},
+}
+
+// runCommand runs the subcommand named by args[0], if there is one, and
+// reports whether it did.
+func runCommand(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	if args[0] == "help" {
+		printCommands(os.Stdout)
+		return 0, true
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return 0, false
+	}
+	return cmd.run(args[1:], os.Stdout, os.Stderr), true
+}
+
+func printCommands(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "Usage: switchcalc [command] [flags]")
+	fmt.Fprintln(w, "\nWithout a command, switchcalc opens the calculator window.\n\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-16s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w, "\nRun switchcalc <command> -h for the flags of a command.")
+}
+
+// engineFlags are the engine settings the commands take as flags.
+type engineFlags struct {
+	angle     string
+	base      string
+	precision int
+}
+
+func (f *engineFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.angle, "angle", "deg", "angle mode: deg, rad or grad")
+	fs.StringVar(&f.base, "base", "dec", "base results are shown in: dec, hex, oct or bin")
+	fs.IntVar(&f.precision, "precision", calculator.DefaultPrecision, "significant digits of decimal arithmetic")
+}
+
+// newEngine returns an engine with the settings of f and the user
+// functions of the config, as the calculator window would start with
+// them. Numbers are written plainly, whatever the locale.
+func (f *engineFlags) newEngine() (*calculator.Engine, error) {
+	angle, err := calculator.ParseAngleMode(f.angle)
+	if err != nil {
+		return nil, err
+	}
+	base, err := calculator.ParseNumberBase(f.base)
+	if err != nil {
+		return nil, err
+	}
+	if f.precision < 1 {
+		return nil, fmt.Errorf("precision must be at least 1, got %d", f.precision)
+	}
+	e := calculator.NewEngine()
+	e.SetAngleMode(angle)
+	e.SetNumberBase(base)
+	e.SetPrecision(f.precision)
+	cfg, err := calculator.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	if err := e.DefineFunctions(cfg.Functions); err != nil {
+		return nil, fmt.Errorf("loading user functions: %w", err)
+	}
+	return e, nil
+}
+
+// baseValues is the current value in each base of the programmer
+// display, within the engine's word.
+type baseValues struct {
+	Hex string `json:"hex"`
+	Dec string `json:"dec"`
+	Oct string `json:"oct"`
+	Bin string `json:"bin"`
+}
+
+func newBaseValues(e *calculator.Engine) baseValues {
+	bases := e.GetAllBases()
+	return baseValues{
+		Hex: bases["HEX"],
+		Dec: bases["DEC"],
+		Oct: bases["OCT"],
+		Bin: bases["BIN"],
+	}
+}
+
+func historyMaxAge(cfg calculator.Config) time.Duration {
+	return time.Duration(cfg.HistoryMaxAgeDays) * 24 * time.Hour
+}
+
+// newFlagSet returns a flag set for the command name that writes its
+// errors and usage to stderr.
+func newFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: switchcalc %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// exitUsage is the exit status for a command line that cannot be run.
+const exitUsage = 2
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"switchcalc/pkg/calculator"
+)
+
+// runEval evaluates the expression given by the arguments, joined with
+// spaces, and prints the result. As in the calculator's expression entry,
+// the line may also be an assignment, or a function definition, which
+// prints the function as it was defined. Flags end at the expression, so
+// one starting with -, such as -2+3 or -pi, needs no --. A result that a
+// base other than decimal shows only in part, such as 1.5 in hex, is
+// printed and reported on stderr, and the exit status is 1.
+func runEval(args []string, stdout, stderr io.Writer) int {
+	var settings engineFlags
+	fs := newFlagSet("eval", "[flags] EXPRESSION", stderr)
+	settings.register(fs)
+	if err := fs.Parse(endFlags(fs, args)); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+	expr := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if expr == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	e, err := settings.newEngine()
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return exitUsage
+	}
+	result, err := e.Execute(expr)
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return 1
+	}
+	if result == nil {
+		// A definition, shown as the engine read it
+		node, _ := calculator.Parse(expr)
+		f, _ := e.Function(node.(*calculator.DefineNode).Name)
+		fmt.Fprintln(stdout, f)
+		return 0
+	}
+	fmt.Fprintln(stdout, e.Format(result))
+	if loss := e.FormatLoss(result); loss != "" {
+		fmt.Fprintf(stderr, "switchcalc: %s dropped in %s\n", loss, e.NumberBase)
+		return 1
+	}
+	return 0
+}
+
+// endFlags returns args with -- before the first argument that starts a
+// negative number or expression, such as -2+3, -(1+2) or -sin(30), rather
+// than naming a flag of fs, so that the flag set stops there.
+func endFlags(fs *flag.FlagSet, args []string) []string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return args
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name == "h" || name == "help" {
+			// Left for the flag set to show the usage
+			return args
+		}
+		f := fs.Lookup(name)
+		if f == nil {
+			return append(append(args[:i:i], "--"), args[i:]...)
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !hasValue && !(ok && b.IsBoolFlag()) {
+			i++
+		}
+	}
+	return args
+}
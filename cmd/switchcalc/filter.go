@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"switchcalc/pkg/calculator"
+)
+
+// inputBases are the radix of each base other than decimal, and the
+// prefix that marks a number in it in an expression.
+var inputBases = map[calculator.NumberBase]struct {
+	radix  int
+	prefix string
+}{
+	calculator.Binary:      {2, "0b"},
+	calculator.Octal:       {8, "0o"},
+	calculator.Hexadecimal: {16, "0x"},
+}
+
+// runFilter evaluates each line of stdin as eval would and prints the
+// results, one per line, so that switchcalc can sit in a pipeline. The
+// lines share one engine, so a line can use the variables assigned and
+// the functions defined above it, and ans is the last result. Blank lines,
+// lines starting with # and definitions give an empty line on stdout, so
+// that the results line up with the input. A line that fails is reported
+// on stderr with its number and gives an empty line too, and the rest are
+// still read. A result that a base other than decimal shows only in part,
+// such as 1.5 in hex, is printed and reported on stderr too. Either makes
+// the exit status 1.
+func runFilter(args []string, stdout, stderr io.Writer) int {
+	var settings engineFlags
+	fs := newFlagSet("filter", "[flags] < INPUT", stderr)
+	settings.register(fs)
+	format := fs.String("format", "auto", "notation of decimal results: auto, fix, sci, eng or sig")
+	digits := fs.Int("digits", calculator.DefaultDisplayDigits, "digits of the fix, sci, eng and sig formats")
+	input := fs.String("in", "dec", "base bare numbers on a line of their own are read in: dec, hex, oct or bin")
+	echo := fs.Bool("echo", false, "print each line before its result, separated by a tab")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	displayFormat, err := calculator.ParseDisplayFormat(*format)
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return exitUsage
+	}
+	inputBase, err := calculator.ParseNumberBase(*input)
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return exitUsage
+	}
+	e, err := settings.newEngine()
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return exitUsage
+	}
+	e.SetDisplayFormat(displayFormat, *digits)
+
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+	status := 0
+	scanner := bufio.NewScanner(os.Stdin)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if *echo && line != "" {
+			fmt.Fprintf(out, "%s\t", line)
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			fmt.Fprintln(out)
+			continue
+		}
+		result, err := e.Execute(readBare(line, inputBase))
+		if err != nil || result == nil {
+			fmt.Fprintln(out)
+		}
+		if err != nil {
+			// Keep stdout and stderr in order when both are the terminal.
+			out.Flush()
+			fmt.Fprintf(stderr, "switchcalc: line %d: %s: %v\n", lineNo, line, err)
+			status = 1
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		fmt.Fprintln(out, e.Format(result))
+		if loss := e.FormatLoss(result); loss != "" {
+			out.Flush()
+			fmt.Fprintf(stderr, "switchcalc: line %d: %s: %s dropped in %s\n", lineNo, line, loss, e.NumberBase)
+			status = 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		out.Flush()
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return 1
+	}
+	return status
+}
+
+// readBare returns line with the prefix of base added if it is a bare
+// integer in that base, such as "deadbeef" from a register dump, and
+// otherwise unchanged.
+func readBare(line string, base calculator.NumberBase) string {
+	in, ok := inputBases[base]
+	if !ok || strings.ContainsAny(line, "+-_") {
+		return line
+	}
+	if _, ok := new(big.Int).SetString(line, in.radix); !ok {
+		return line
+	}
+	return in.prefix + line
+}
+
+// readBareNumbers returns line with the prefix of the engine's base added
+// to each bare integer in that base, so that in hex FFFF+1 is 0xFFFF+1.
+// Words that name a variable or function stay names, as do the names a
+// definition or assignment introduces.
+func readBareNumbers(line string, e *calculator.Engine) string {
+	in, ok := inputBases[e.NumberBase]
+	if !ok {
+		return line
+	}
+	var b strings.Builder
+	switch node, _ := calculator.Parse(line); node.(type) {
+	case *calculator.DefineNode:
+		return line
+	case *calculator.AssignNode:
+		name, value, _ := strings.Cut(line, "=")
+		b.WriteString(name + "=")
+		line = value
+	}
+	for line != "" {
+		n := strings.IndexFunc(line, func(r rune) bool {
+			return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.')
+		})
+		if n < 0 {
+			n = len(line)
+		}
+		if n == 0 {
+			_, size := utf8.DecodeRuneInString(line)
+			b.WriteString(line[:size])
+			line = line[size:]
+			continue
+		}
+		word := line[:n]
+		line = line[n:]
+		if isBare(word, in.radix, e) && !strings.HasPrefix(strings.TrimSpace(line), "(") {
+			b.WriteString(in.prefix)
+		}
+		b.WriteString(word)
+	}
+	return b.String()
+}
+
+// isBare reports whether word is an integer in radix rather than the name
+// of a variable or function.
+func isBare(word string, radix int, e *calculator.Engine) bool {
+	if _, ok := new(big.Int).SetString(word, radix); !ok {
+		return false
+	}
+	_, variable := e.Variable(word)
+	_, function := e.Function(word)
+	return !variable && !function
+}
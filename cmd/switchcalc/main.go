@@ -1,28 +1,26 @@
+//go:build !nogui
+
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 
 	"switchcalc/pkg/calculator"
 )
 
-type CalculatorMode int
-
-const (
-	ModeStandard CalculatorMode = iota
-	ModeScientific
-	ModeProgrammer
-	ModeDateTime
-)
-
 type App struct {
 	window        *gtk.ApplicationWindow
 	engine        *calculator.Engine
@@ -31,18 +29,68 @@ type App struct {
 	display       *gtk.Label
 	expressionLbl *gtk.Label
 	historyList   *gtk.ListBox
+	sidePanel     *gtk.Revealer
+	sideStack     *gtk.Stack
+	historyBtn    *gtk.ToggleButton
+	variablesBtn  *gtk.ToggleButton
+	historySearch *gtk.SearchEntry
+	historyRange  *gtk.DropDown
+	historyStore  *calculator.HistoryStore
+	config        calculator.Config
 	mainStack     *gtk.Stack
 	modeButtons   map[CalculatorMode]*gtk.ToggleButton
+	// modeStacks are the names of the keypads of the modes in mainStack.
+	modeStacks map[CalculatorMode]string
+	// prevMode is the mode programmer mode was entered from, which undo
+	// goes back to.
+	prevMode CalculatorMode
+
+	// historyShown is the history entries as currently listed, newest
+	// last. historyLen and historyLast describe the engine history they
+	// were taken from, to tell when it has changed.
+	historyShown []calculator.HistoryEntry
+	historyLen   int
+	historyLast  time.Time
+
+	// Variables panel
+	variablesList   *gtk.ListBox
+	functionsList   *gtk.ListBox
+	functionsShown  []string
+	variableEntry   *gtk.Entry
+	variableStatus  *gtk.Label
+	variablesShown  []string
+	variablesListed string
+	statePath       string
+
+	// Worksheet panel
+	worksheetBtn    *gtk.ToggleButton
+	worksheetPath   string
+	worksheetLines  []calculator.WorksheetLine
+	worksheetList   *gtk.ListBox
+	worksheetStatus *gtk.Label
+	worksheetRunBtn *gtk.Button
 
 	// Programmer mode widgets
 	baseLabels    map[calculator.NumberBase]*gtk.Label
-	bitDisplay    *gtk.Label
+	widthButtons  map[calculator.BitWidth]*gtk.ToggleButton
+	widthSpin     *gtk.SpinButton
+	bitGrid       *gtk.Box
+	bitCells      []*gtk.Label
+	flagLabels    []*gtk.Label
 	hexButtons    []*gtk.Button
-	bitWidth      calculator.BitWidth
 	shiftAmount   int
 	bitWidthLabel *gtk.Label
 	shiftLabel    *gtk.Label
+	shiftBox      *gtk.Box
 	bitPosEntry   *gtk.Entry
+	floatView     *gtk.Revealer
+	floatEntry    *gtk.Entry
+	floatTable    *gtk.Grid
+	// bitDrag is the range of bits being dragged over in the bit grid.
+	bitDrag struct {
+		active     bool
+		start, end uint
+	}
 
 	// Date calculator widgets
 	startDateEntry   *gtk.Entry
@@ -57,29 +105,69 @@ type App struct {
 
 	// Scientific mode
 	angleModeLbl *gtk.Label
+
+	// RPN mode
+	rpnBtn        *gtk.ToggleButton
+	stackLbl      *gtk.Label
+	stackKeys     *gtk.Box
+	equalsButtons []*gtk.Button
 }
 
 func main() {
-	app := gtk.NewApplication("com.switchcalc.app", 0)
+	// Commands such as eval run without the desktop interface
+	if code, ok := runCommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
+	app := gtk.NewApplication(appID, gio.ApplicationHandlesOpen)
+	// Launching again, or from the desktop search, brings back the window
+	var calcApp *App
 	app.ConnectActivate(func() {
-		activate(app)
+		if calcApp != nil {
+			calcApp.window.Present()
+			return
+		}
+		calcApp = activate(app)
+		calcApp.window.ConnectCloseRequest(func() bool {
+			calcApp = nil
+			return false
+		})
+	})
+
+	// Worksheets given on the command line, as in switchcalc budget.calc
+	app.ConnectOpen(func(files []gio.Filer, hint string) {
+		app.Activate()
+		for _, file := range files {
+			calcApp.openWorksheet(file.Path())
+		}
+	})
+
+	// The search provider opens results with this action, which the
+	// session bus can deliver even before the window is open.
+	loadValue := gio.NewSimpleAction("load-value", glib.NewVariantType("s"))
+	loadValue.ConnectActivate(func(param *glib.Variant) {
+		app.Activate()
+		calcApp.loadSearchResult(param.String())
 	})
+	app.AddAction(loadValue)
 
 	if code := app.Run(os.Args); code > 0 {
 		os.Exit(code)
 	}
 }
 
-func activate(app *gtk.Application) {
+func activate(app *gtk.Application) *App {
 	calcApp := &App{
 		engine:      calculator.NewEngine(),
 		dateCalc:    calculator.NewDateTimeCalc(),
 		mode:        ModeStandard,
 		modeButtons: make(map[CalculatorMode]*gtk.ToggleButton),
+		modeStacks:  make(map[CalculatorMode]string),
 		baseLabels:  make(map[calculator.NumberBase]*gtk.Label),
-		bitWidth:    calculator.Bits32,
 		shiftAmount: 1,
 	}
+	calcApp.loadConfig()
+	calcApp.loadState()
 
 	calcApp.window = gtk.NewApplicationWindow(app)
 	calcApp.window.SetTitle("SwitchCalc")
@@ -117,6 +205,16 @@ func activate(app *gtk.Application) {
 	calcApp.mainStack.AddNamed(dateTimePage, "datetime")
 
 	mainBox.Append(calcApp.mainStack)
+	mainBox.SetHExpand(true)
+
+	// History and variables side panel
+	rootBox := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	rootBox.Append(mainBox)
+	rootBox.Append(calcApp.createSidePanel())
+
+	// Show the RPN stack restored with the state
+	calcApp.showRPN()
+	calcApp.updateDisplay()
 
 	// Apply CSS
 	calcApp.applyCSS()
@@ -124,8 +222,14 @@ func activate(app *gtk.Application) {
 	// Setup keyboard handling
 	calcApp.setupKeyboardHandling()
 
-	calcApp.window.SetChild(mainBox)
+	calcApp.window.ConnectCloseRequest(func() bool {
+		calcApp.saveState()
+		return false
+	})
+
+	calcApp.window.SetChild(rootBox)
 	calcApp.window.Show()
+	return calcApp
 }
 
 func (a *App) createModeSelector() *gtk.Box {
@@ -156,32 +260,40 @@ func (a *App) createModeSelector() *gtk.Box {
 		}
 
 		mode := m.mode
-		name := m.name
 		btn.ConnectClicked(func() {
-			a.setMode(mode, name)
+			a.setMode(mode)
 		})
 
 		a.modeButtons[m.mode] = btn
+		a.modeStacks[m.mode] = m.name
 		box.Append(btn)
 	}
 
 	return box
 }
 
-func (a *App) setMode(mode CalculatorMode, stackName string) {
-	a.mode = mode
-	a.mainStack.SetVisibleChildName(stackName)
-
-	for m, btn := range a.modeButtons {
-		btn.SetActive(m == mode)
-	}
-
+func (a *App) setMode(mode CalculatorMode) {
+	a.showMode(mode)
+	a.engine.SetProgrammer(mode == ModeProgrammer)
 	if mode == ModeProgrammer {
 		a.engine.SetNumberBase(calculator.Decimal)
 		a.updateProgrammerDisplay()
 	}
 }
 
+// showMode shows the keypad of mode without changing the engine, as when
+// undo turns programmer mode on or off.
+func (a *App) showMode(mode CalculatorMode) {
+	if mode == ModeProgrammer && a.mode != ModeProgrammer {
+		a.prevMode = a.mode
+	}
+	a.mode = mode
+	a.mainStack.SetVisibleChildName(a.modeStacks[mode])
+	for m, btn := range a.modeButtons {
+		btn.SetActive(m == mode)
+	}
+}
+
 func (a *App) createDisplayArea() *gtk.Box {
 	box := gtk.NewBox(gtk.OrientationVertical, 0)
 	box.AddCSSClass("display-area")
@@ -191,10 +303,65 @@ func (a *App) createDisplayArea() *gtk.Box {
 	box.SetMarginBottom(2)
 	box.SetVAlign(gtk.AlignStart)
 
+	topRow := gtk.NewBox(gtk.OrientationHorizontal, 4)
+
+	a.historyBtn = gtk.NewToggleButton()
+	a.historyBtn.SetLabel("History")
+	a.historyBtn.AddCSSClass("history-toggle")
+	a.historyBtn.SetTooltipText("Show history (Ctrl+H)")
+	a.historyBtn.ConnectClicked(func() {
+		a.toggleSidePage("history")
+	})
+	topRow.Append(a.historyBtn)
+
+	a.variablesBtn = gtk.NewToggleButton()
+	a.variablesBtn.SetLabel("Variables")
+	a.variablesBtn.AddCSSClass("history-toggle")
+	a.variablesBtn.SetTooltipText("Show variables (Ctrl+J)")
+	a.variablesBtn.ConnectClicked(func() {
+		a.toggleSidePage("variables")
+	})
+	topRow.Append(a.variablesBtn)
+
+	a.worksheetBtn = gtk.NewToggleButton()
+	a.worksheetBtn.SetLabel("Sheet")
+	a.worksheetBtn.AddCSSClass("history-toggle")
+	a.worksheetBtn.SetTooltipText("Show the worksheet (Ctrl+O to open one)")
+	a.worksheetBtn.ConnectClicked(func() {
+		a.toggleSidePage("worksheet")
+	})
+	topRow.Append(a.worksheetBtn)
+
+	a.rpnBtn = gtk.NewToggleButton()
+	a.rpnBtn.SetLabel("RPN")
+	a.rpnBtn.AddCSSClass("history-toggle")
+	a.rpnBtn.SetTooltipText("Reverse Polish Notation with an HP-style stack")
+	a.rpnBtn.SetActive(a.engine.RPN)
+	a.rpnBtn.ConnectToggled(func() {
+		a.engine.SetRPN(a.rpnBtn.Active())
+		a.showRPN()
+		a.refreshDisplay()
+	})
+	topRow.Append(a.rpnBtn)
+
+	helpBtn := gtk.NewButton()
+	helpBtn.SetLabel("?")
+	helpBtn.AddCSSClass("history-toggle")
+	helpBtn.SetTooltipText("Keys and functions (F1)")
+	helpBtn.ConnectClicked(a.showHelp)
+	topRow.Append(helpBtn)
+
 	a.expressionLbl = gtk.NewLabel("")
 	a.expressionLbl.AddCSSClass("expression-label")
 	a.expressionLbl.SetXAlign(1)
-	box.Append(a.expressionLbl)
+	a.expressionLbl.SetHExpand(true)
+	topRow.Append(a.expressionLbl)
+	box.Append(topRow)
+
+	a.stackLbl = gtk.NewLabel("")
+	a.stackLbl.AddCSSClass("stack-display")
+	a.stackLbl.SetXAlign(1)
+	box.Append(a.stackLbl)
 
 	a.display = gtk.NewLabel("0")
 	a.display.AddCSSClass("main-display")
@@ -202,9 +369,776 @@ func (a *App) createDisplayArea() *gtk.Box {
 	a.display.SetSelectable(true)
 	box.Append(a.display)
 
+	box.Append(a.createStackKeys())
+
 	return box
 }
 
+// createStackKeys creates the RPN stack keys shown under the display.
+func (a *App) createStackKeys() *gtk.Box {
+	a.stackKeys = gtk.NewBox(gtk.OrientationHorizontal, 2)
+	a.stackKeys.SetMarginTop(4)
+
+	for _, op := range keypadOps(calculator.StackKeypad) {
+		a.stackKeys.Append(a.createOpButton(op, "function-button"))
+	}
+
+	depthDrop := gtk.NewDropDownFromStrings([]string{"4 levels", "Unlimited"})
+	depthDrop.SetTooltipText("Stack depth")
+	if a.engine.StackDepth == 0 {
+		depthDrop.SetSelected(1)
+	}
+	depthDrop.NotifyProperty("selected", func() {
+		depth := calculator.DefaultStackDepth
+		if depthDrop.Selected() == 1 {
+			depth = 0
+		}
+		a.engine.SetStackDepth(depth)
+		a.refreshDisplay()
+	})
+	a.stackKeys.Append(depthDrop)
+
+	return a.stackKeys
+}
+
+// showRPN shows the stack and its keys in RPN mode, and labels the equals
+// keys ENTER.
+func (a *App) showRPN() {
+	a.stackLbl.SetVisible(a.engine.RPN)
+	a.stackKeys.SetVisible(a.engine.RPN)
+	label := "="
+	if a.engine.RPN {
+		label = "ENTER"
+	}
+	for _, btn := range a.equalsButtons {
+		btn.SetLabel(label)
+	}
+}
+
+// stackLevelsShown is the number of registers above X shown in RPN mode.
+const stackLevelsShown = 3
+
+// updateStack shows the registers above X, the highest first.
+func (a *App) updateStack() {
+	if !a.engine.RPN {
+		return
+	}
+	stack := a.engine.Stack()
+	var lines []string
+	if len(stack) > stackLevelsShown {
+		lines = append(lines, fmt.Sprintf("⋮ %d more", len(stack)-stackLevelsShown))
+	}
+	names := []string{"Y", "Z", "T"}
+	for i := min(len(stack), stackLevelsShown) - 1; i >= 0; i-- {
+		lines = append(lines, names[i]+":  "+a.engine.Format(stack[i]))
+	}
+	a.stackLbl.SetText(strings.Join(lines, "\n"))
+}
+
+// loadConfig reads the config, with the user functions, and the saved
+// history. Failures are logged and leave the history in memory only.
+func (a *App) loadConfig() {
+	cfg, err := calculator.LoadConfig()
+	if err != nil {
+		log.Printf("loading config: %v", err)
+	}
+	a.config = cfg
+	a.engine.SetLocale(cfg.NumberLocale())
+	if err := a.engine.DefineFunctions(cfg.Functions); err != nil {
+		log.Printf("loading functions: %v", err)
+	}
+	a.engine.ClearUndo()
+
+	path, err := calculator.DefaultHistoryPath()
+	if err != nil {
+		log.Printf("locating history: %v", err)
+		return
+	}
+	a.historyStore = calculator.NewHistoryStore(path, cfg.HistoryLimit, historyMaxAge(cfg))
+	if err := a.engine.SetHistoryStore(a.historyStore); err != nil {
+		log.Printf("loading history: %v", err)
+	}
+}
+
+// saveFunctions saves the user functions to the config.
+func (a *App) saveFunctions() {
+	a.config.Functions = a.engine.FunctionDefinitions()
+	if err := calculator.SaveConfig(a.config); err != nil {
+		log.Printf("saving config: %v", err)
+	}
+	a.listVariables()
+}
+
+// applyHistorySettings saves changed history limits and applies them to
+// the saved history.
+func (a *App) applyHistorySettings() {
+	if err := calculator.SaveConfig(a.config); err != nil {
+		log.Printf("saving config: %v", err)
+	}
+	if a.historyStore == nil {
+		a.engine.HistoryLimit = a.config.HistoryLimit
+		return
+	}
+	a.historyStore.Limit = a.config.HistoryLimit
+	a.historyStore.MaxAge = historyMaxAge(a.config)
+	if err := a.engine.SetHistoryStore(a.historyStore); err != nil {
+		log.Printf("loading history: %v", err)
+	}
+	a.listHistory()
+}
+
+// loadState restores the variables, ans and modes saved by saveState.
+// It runs before the keypads are built so they show the restored modes.
+func (a *App) loadState() {
+	path, err := calculator.DefaultStatePath()
+	if err != nil {
+		log.Printf("locating state: %v", err)
+		return
+	}
+	a.statePath = path
+	if err := a.engine.LoadState(path); err != nil {
+		log.Printf("loading state: %v", err)
+	}
+}
+
+func (a *App) saveState() {
+	if a.statePath == "" {
+		return
+	}
+	if err := a.engine.SaveState(a.statePath); err != nil {
+		log.Printf("saving state: %v", err)
+	}
+}
+
+// createSidePanel builds the panel beside the keypad holding the history
+// and the variables, one page at a time.
+func (a *App) createSidePanel() *gtk.Revealer {
+	a.sideStack = gtk.NewStack()
+	a.sideStack.SetTransitionType(gtk.StackTransitionTypeCrossfade)
+	a.sideStack.SetVExpand(true)
+	a.sideStack.AddNamed(a.createHistoryPage(), "history")
+	a.sideStack.AddNamed(a.createVariablesPage(), "variables")
+	a.sideStack.AddNamed(a.createWorksheetPage(), "worksheet")
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.AddCSSClass("history-panel")
+	box.SetSizeRequest(260, -1)
+	box.Append(a.sideStack)
+
+	a.sidePanel = gtk.NewRevealer()
+	a.sidePanel.SetTransitionType(gtk.RevealerTransitionTypeSlideLeft)
+	a.sidePanel.SetChild(box)
+	return a.sidePanel
+}
+
+// toggleSidePage shows the named page of the side panel, or hides the
+// panel if that page is already showing.
+func (a *App) toggleSidePage(page string) {
+	show := !(a.sidePanel.RevealChild() && a.sideStack.VisibleChildName() == page)
+	if show {
+		a.sideStack.SetVisibleChildName(page)
+	}
+	a.sidePanel.SetRevealChild(show)
+	a.historyBtn.SetActive(show && page == "history")
+	a.variablesBtn.SetActive(show && page == "variables")
+	a.worksheetBtn.SetActive(show && page == "worksheet")
+}
+
+func (a *App) createHistoryPage() *gtk.Box {
+	box := gtk.NewBox(gtk.OrientationVertical, 4)
+
+	header := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	title := gtk.NewLabel("History")
+	title.AddCSSClass("history-title")
+	title.SetHExpand(true)
+	title.SetXAlign(0)
+	header.Append(title)
+
+	clearBtn := gtk.NewButton()
+	clearBtn.SetLabel("Clear")
+	clearBtn.AddCSSClass("angle-button")
+	clearBtn.ConnectClicked(func() {
+		if err := a.engine.ClearHistory(); err != nil {
+			log.Printf("clearing history: %v", err)
+		}
+		a.updateHistory()
+	})
+	header.Append(clearBtn)
+	box.Append(header)
+
+	a.historySearch = gtk.NewSearchEntry()
+	a.historySearch.SetPlaceholderText("Search expressions and results")
+	a.historySearch.ConnectSearchChanged(a.listHistory)
+	box.Append(a.historySearch)
+
+	a.historyRange = gtk.NewDropDownFromStrings([]string{
+		"Any time", "Today", "Yesterday", "Last 7 days", "Last 30 days",
+	})
+	a.historyRange.NotifyProperty("selected", a.listHistory)
+	box.Append(a.historyRange)
+
+	hint := gtk.NewLabel("Click an entry to use its result, or ✎ to edit it")
+	hint.AddCSSClass("dim-label")
+	hint.SetWrap(true)
+	hint.SetXAlign(0)
+	box.Append(hint)
+
+	a.historyList = gtk.NewListBox()
+	a.historyList.AddCSSClass("history-list")
+	a.historyList.SetSelectionMode(gtk.SelectionNone)
+	placeholder := gtk.NewLabel("No calculations yet")
+	placeholder.AddCSSClass("dim-label")
+	a.historyList.SetPlaceholder(placeholder)
+	a.historyList.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		// Rows are listed newest first.
+		i := len(a.historyShown) - 1 - row.Index()
+		if i < 0 || i >= len(a.historyShown) {
+			return
+		}
+		a.engine.RecallHistory(a.historyShown[i])
+		a.refreshDisplay()
+	})
+
+	scrollWin := gtk.NewScrolledWindow()
+	scrollWin.SetVExpand(true)
+	scrollWin.SetChild(a.historyList)
+	box.Append(scrollWin)
+
+	// Size limit and expiry, kept in the config file
+	limitRow := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	keepLabel := gtk.NewLabel("Keep")
+	keepLabel.AddCSSClass("dim-label")
+	limitRow.Append(keepLabel)
+	limitSpin := gtk.NewSpinButtonWithRange(10, 100000, 10)
+	limitSpin.SetValue(float64(a.config.HistoryLimit))
+	limitSpin.ConnectValueChanged(func() {
+		a.config.HistoryLimit = limitSpin.ValueAsInt()
+		a.applyHistorySettings()
+	})
+	limitRow.Append(limitSpin)
+	daysLabel := gtk.NewLabel("for days")
+	daysLabel.AddCSSClass("dim-label")
+	limitRow.Append(daysLabel)
+	daysSpin := gtk.NewSpinButtonWithRange(0, 3650, 1)
+	daysSpin.SetValue(float64(a.config.HistoryMaxAgeDays))
+	daysSpin.SetTooltipText("0 keeps entries until the limit is reached")
+	daysSpin.ConnectValueChanged(func() {
+		a.config.HistoryMaxAgeDays = daysSpin.ValueAsInt()
+		a.applyHistorySettings()
+	})
+	limitRow.Append(daysSpin)
+	box.Append(limitRow)
+
+	a.listHistory()
+	return box
+}
+
+func (a *App) createVariablesPage() *gtk.Box {
+	box := gtk.NewBox(gtk.OrientationVertical, 4)
+
+	title := gtk.NewLabel("Variables and functions")
+	title.AddCSSClass("history-title")
+	title.SetXAlign(0)
+	box.Append(title)
+
+	// Assignments, definitions and expressions typed as text
+	a.variableEntry = gtk.NewEntry()
+	a.variableEntry.SetPlaceholderText("rate = 0.0375 or f(x) = 3x^2")
+	a.variableEntry.ConnectActivate(func() {
+		result, err := a.engine.Execute(a.variableEntry.Text())
+		if err != nil {
+			a.variableStatus.SetText(err.Error())
+			a.updateDisplay()
+			return
+		}
+		a.variableEntry.SetText("")
+		a.variableStatus.SetText("")
+		if result == nil {
+			// A function definition
+			a.saveFunctions()
+			return
+		}
+		a.refreshDisplay()
+		a.saveState()
+	})
+	box.Append(a.variableEntry)
+
+	a.variableStatus = gtk.NewLabel("")
+	a.variableStatus.AddCSSClass("history-error")
+	a.variableStatus.SetWrap(true)
+	a.variableStatus.SetXAlign(0)
+	box.Append(a.variableStatus)
+
+	// Store the displayed value under a name
+	storeRow := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	nameEntry := gtk.NewEntry()
+	nameEntry.SetPlaceholderText("name")
+	nameEntry.SetHExpand(true)
+	storeBtn := gtk.NewButton()
+	storeBtn.SetLabel("Store result")
+	storeBtn.AddCSSClass("angle-button")
+	store := func() {
+		if err := a.engine.SetVariable(nameEntry.Text(), a.engine.CurrentValue); err != nil {
+			a.variableStatus.SetText(err.Error())
+			return
+		}
+		nameEntry.SetText("")
+		a.variableStatus.SetText("")
+		a.listVariables()
+		a.saveState()
+	}
+	nameEntry.ConnectActivate(store)
+	storeBtn.ConnectClicked(store)
+	storeRow.Append(nameEntry)
+	storeRow.Append(storeBtn)
+	box.Append(storeRow)
+
+	hint := gtk.NewLabel("Click a variable to use its value or a function to apply it, or use their names in an expression")
+	hint.AddCSSClass("dim-label")
+	hint.SetWrap(true)
+	hint.SetXAlign(0)
+	box.Append(hint)
+
+	a.variablesList = gtk.NewListBox()
+	a.variablesList.AddCSSClass("history-list")
+	a.variablesList.SetSelectionMode(gtk.SelectionNone)
+	a.variablesList.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		i := row.Index()
+		if i < 0 || i >= len(a.variablesShown) {
+			return
+		}
+		a.engine.RecallVariable(a.variablesShown[i])
+		a.refreshDisplay()
+	})
+
+	functionsHeader := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	functionsTitle := gtk.NewLabel("Functions")
+	functionsTitle.AddCSSClass("history-title")
+	functionsTitle.SetHExpand(true)
+	functionsTitle.SetXAlign(0)
+	functionsHeader.Append(functionsTitle)
+	commaBtn := gtk.NewButton()
+	commaBtn.SetLabel(",")
+	commaBtn.AddCSSClass("angle-button")
+	commaBtn.SetTooltipText("Next argument (;)")
+	commaBtn.ConnectClicked(func() {
+		a.engine.InputComma()
+		a.updateExpression()
+	})
+	functionsHeader.Append(commaBtn)
+
+	a.functionsList = gtk.NewListBox()
+	a.functionsList.AddCSSClass("history-list")
+	a.functionsList.SetSelectionMode(gtk.SelectionNone)
+	placeholder := gtk.NewLabel("Define one above, such as hyp(a, b) = sqrt(a^2 + b^2)")
+	placeholder.AddCSSClass("dim-label")
+	placeholder.SetWrap(true)
+	a.functionsList.SetPlaceholder(placeholder)
+	a.functionsList.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		i := row.Index()
+		if i < 0 || i >= len(a.functionsShown) {
+			return
+		}
+		a.engine.CallFunction(a.functionsShown[i])
+		a.refreshDisplay()
+	})
+
+	lists := gtk.NewBox(gtk.OrientationVertical, 4)
+	lists.Append(a.variablesList)
+	lists.Append(functionsHeader)
+	lists.Append(a.functionsList)
+
+	scrollWin := gtk.NewScrolledWindow()
+	scrollWin.SetVExpand(true)
+	scrollWin.SetChild(lists)
+	box.Append(scrollWin)
+
+	a.listVariables()
+	return box
+}
+
+func (a *App) createWorksheetPage() *gtk.Box {
+	box := gtk.NewBox(gtk.OrientationVertical, 4)
+
+	header := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	title := gtk.NewLabel("Worksheet")
+	title.AddCSSClass("history-title")
+	title.SetHExpand(true)
+	title.SetXAlign(0)
+	header.Append(title)
+
+	openBtn := gtk.NewButton()
+	openBtn.SetLabel("Open…")
+	openBtn.AddCSSClass("angle-button")
+	openBtn.SetTooltipText("Open a " + calculator.WorksheetExt + " file (Ctrl+O)")
+	openBtn.ConnectClicked(a.chooseWorksheet)
+	header.Append(openBtn)
+
+	a.worksheetRunBtn = gtk.NewButton()
+	a.worksheetRunBtn.SetLabel("Run again")
+	a.worksheetRunBtn.AddCSSClass("angle-button")
+	a.worksheetRunBtn.SetTooltipText("Read the file again and evaluate it (F5)")
+	a.worksheetRunBtn.SetSensitive(false)
+	a.worksheetRunBtn.ConnectClicked(a.runWorksheet)
+	header.Append(a.worksheetRunBtn)
+	box.Append(header)
+
+	a.worksheetStatus = gtk.NewLabel("Lines are expressions, assignments and definitions, with # comments")
+	a.worksheetStatus.AddCSSClass("dim-label")
+	a.worksheetStatus.SetWrap(true)
+	a.worksheetStatus.SetXAlign(0)
+	box.Append(a.worksheetStatus)
+
+	a.worksheetList = gtk.NewListBox()
+	a.worksheetList.AddCSSClass("history-list")
+	a.worksheetList.SetSelectionMode(gtk.SelectionNone)
+	placeholder := gtk.NewLabel("No worksheet open")
+	placeholder.AddCSSClass("dim-label")
+	a.worksheetList.SetPlaceholder(placeholder)
+	a.worksheetList.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		i := row.Index()
+		if i < 0 || i >= len(a.worksheetLines) || a.worksheetLines[i].Entry == nil {
+			return
+		}
+		a.engine.RecallHistory(*a.worksheetLines[i].Entry)
+		a.refreshDisplay()
+	})
+
+	scrollWin := gtk.NewScrolledWindow()
+	scrollWin.SetVExpand(true)
+	scrollWin.SetChild(a.worksheetList)
+	box.Append(scrollWin)
+	return box
+}
+
+// chooseWorksheet asks for a worksheet file and runs it.
+func (a *App) chooseWorksheet() {
+	filter := gtk.NewFileFilter()
+	filter.SetName("Worksheets")
+	filter.AddPattern("*" + calculator.WorksheetExt)
+	dialog := gtk.NewFileDialog()
+	dialog.SetTitle("Open Worksheet")
+	dialog.SetDefaultFilter(filter)
+	dialog.Open(context.Background(), &a.window.Window, func(res gio.AsyncResulter) {
+		file, err := dialog.OpenFinish(res)
+		if err != nil {
+			// Also when the dialog is cancelled
+			return
+		}
+		a.openWorksheet(file.Path())
+	})
+}
+
+// openWorksheet shows the worksheet panel and runs the file at path.
+func (a *App) openWorksheet(path string) {
+	a.worksheetPath = path
+	a.worksheetRunBtn.SetSensitive(true)
+	if !(a.sidePanel.RevealChild() && a.sideStack.VisibleChildName() == "worksheet") {
+		a.toggleSidePage("worksheet")
+	}
+	a.runWorksheet()
+}
+
+// runWorksheet reads the open worksheet file again, so that changes made
+// in an editor are picked up, and evaluates it in the calculator. Its
+// variables and functions stay available afterwards.
+func (a *App) runWorksheet() {
+	if a.worksheetPath == "" {
+		return
+	}
+	ws, err := calculator.LoadWorksheet(a.worksheetPath)
+	if err != nil {
+		a.worksheetStatus.SetText(err.Error())
+		return
+	}
+	failed := a.engine.RunWorksheet(ws)
+	status := filepath.Base(a.worksheetPath)
+	if failed > 0 {
+		status += fmt.Sprintf(": %d failed", failed)
+	}
+	a.worksheetStatus.SetText(status)
+
+	a.worksheetLines = nil
+	a.worksheetList.RemoveAll()
+	for _, line := range ws.Lines {
+		if line.Input == "" && line.Comment == "" {
+			continue
+		}
+		a.worksheetLines = append(a.worksheetLines, line)
+		a.worksheetList.Append(a.createWorksheetRow(line))
+	}
+	a.refreshDisplay()
+	a.saveState()
+}
+
+func (a *App) createWorksheetRow(line calculator.WorksheetLine) *gtk.Box {
+	row := gtk.NewBox(gtk.OrientationVertical, 0)
+	row.AddCSSClass("history-row")
+	if line.Input == "" {
+		comment := gtk.NewLabel(line.Comment)
+		comment.AddCSSClass("history-title")
+		comment.SetXAlign(0)
+		comment.SetWrap(true)
+		row.Append(comment)
+		return row
+	}
+
+	input := gtk.NewLabel(a.engine.FormatExpression(line.Input))
+	input.AddCSSClass("history-expression")
+	input.SetXAlign(0)
+	input.SetWrap(true)
+	row.Append(input)
+
+	if line.Entry != nil {
+		result := gtk.NewLabel("= " + line.Entry.Result)
+		result.AddCSSClass("history-result")
+		if line.Failed() {
+			result.SetText(line.Entry.Error)
+			result.AddCSSClass("history-error")
+		}
+		result.SetXAlign(1)
+		result.SetWrap(true)
+		row.Append(result)
+	}
+	if line.Comment != "" {
+		comment := gtk.NewLabel(line.Comment)
+		comment.AddCSSClass("dim-label")
+		comment.SetXAlign(0)
+		comment.SetWrap(true)
+		row.Append(comment)
+	}
+	return row
+}
+
+// updateVariables lists the variables again if any has changed since they
+// were last listed. ans changes with every calculation.
+func (a *App) updateVariables() {
+	if a.variablesSummary() != a.variablesListed {
+		a.listVariables()
+	}
+}
+
+func (a *App) variablesSummary() string {
+	var b strings.Builder
+	for _, name := range append([]string{"ans"}, a.engine.VariableNames()...) {
+		val, _ := a.engine.Variable(name)
+		fmt.Fprintf(&b, "%s=%s;", name, val)
+	}
+	return b.String()
+}
+
+// listVariables lists ans followed by the variables in name order.
+func (a *App) listVariables() {
+	a.variablesListed = a.variablesSummary()
+	a.variablesShown = append([]string{"ans"}, a.engine.VariableNames()...)
+	a.variablesList.RemoveAll()
+	for _, name := range a.variablesShown {
+		a.variablesList.Append(a.createVariableRow(name))
+	}
+
+	a.functionsShown = a.engine.FunctionNames()
+	a.functionsList.RemoveAll()
+	for _, name := range a.functionsShown {
+		a.functionsList.Append(a.createFunctionRow(name))
+	}
+}
+
+func (a *App) createFunctionRow(name string) *gtk.Box {
+	row := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	row.AddCSSClass("history-row")
+
+	f, _ := a.engine.Function(name)
+	label := gtk.NewLabel(f.String())
+	label.AddCSSClass("variable-name")
+	label.SetXAlign(0)
+	label.SetHExpand(true)
+	label.SetWrap(true)
+	row.Append(label)
+
+	editBtn := gtk.NewButton()
+	editBtn.SetLabel("✎")
+	editBtn.AddCSSClass("shift-ctrl-button")
+	editBtn.SetTooltipText("Edit this function")
+	editBtn.SetVAlign(gtk.AlignCenter)
+	editBtn.ConnectClicked(func() {
+		a.variableEntry.SetText(f.String())
+		a.variableEntry.GrabFocus()
+	})
+	row.Append(editBtn)
+
+	deleteBtn := gtk.NewButton()
+	deleteBtn.SetLabel("✕")
+	deleteBtn.AddCSSClass("shift-ctrl-button")
+	deleteBtn.SetTooltipText("Delete this function")
+	deleteBtn.SetVAlign(gtk.AlignCenter)
+	deleteBtn.ConnectClicked(func() {
+		a.engine.DeleteFunction(name)
+		a.saveFunctions()
+	})
+	row.Append(deleteBtn)
+	return row
+}
+
+func (a *App) createVariableRow(name string) *gtk.Box {
+	row := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	row.AddCSSClass("history-row")
+
+	val, _ := a.engine.Variable(name)
+	nameLabel := gtk.NewLabel(name)
+	nameLabel.AddCSSClass("variable-name")
+	nameLabel.SetXAlign(0)
+	row.Append(nameLabel)
+
+	valueLabel := gtk.NewLabel(a.engine.Format(val))
+	valueLabel.AddCSSClass("history-result")
+	valueLabel.SetXAlign(1)
+	valueLabel.SetHExpand(true)
+	valueLabel.SetWrap(true)
+	valueLabel.SetSelectable(true)
+	row.Append(valueLabel)
+
+	// ans is set by calculating, not edited
+	if name == "ans" {
+		return row
+	}
+
+	editBtn := gtk.NewButton()
+	editBtn.SetLabel("✎")
+	editBtn.AddCSSClass("shift-ctrl-button")
+	editBtn.SetTooltipText("Edit this variable")
+	editBtn.SetVAlign(gtk.AlignCenter)
+	editBtn.ConnectClicked(func() {
+		a.variableEntry.SetText(name + " = " + val.String())
+		a.variableEntry.GrabFocus()
+	})
+	row.Append(editBtn)
+
+	deleteBtn := gtk.NewButton()
+	deleteBtn.SetLabel("✕")
+	deleteBtn.AddCSSClass("shift-ctrl-button")
+	deleteBtn.SetTooltipText("Delete this variable")
+	deleteBtn.SetVAlign(gtk.AlignCenter)
+	deleteBtn.ConnectClicked(func() {
+		a.engine.DeleteVariable(name)
+		a.listVariables()
+		a.saveState()
+	})
+	row.Append(deleteBtn)
+	return row
+}
+
+// maxListedHistory bounds the rows in the history panel; older matches
+// can be found by searching.
+const maxListedHistory = 200
+
+// updateHistory lists the engine history again if it has changed since
+// it was last listed.
+func (a *App) updateHistory() {
+	history := a.engine.History
+	var last time.Time
+	if len(history) > 0 {
+		last = history[len(history)-1].Time
+	}
+	if len(history) == a.historyLen && last.Equal(a.historyLast) {
+		return
+	}
+	a.listHistory()
+}
+
+// listHistory lists the history entries matching the search box and the
+// date range, newest first.
+func (a *App) listHistory() {
+	history := a.engine.History
+	a.historyLen = len(history)
+	a.historyLast = time.Time{}
+	if len(history) > 0 {
+		a.historyLast = history[len(history)-1].Time
+	}
+
+	entries := a.engine.SearchHistory(a.historyQuery())
+	if len(entries) > maxListedHistory {
+		entries = entries[len(entries)-maxListedHistory:]
+	}
+	a.historyShown = entries
+
+	a.historyList.RemoveAll()
+	for i := len(entries) - 1; i >= 0; i-- {
+		a.historyList.Append(a.createHistoryRow(entries[i]))
+	}
+}
+
+func (a *App) historyQuery() calculator.HistoryQuery {
+	q := calculator.HistoryQuery{Text: a.historySearch.Text()}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch a.historyRange.Selected() {
+	case 1:
+		q.From = today
+	case 2:
+		q.From = today.AddDate(0, 0, -1)
+		q.To = today
+	case 3:
+		q.From = today.AddDate(0, 0, -6)
+	case 4:
+		q.From = today.AddDate(0, 0, -29)
+	}
+	return q
+}
+
+func (a *App) createHistoryRow(entry calculator.HistoryEntry) *gtk.Box {
+	row := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	row.AddCSSClass("history-row")
+
+	labels := gtk.NewBox(gtk.OrientationVertical, 0)
+	labels.SetHExpand(true)
+
+	// Entries from the programmer keypad keep their own notation
+	expr, result := entry.Expression, entry.Result
+	if entry.Base == calculator.Decimal {
+		expr = a.engine.FormatExpression(expr)
+		if entry.Value != nil {
+			result = a.engine.Format(entry.Value)
+		}
+	}
+	exprLabel := gtk.NewLabel(expr)
+	exprLabel.AddCSSClass("history-expression")
+	exprLabel.SetXAlign(1)
+	exprLabel.SetWrap(true)
+	labels.Append(exprLabel)
+
+	resultLabel := gtk.NewLabel("= " + result)
+	resultLabel.AddCSSClass("history-result")
+	if entry.Failed() {
+		resultLabel.SetText(entry.Error)
+		resultLabel.AddCSSClass("history-error")
+	}
+	resultLabel.SetXAlign(1)
+	resultLabel.SetWrap(true)
+	labels.Append(resultLabel)
+	row.Append(labels)
+
+	editBtn := gtk.NewButton()
+	editBtn.SetLabel("✎")
+	editBtn.AddCSSClass("shift-ctrl-button")
+	editBtn.SetTooltipText("Edit this expression")
+	editBtn.SetVAlign(gtk.AlignCenter)
+	editBtn.ConnectClicked(func() {
+		// Bitwise operations are not expressions, so fall back to their
+		// result.
+		if err := a.engine.LoadExpression(entry.Expression); err != nil {
+			a.engine.RecallHistory(entry)
+		}
+		a.refreshDisplay()
+	})
+	row.Append(editBtn)
+
+	timeLabel := gtk.NewLabel(entry.Time.Format("Jan 2\n15:04"))
+	timeLabel.AddCSSClass("dim-label")
+	timeLabel.SetVAlign(gtk.AlignStart)
+	row.Prepend(timeLabel)
+	return row
+}
+
 func (a *App) createStandardKeypad() *gtk.Widget {
 	scrollWin := gtk.NewScrolledWindow()
 	scrollWin.SetVExpand(true)
@@ -246,13 +1180,10 @@ func (a *App) createStandardKeypad() *gtk.Widget {
 		{
 			{"%", "function-button", func() { a.engine.Percent(); a.updateDisplay() }},
 			{"CE", "function-button", func() { a.engine.ClearEntry(); a.updateDisplay() }},
-			{"C", "function-button", func() { a.engine.Clear(); a.updateDisplay() }},
+			{"C", "function-button", func() { a.engine.Clear(); a.updateDisplay(); a.expressionLbl.SetText("") }},
 			{"⌫", "function-button", func() { a.engine.Backspace(); a.updateDisplay() }},
 		},
 		{
-			{"1/x", "function-button", func() { a.engine.Reciprocal(); a.updateDisplay() }},
-			{"x²", "function-button", func() { a.engine.Square(); a.updateDisplay() }},
-			{"√", "function-button", func() { a.engine.Sqrt(); a.updateDisplay() }},
 			{"÷", "operator-button", func() { a.engine.SetOperation(calculator.OpDivide); a.updateExpression() }},
 		},
 		{
@@ -276,17 +1207,26 @@ func (a *App) createStandardKeypad() *gtk.Widget {
 		{
 			{"±", "function-button", func() { a.engine.Negate(); a.updateDisplay() }},
 			{"0", "number-button", func() { a.engine.InputDigit("0"); a.updateDisplay() }},
-			{".", "number-button", func() { a.engine.InputDecimal(); a.updateDisplay() }},
+			{a.engine.Locale.Decimal, "number-button", func() { a.engine.InputDecimal(); a.updateDisplay() }},
 			{"=", "equals-button", func() { a.engine.Calculate(); a.updateDisplay(); a.expressionLbl.SetText("") }},
 		},
 	}
 
-	for _, row := range keys {
+	for i, row := range keys {
 		rowBox := gtk.NewBox(gtk.OrientationHorizontal, 2)
 		rowBox.SetHomogeneous(true)
 		rowBox.SetVExpand(true)
+		if i == 1 {
+			// Function keys from the operation registry
+			for _, op := range keypadOps(calculator.StandardKeypad) {
+				rowBox.Append(a.createOpButton(op, "function-button"))
+			}
+		}
 		for _, key := range row {
 			btn := a.createButton(key.label, key.class, key.fn)
+			if key.label == "=" {
+				a.equalsButtons = append(a.equalsButtons, btn)
+			}
 			rowBox.Append(btn)
 		}
 		box.Append(rowBox)
@@ -315,15 +1255,17 @@ func (a *App) createScientificKeypad() *gtk.Widget {
 
 	degBtn := gtk.NewToggleButton()
 	degBtn.SetLabel("DEG")
-	degBtn.SetActive(true)
+	degBtn.SetActive(a.engine.AngleMode == calculator.Degrees)
 	degBtn.AddCSSClass("angle-button")
 
 	radBtn := gtk.NewToggleButton()
 	radBtn.SetLabel("RAD")
+	radBtn.SetActive(a.engine.AngleMode == calculator.Radians)
 	radBtn.AddCSSClass("angle-button")
 
 	gradBtn := gtk.NewToggleButton()
 	gradBtn.SetLabel("GRAD")
+	gradBtn.SetActive(a.engine.AngleMode == calculator.Gradians)
 	gradBtn.AddCSSClass("angle-button")
 
 	degBtn.ConnectClicked(func() {
@@ -350,73 +1292,146 @@ func (a *App) createScientificKeypad() *gtk.Widget {
 	angleModeBox.Append(gradBtn)
 	box.Append(angleModeBox)
 
-	// Scientific function keys
-	sciKeys := [][]struct {
-		label string
-		class string
-		fn    func()
-	}{
-		{
-			{"sin", "sci-button", func() { a.engine.Sin(); a.updateDisplay() }},
-			{"cos", "sci-button", func() { a.engine.Cos(); a.updateDisplay() }},
-			{"tan", "sci-button", func() { a.engine.Tan(); a.updateDisplay() }},
-			{"log", "sci-button", func() { a.engine.Log(); a.updateDisplay() }},
-			{"ln", "sci-button", func() { a.engine.Ln(); a.updateDisplay() }},
-		},
-		{
-			{"asin", "sci-button", func() { a.engine.Asin(); a.updateDisplay() }},
-			{"acos", "sci-button", func() { a.engine.Acos(); a.updateDisplay() }},
-			{"atan", "sci-button", func() { a.engine.Atan(); a.updateDisplay() }},
-			{"10ˣ", "sci-button", func() { a.engine.Exp10(); a.updateDisplay() }},
-			{"eˣ", "sci-button", func() { a.engine.Exp(); a.updateDisplay() }},
-		},
-		{
-			{"sinh", "sci-button", func() { a.engine.Sinh(); a.updateDisplay() }},
-			{"cosh", "sci-button", func() { a.engine.Cosh(); a.updateDisplay() }},
-			{"tanh", "sci-button", func() { a.engine.Tanh(); a.updateDisplay() }},
-			{"x²", "sci-button", func() { a.engine.Square(); a.updateDisplay() }},
-			{"x³", "sci-button", func() { a.engine.Cube(); a.updateDisplay() }},
-		},
-		{
-			{"asinh", "sci-button", func() { a.engine.Asinh(); a.updateDisplay() }},
-			{"acosh", "sci-button", func() { a.engine.Acosh(); a.updateDisplay() }},
-			{"atanh", "sci-button", func() { a.engine.Atanh(); a.updateDisplay() }},
-			{"log₂", "sci-button", func() { a.engine.Log2(); a.updateDisplay() }},
-			{"2ˣ", "sci-button", func() { a.engine.Exp2(); a.updateDisplay() }},
-		},
-		{
-			{"π", "sci-button", func() { a.engine.Pi(); a.updateDisplay() }},
-			{"e", "sci-button", func() { a.engine.E(); a.updateDisplay() }},
-			{"n!", "sci-button", func() { a.engine.Factorial(); a.updateDisplay() }},
-			{"√", "sci-button", func() { a.engine.Sqrt(); a.updateDisplay() }},
-			{"∛", "sci-button", func() { a.engine.Cbrt(); a.updateDisplay() }},
-		},
-		{
-			{"xʸ", "sci-button", func() { a.engine.SetOperation(calculator.OpPower); a.updateExpression() }},
-			{"mod", "sci-button", func() { a.engine.SetOperation(calculator.OpModulo); a.updateExpression() }},
-			{"|x|", "sci-button", func() { a.engine.Abs(); a.updateDisplay() }},
-			{"⌊x⌋", "sci-button", func() { a.engine.Floor(); a.updateDisplay() }},
-			{"⌈x⌉", "sci-button", func() { a.engine.Ceil(); a.updateDisplay() }},
-		},
-		{
-			{"round", "sci-button", func() { a.engine.Round(); a.updateDisplay() }},
-			{"1/x", "sci-button", func() { a.engine.Reciprocal(); a.updateDisplay() }},
-			{"%", "sci-button", func() { a.engine.Percent(); a.updateDisplay() }},
-			{"±", "sci-button", func() { a.engine.Negate(); a.updateDisplay() }},
-			{"EXP", "sci-button", func() { a.engine.InputExponent(); a.updateDisplay() }},
-		},
-	}
+	// Number mode and working precision
+	numberRow := gtk.NewBox(gtk.OrientationHorizontal, 4)
 
-	for _, row := range sciKeys {
-		rowBox := gtk.NewBox(gtk.OrientationHorizontal, 2)
-		rowBox.SetHomogeneous(true)
-		rowBox.SetVExpand(true)
-		for _, key := range row {
-			btn := a.createButton(key.label, key.class, key.fn)
-			rowBox.Append(btn)
+	decimalBtn := gtk.NewToggleButton()
+	decimalBtn.SetLabel("DEC")
+	decimalBtn.AddCSSClass("angle-button")
+
+	fractionBtn := gtk.NewToggleButton()
+	fractionBtn.SetLabel("FRAC")
+	fractionBtn.AddCSSClass("angle-button")
+
+	fractionKey := gtk.NewButton()
+	fractionKey.SetLabel("a b/c")
+	fractionKey.AddCSSClass("angle-button")
+	fractionKey.ConnectClicked(func() {
+		a.engine.InputFraction()
+		a.updateDisplay()
+	})
+
+	complexBtn := gtk.NewToggleButton()
+	complexBtn.SetLabel("CPLX")
+	complexBtn.AddCSSClass("angle-button")
+
+	imaginaryKey := gtk.NewButton()
+	imaginaryKey.SetLabel("i")
+	imaginaryKey.AddCSSClass("angle-button")
+	imaginaryKey.ConnectClicked(func() {
+		a.engine.InputImaginary()
+		a.updateDisplay()
+	})
+
+	polarBtn := gtk.NewToggleButton()
+	polarBtn.SetLabel("r∠θ")
+	polarBtn.AddCSSClass("angle-button")
+	polarBtn.SetActive(a.engine.ComplexDisplay == calculator.ComplexPolar)
+	polarBtn.ConnectToggled(func() {
+		if polarBtn.Active() {
+			a.engine.SetComplexDisplay(calculator.ComplexPolar)
+		} else {
+			a.engine.SetComplexDisplay(calculator.ComplexRectangular)
 		}
-		box.Append(rowBox)
+		a.updateDisplay()
+	})
+
+	fractionFormatKey := gtk.NewButton()
+	fractionFormatKey.SetLabel("F⇔D")
+	fractionFormatKey.AddCSSClass("angle-button")
+	fractionFormatKey.ConnectClicked(func() {
+		a.engine.CycleFractionDisplay()
+		a.updateDisplay()
+	})
+
+	showNumberMode := func(mode calculator.NumberMode) {
+		decimalBtn.SetActive(mode == calculator.ModeDecimal)
+		fractionBtn.SetActive(mode == calculator.ModeFraction)
+		fractionKey.SetSensitive(mode == calculator.ModeFraction)
+		fractionFormatKey.SetSensitive(mode == calculator.ModeFraction)
+		complexBtn.SetActive(mode == calculator.ModeComplex)
+		imaginaryKey.SetSensitive(mode == calculator.ModeComplex)
+		polarBtn.SetSensitive(mode == calculator.ModeComplex)
 	}
+	showNumberMode(a.engine.NumberMode)
+	setNumberMode := func(mode calculator.NumberMode) {
+		a.engine.SetNumberMode(mode)
+		showNumberMode(mode)
+		a.updateDisplay()
+	}
+	decimalBtn.ConnectClicked(func() { setNumberMode(calculator.ModeDecimal) })
+	fractionBtn.ConnectClicked(func() { setNumberMode(calculator.ModeFraction) })
+	complexBtn.ConnectClicked(func() { setNumberMode(calculator.ModeComplex) })
+
+	numberRow.Append(decimalBtn)
+	numberRow.Append(fractionBtn)
+	numberRow.Append(complexBtn)
+	numberRow.Append(fractionKey)
+	numberRow.Append(fractionFormatKey)
+	numberRow.Append(imaginaryKey)
+	numberRow.Append(polarBtn)
+
+	precisionBox := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	precisionBox.SetHExpand(true)
+	precisionBox.SetHAlign(gtk.AlignEnd)
+	precisionLabel := gtk.NewLabel("Digits:")
+	precisionLabel.AddCSSClass("dim-label")
+	precisionBox.Append(precisionLabel)
+
+	precisionSpin := gtk.NewSpinButtonWithRange(1, 500, 1)
+	precisionSpin.SetValue(float64(a.engine.Precision))
+	precisionSpin.ConnectValueChanged(func() {
+		a.engine.SetPrecision(precisionSpin.ValueAsInt())
+		a.updateDisplay()
+	})
+	precisionBox.Append(precisionSpin)
+	numberRow.Append(precisionBox)
+	box.Append(numberRow)
+
+	// Display format
+	formatRow := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	formatLabel := gtk.NewLabel("Display:")
+	formatLabel.AddCSSClass("dim-label")
+	formatRow.Append(formatLabel)
+
+	formatDrop := gtk.NewDropDownFromStrings([]string{"Auto", "FIX", "SCI", "ENG", "SIG"})
+	formatDrop.SetTooltipText("Fixed decimals, scientific, engineering or significant figures")
+	formatDrop.SetSelected(uint(a.engine.DisplayFormat))
+	formatRow.Append(formatDrop)
+
+	formatDigits := gtk.NewSpinButtonWithRange(0, 30, 1)
+	formatDigits.SetValue(float64(a.engine.DisplayDigits))
+	formatDigits.SetSensitive(a.engine.DisplayFormat != calculator.FormatAuto)
+	formatRow.Append(formatDigits)
+
+	siBtn := gtk.NewToggleButton()
+	siBtn.SetLabel("SI")
+	siBtn.AddCSSClass("angle-button")
+	siBtn.SetTooltipText("Show ENG exponents as SI prefixes (4.70k)")
+	siBtn.SetActive(a.engine.SIPrefixes)
+	siBtn.SetSensitive(a.engine.DisplayFormat == calculator.FormatEngineering)
+	formatRow.Append(siBtn)
+
+	setFormat := func() {
+		format := calculator.DisplayFormat(formatDrop.Selected())
+		a.engine.SetDisplayFormat(format, formatDigits.ValueAsInt())
+		if formatDigits.ValueAsInt() != a.engine.DisplayDigits {
+			formatDigits.SetValue(float64(a.engine.DisplayDigits))
+		}
+		formatDigits.SetSensitive(format != calculator.FormatAuto)
+		siBtn.SetSensitive(format == calculator.FormatEngineering)
+		a.refreshFormatted()
+	}
+	formatDrop.NotifyProperty("selected", setFormat)
+	formatDigits.ConnectValueChanged(setFormat)
+	siBtn.ConnectToggled(func() {
+		a.engine.SetSIPrefixes(siBtn.Active())
+		a.refreshFormatted()
+	})
+	box.Append(formatRow)
+
+	// Scientific function keys from the operation registry
+	a.appendOpRows(box, calculator.ScientificKeypad, 5, "sci-button")
 
 	// Standard number pad
 	numKeys := [][]struct {
@@ -425,7 +1440,7 @@ func (a *App) createScientificKeypad() *gtk.Widget {
 		fn    func()
 	}{
 		{
-			{"C", "function-button", func() { a.engine.Clear(); a.updateDisplay() }},
+			{"C", "function-button", func() { a.engine.Clear(); a.updateDisplay(); a.expressionLbl.SetText("") }},
 			{"CE", "function-button", func() { a.engine.ClearEntry(); a.updateDisplay() }},
 			{"⌫", "function-button", func() { a.engine.Backspace(); a.updateDisplay() }},
 			{"÷", "operator-button", func() { a.engine.SetOperation(calculator.OpDivide); a.updateExpression() }},
@@ -451,7 +1466,7 @@ func (a *App) createScientificKeypad() *gtk.Widget {
 		{
 			{"±", "function-button", func() { a.engine.Negate(); a.updateDisplay() }},
 			{"0", "number-button", func() { a.engine.InputDigit("0"); a.updateDisplay() }},
-			{".", "number-button", func() { a.engine.InputDecimal(); a.updateDisplay() }},
+			{a.engine.Locale.Decimal, "number-button", func() { a.engine.InputDecimal(); a.updateDisplay() }},
 			{"=", "equals-button", func() { a.engine.Calculate(); a.updateDisplay(); a.expressionLbl.SetText("") }},
 		},
 	}
@@ -462,6 +1477,9 @@ func (a *App) createScientificKeypad() *gtk.Widget {
 		rowBox.SetVExpand(true)
 		for _, key := range row {
 			btn := a.createButton(key.label, key.class, key.fn)
+			if key.label == "=" {
+				a.equalsButtons = append(a.equalsButtons, btn)
+			}
 			rowBox.Append(btn)
 		}
 		box.Append(rowBox)
@@ -483,46 +1501,98 @@ func (a *App) createProgrammerKeypad() *gtk.Widget {
 	box.SetMarginBottom(4)
 	box.SetVExpand(true)
 
-	// Bit width and shift amount controls
-	controlsRow := gtk.NewBox(gtk.OrientationHorizontal, 8)
-	controlsRow.SetMarginBottom(4)
-
-	// Bit width selector
-	bitWidthBox := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	// Bit width selector: the common widths, and any other in the spin
+	// button
+	widthRow := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	widthRow.SetMarginBottom(4)
 	bitWidthLabel := gtk.NewLabel("Width:")
 	bitWidthLabel.AddCSSClass("dim-label")
-	bitWidthBox.Append(bitWidthLabel)
+	widthRow.Append(bitWidthLabel)
 
-	bitWidths := []struct {
-		label string
-		width calculator.BitWidth
-	}{
-		{"8", calculator.Bits8},
-		{"16", calculator.Bits16},
-		{"32", calculator.Bits32},
-		{"64", calculator.Bits64},
+	bitWidths := []calculator.BitWidth{
+		calculator.Bits8, calculator.Bits16, calculator.Bits32,
+		calculator.Bits64, calculator.Bits128, calculator.Bits256,
 	}
 
-	for _, bw := range bitWidths {
+	a.widthButtons = make(map[calculator.BitWidth]*gtk.ToggleButton)
+	var group *gtk.ToggleButton
+	for _, width := range bitWidths {
 		btn := gtk.NewToggleButton()
-		btn.SetLabel(bw.label)
+		btn.SetLabel(fmt.Sprint(width))
 		btn.AddCSSClass("bit-width-button")
-		if bw.width == calculator.Bits32 {
-			btn.SetActive(true)
+		if group == nil {
+			group = btn
+		} else {
+			btn.SetGroup(group)
 		}
-		width := bw.width
-		btn.ConnectClicked(func() {
-			a.bitWidth = width
-			a.updateProgrammerDisplay()
+		btn.SetActive(width == a.engine.BitWidth)
+		width := width
+		btn.ConnectToggled(func() {
+			if btn.Active() && a.engine.BitWidth != width {
+				a.engine.SetBitWidth(width)
+				a.updateProgrammerDisplay()
+			}
 		})
-		bitWidthBox.Append(btn)
+		a.widthButtons[width] = btn
+		widthRow.Append(btn)
 	}
+
+	a.widthSpin = gtk.NewSpinButtonWithRange(float64(calculator.MinBitWidth), float64(calculator.MaxBitWidth), 1)
+	a.widthSpin.AddCSSClass("bit-width-spin")
+	a.widthSpin.SetTooltipText(fmt.Sprintf("Any word size from %d to %d bits", calculator.MinBitWidth, calculator.MaxBitWidth))
+	a.widthSpin.SetValue(float64(a.engine.BitWidth))
+	a.widthSpin.ConnectValueChanged(func() {
+		if width := calculator.BitWidth(a.widthSpin.ValueAsInt()); a.engine.BitWidth != width {
+			a.engine.SetBitWidth(width)
+			a.updateProgrammerDisplay()
+		}
+	})
+	widthRow.Append(a.widthSpin)
+	box.Append(widthRow)
+
+	// Word reading, float view and shift amount controls
+	controlsRow := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	controlsRow.SetMarginBottom(4)
+	bitWidthBox := gtk.NewBox(gtk.OrientationHorizontal, 4)
+
+	// Signed or unsigned reading of the word
+	signedBtn := gtk.NewToggleButton()
+	signedBtn.SetLabel("±")
+	signedBtn.AddCSSClass("bit-width-button")
+	signedBtn.SetTooltipText("Show the word as a signed integer")
+	signedBtn.SetActive(a.engine.Signed)
+	signedBtn.ConnectToggled(func() {
+		a.engine.SetSigned(signedBtn.Active())
+		a.updateProgrammerDisplay()
+	})
+	bitWidthBox.Append(signedBtn)
+
+	saturateBtn := gtk.NewToggleButton()
+	saturateBtn.SetLabel("Sat")
+	saturateBtn.AddCSSClass("bit-width-button")
+	saturateBtn.SetTooltipText("Saturate: results that do not fit the word stop at its largest or smallest value")
+	saturateBtn.SetActive(a.engine.Saturate)
+	saturateBtn.ConnectToggled(func() {
+		a.engine.SetSaturate(saturateBtn.Active())
+	})
+	bitWidthBox.Append(saturateBtn)
+
+	floatBtn := gtk.NewToggleButton()
+	floatBtn.SetLabel("Float")
+	floatBtn.AddCSSClass("bit-width-button")
+	floatBtn.SetTooltipText("Show the word, or a number typed in, as IEEE 754 floats")
+	floatBtn.ConnectToggled(func() {
+		a.floatView.SetRevealChild(floatBtn.Active())
+		a.updateFloatView()
+	})
+	bitWidthBox.Append(floatBtn)
 	controlsRow.Append(bitWidthBox)
 
 	// Shift amount controls
 	shiftBox := gtk.NewBox(gtk.OrientationHorizontal, 4)
 	shiftBox.SetHExpand(true)
 	shiftBox.SetHAlign(gtk.AlignEnd)
+	a.shiftBox = shiftBox
 
 	shiftLabelPre := gtk.NewLabel("Shift:")
 	shiftLabelPre.AddCSSClass("dim-label")
@@ -548,7 +1618,7 @@ func (a *App) createProgrammerKeypad() *gtk.Widget {
 	shiftPlus.SetLabel("+")
 	shiftPlus.AddCSSClass("shift-ctrl-button")
 	shiftPlus.ConnectClicked(func() {
-		if a.shiftAmount < 63 {
+		if a.shiftAmount < int(a.engine.BitWidth)-1 {
 			a.shiftAmount++
 			a.shiftLabel.SetText(fmt.Sprintf("%d", a.shiftAmount))
 		}
@@ -600,12 +1670,32 @@ func (a *App) createProgrammerKeypad() *gtk.Widget {
 		baseBox.Append(row)
 	}
 	box.Append(baseBox)
+	box.Append(a.createFloatView())
 
-	// Bit display
-	a.bitDisplay = gtk.NewLabel("0000 0000 0000 0000 0000 0000 0000 0000")
-	a.bitDisplay.AddCSSClass("bit-display")
-	a.bitDisplay.SetSelectable(true)
-	box.Append(a.bitDisplay)
+	// Bit grid, with the status flags of the last result beside it
+	bitRow := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	bitRow.Append(a.createBitGrid())
+
+	flagBox := gtk.NewBox(gtk.OrientationHorizontal, 2)
+	flagBox.SetVAlign(gtk.AlignCenter)
+	flags := []struct {
+		name    string
+		tooltip string
+	}{
+		{"C", "Carry: the unsigned result did not fit the word"},
+		{"V", "Overflow: the signed result did not fit the word"},
+		{"Z", "Zero: every bit is clear"},
+		{"N", "Negative: the sign bit is set"},
+	}
+	for _, f := range flags {
+		label := gtk.NewLabel(f.name)
+		label.AddCSSClass("flag-indicator")
+		label.SetTooltipText(f.tooltip)
+		flagBox.Append(label)
+		a.flagLabels = append(a.flagLabels, label)
+	}
+	bitRow.Append(flagBox)
+	box.Append(bitRow)
 
 	// Hex digits row
 	hexRow := gtk.NewBox(gtk.OrientationHorizontal, 2)
@@ -624,81 +1714,8 @@ func (a *App) createProgrammerKeypad() *gtk.Widget {
 	}
 	box.Append(hexRow)
 
-	// Bitwise operations - Row 1 (basic)
-	bitwiseRow1 := gtk.NewBox(gtk.OrientationHorizontal, 2)
-	bitwiseRow1.SetHomogeneous(true)
-	bitwiseRow1.SetVExpand(true)
-	bitwiseKeys1 := []struct {
-		label string
-		fn    func()
-	}{
-		{"AND", func() { a.engine.SetBitwiseOperation(calculator.BitOpAnd); a.updateExpression() }},
-		{"OR", func() { a.engine.SetBitwiseOperation(calculator.BitOpOr); a.updateExpression() }},
-		{"XOR", func() { a.engine.SetBitwiseOperation(calculator.BitOpXor); a.updateExpression() }},
-		{"NOT", func() { a.engine.Not(); a.updateProgrammerDisplay() }},
-	}
-	for _, k := range bitwiseKeys1 {
-		btn := a.createButton(k.label, "bitwise-button", k.fn)
-		bitwiseRow1.Append(btn)
-	}
-	box.Append(bitwiseRow1)
-
-	// Bitwise operations - Row 2 (NAND, NOR, shifts)
-	bitwiseRow2 := gtk.NewBox(gtk.OrientationHorizontal, 2)
-	bitwiseRow2.SetHomogeneous(true)
-	bitwiseRow2.SetVExpand(true)
-	bitwiseKeys2 := []struct {
-		label string
-		fn    func()
-	}{
-		{"NAND", func() { a.engine.SetBitwiseOperation(calculator.BitOpNand); a.updateExpression() }},
-		{"NOR", func() { a.engine.SetBitwiseOperation(calculator.BitOpNor); a.updateExpression() }},
-		{"<<", func() { a.engine.LeftShift(uint(a.shiftAmount)); a.updateProgrammerDisplay() }},
-		{">>", func() { a.engine.RightShift(uint(a.shiftAmount)); a.updateProgrammerDisplay() }},
-	}
-	for _, k := range bitwiseKeys2 {
-		btn := a.createButton(k.label, "bitwise-button", k.fn)
-		bitwiseRow2.Append(btn)
-	}
-	box.Append(bitwiseRow2)
-
-	// Bitwise operations - Row 3 (rotate, count)
-	bitwiseRow3 := gtk.NewBox(gtk.OrientationHorizontal, 2)
-	bitwiseRow3.SetHomogeneous(true)
-	bitwiseRow3.SetVExpand(true)
-	bitwiseKeys3 := []struct {
-		label string
-		fn    func()
-	}{
-		{"RoL", func() { a.engine.RotateLeft(uint(a.shiftAmount), a.bitWidth); a.updateProgrammerDisplay() }},
-		{"RoR", func() { a.engine.RotateRight(uint(a.shiftAmount), a.bitWidth); a.updateProgrammerDisplay() }},
-		{"Cnt", func() { a.engine.CountBits(); a.updateProgrammerDisplay() }},
-		{"2's", func() { a.engine.TwosComplement(a.bitWidth); a.updateProgrammerDisplay() }},
-	}
-	for _, k := range bitwiseKeys3 {
-		btn := a.createButton(k.label, "bitwise-button", k.fn)
-		bitwiseRow3.Append(btn)
-	}
-	box.Append(bitwiseRow3)
-
-	// Bitwise operations - Row 4 (advanced)
-	bitwiseRow4 := gtk.NewBox(gtk.OrientationHorizontal, 2)
-	bitwiseRow4.SetHomogeneous(true)
-	bitwiseRow4.SetVExpand(true)
-	bitwiseKeys4 := []struct {
-		label string
-		fn    func()
-	}{
-		{"LZ", func() { a.engine.LeadingZeros(a.bitWidth); a.updateProgrammerDisplay() }},
-		{"TZ", func() { a.engine.TrailingZeros(); a.updateProgrammerDisplay() }},
-		{"Swap", func() { a.engine.ByteSwap(a.bitWidth); a.updateProgrammerDisplay() }},
-		{"Tog", func() { a.toggleBitAtPosition(); a.updateProgrammerDisplay() }},
-	}
-	for _, k := range bitwiseKeys4 {
-		btn := a.createButton(k.label, "bitwise-button", k.fn)
-		bitwiseRow4.Append(btn)
-	}
-	box.Append(bitwiseRow4)
+	// Bitwise operations from the operation registry
+	a.appendOpRows(box, calculator.ProgrammerKeypad, 4, "bitwise-button")
 
 	// Number pad
 	numKeys := [][]struct {
@@ -707,7 +1724,7 @@ func (a *App) createProgrammerKeypad() *gtk.Widget {
 		fn    func()
 	}{
 		{
-			{"C", "function-button", func() { a.engine.Clear(); a.updateProgrammerDisplay() }},
+			{"C", "function-button", func() { a.engine.Clear(); a.updateProgrammerDisplay(); a.expressionLbl.SetText("") }},
 			{"CE", "function-button", func() { a.engine.ClearEntry(); a.updateProgrammerDisplay() }},
 			{"⌫", "function-button", func() { a.engine.Backspace(); a.updateProgrammerDisplay() }},
 			{"÷", "operator-button", func() { a.engine.SetOperation(calculator.OpDivide); a.updateExpression() }},
@@ -744,6 +1761,9 @@ func (a *App) createProgrammerKeypad() *gtk.Widget {
 		rowBox.SetVExpand(true)
 		for _, key := range row {
 			btn := a.createButton(key.label, key.class, key.fn)
+			if key.label == "=" {
+				a.equalsButtons = append(a.equalsButtons, btn)
+			}
 			rowBox.Append(btn)
 		}
 		box.Append(rowBox)
@@ -753,15 +1773,6 @@ func (a *App) createProgrammerKeypad() *gtk.Widget {
 	return &scrollWin.Widget
 }
 
-func (a *App) toggleBitAtPosition() {
-	// Toggle bit at position equal to shift amount (0-indexed)
-	pos := a.shiftAmount - 1
-	if pos < 0 {
-		pos = 0
-	}
-	a.engine.ToggleBit(uint(pos))
-}
-
 func (a *App) createDateTimePage() *gtk.Widget {
 	// Create scrollable container for all date content
 	scrollWin := gtk.NewScrolledWindow()
@@ -1127,7 +2138,7 @@ func (a *App) calculateAddSubtract() {
 		return
 	}
 
-	years, months, days := parseTimeDelta(input)
+	years, months, days := calculator.ParseTimeDelta(input)
 	result := startDate.AddDate(years, months, days)
 
 	a.addSubResult.SetText(fmt.Sprintf("Result: %s (%s)",
@@ -1135,55 +2146,204 @@ func (a *App) calculateAddSubtract() {
 		result.Format("Monday")))
 }
 
-func parseTimeDelta(input string) (years, months, days int) {
-	input = strings.ToLower(strings.TrimSpace(input))
-	parts := strings.Fields(input)
+func (a *App) createButton(label, cssClass string, onClick func()) *gtk.Button {
+	btn := gtk.NewButton()
+	btn.SetLabel(label)
+	btn.AddCSSClass("calc-button")
+	btn.AddCSSClass(cssClass)
+	btn.SetHExpand(true)
+	btn.SetVExpand(true)
+	btn.ConnectClicked(onClick)
+	return btn
+}
 
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if len(part) < 2 {
-			continue
+// keypadOps returns the operations of the registry with a key on keypad.
+func keypadOps(keypad calculator.Keypad) []*calculator.Op {
+	var ops []*calculator.Op
+	for _, op := range calculator.Ops() {
+		if op.Keypads&keypad != 0 {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// createOpButton creates the key of a registry operation.
+func (a *App) createOpButton(op *calculator.Op, cssClass string) *gtk.Button {
+	btn := a.createButton(op.Symbol, cssClass, func() { a.pressOp(op) })
+	btn.SetTooltipText(op.Help)
+	return btn
+}
+
+// appendOpRows appends the keys of the operations on keypad to box, in
+// rows of perRow.
+func (a *App) appendOpRows(box *gtk.Box, keypad calculator.Keypad, perRow int, cssClass string) {
+	ops := keypadOps(keypad)
+	for start := 0; start < len(ops); start += perRow {
+		rowBox := gtk.NewBox(gtk.OrientationHorizontal, 2)
+		rowBox.SetHomogeneous(true)
+		rowBox.SetVExpand(true)
+		for _, op := range ops[start:min(start+perRow, len(ops))] {
+			rowBox.Append(a.createOpButton(op, cssClass))
 		}
+		box.Append(rowBox)
+	}
+}
+
+// pressOp presses the key of a registry operation with the programmer
+// keypad settings, and shows the result.
+func (a *App) pressOp(op *calculator.Op) {
+	a.engine.Press(op.Name, calculator.KeySettings{
+		Shift: uint(a.shiftAmount),
+	})
+	if a.mode == ModeProgrammer {
+		a.updateProgrammerDisplay()
+	}
+	a.updateExpression()
+}
+
+// keypads returns the registry keypads of the current mode.
+func (a *App) keypads() calculator.Keypad {
+	var keypads calculator.Keypad
+	switch a.mode {
+	case ModeStandard:
+		keypads = calculator.StandardKeypad
+	case ModeScientific:
+		keypads = calculator.ScientificKeypad
+	case ModeProgrammer:
+		keypads = calculator.ProgrammerKeypad
+	}
+	if a.engine.RPN {
+		keypads |= calculator.StackKeypad
+	}
+	return keypads
+}
+
+// shortcutKey is a key, in lower case, and whether Ctrl is held with it.
+type shortcutKey struct {
+	keyval uint
+	ctrl   bool
+}
 
-		unit := part[len(part)-1]
-		numStr := part[:len(part)-1]
+// parseShortcut reads a registry shortcut such as "Ctrl+S" or "&".
+func parseShortcut(shortcut string) (shortcutKey, bool) {
+	rest, ctrl := strings.CutPrefix(shortcut, "Ctrl+")
+	r, size := utf8.DecodeRuneInString(rest)
+	if rest == "" || size != len(rest) {
+		return shortcutKey{}, false
+	}
+	return shortcutKey{gdk.KeyvalToLower(gdk.UnicodeToKeyval(uint32(r))), ctrl}, true
+}
+
+// helpSections are the keypads listed by the help window. Operations
+// without a key, such as functions added for expressions only, are listed
+// last.
+var helpSections = []struct {
+	title  string
+	keypad calculator.Keypad
+}{
+	{"Standard", calculator.StandardKeypad},
+	{"Scientific", calculator.ScientificKeypad},
+	{"Programmer", calculator.ProgrammerKeypad},
+	{"RPN stack", calculator.StackKeypad},
+	{"Expressions only", 0},
+}
+
+// showHelp opens a window listing the keys of each keypad from the
+// operation registry, with what they do, how they are written in
+// expressions and their shortcuts, followed by the user functions.
+func (a *App) showHelp() {
+	grid := gtk.NewGrid()
+	grid.SetColumnSpacing(16)
+	grid.SetRowSpacing(2)
+	grid.SetMarginStart(12)
+	grid.SetMarginEnd(12)
+	grid.SetMarginTop(8)
+	grid.SetMarginBottom(12)
+
+	row := 0
+	addHeading := func(title string) {
+		lbl := gtk.NewLabel(title)
+		lbl.AddCSSClass("help-heading")
+		lbl.SetXAlign(0)
+		grid.Attach(lbl, 0, row, 4, 1)
+		row++
+	}
+	addRow := func(cells ...string) {
+		for i, text := range cells {
+			lbl := gtk.NewLabel(text)
+			lbl.SetXAlign(0)
+			if i == 0 {
+				lbl.AddCSSClass("help-key")
+			} else if i > 1 {
+				lbl.AddCSSClass("dim-label")
+			}
+			grid.Attach(lbl, i, row, 1, 1)
+		}
+		row++
+	}
 
-		num, err := strconv.Atoi(numStr)
-		if err != nil {
+	ops := calculator.Ops()
+	for _, section := range helpSections {
+		var listed []*calculator.Op
+		for _, op := range ops {
+			if op.Keypads&section.keypad != 0 || section.keypad == 0 && op.Keypads == 0 {
+				listed = append(listed, op)
+			}
+		}
+		if len(listed) == 0 {
 			continue
 		}
+		addHeading(section.title)
+		for _, op := range listed {
+			addRow(op.Symbol, op.Help, op.Expression(), op.Shortcut)
+		}
+	}
 
-		switch unit {
-		case 'y':
-			years = num
-		case 'm':
-			months = num
-		case 'd':
-			days = num
-		case 'w':
-			days += num * 7
+	if names := a.engine.FunctionNames(); len(names) > 0 {
+		addHeading("User functions")
+		for _, name := range names {
+			f, _ := a.engine.Function(name)
+			addRow(f.Name, f.Body, f.Name+"("+strings.Join(f.Params, ", ")+")", "")
 		}
 	}
-	return
-}
 
-func (a *App) createButton(label, cssClass string, onClick func()) *gtk.Button {
-	btn := gtk.NewButton()
-	btn.SetLabel(label)
-	btn.AddCSSClass("calc-button")
-	btn.AddCSSClass(cssClass)
-	btn.SetHExpand(true)
-	btn.SetVExpand(true)
-	btn.ConnectClicked(onClick)
-	return btn
+	scrollWin := gtk.NewScrolledWindow()
+	scrollWin.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scrollWin.SetChild(grid)
+
+	win := gtk.NewWindow()
+	win.SetTitle("SwitchCalc Keys")
+	win.SetTransientFor(&a.window.Window)
+	win.SetDefaultSize(560, 640)
+	win.SetChild(scrollWin)
+	win.Show()
 }
 
 func (a *App) updateDisplay() {
 	a.display.SetText(a.engine.Display)
+	a.updateStack()
+	// Errors are shown as a message until cleared
+	if a.engine.Err != nil {
+		a.display.AddCSSClass("error-display")
+		a.display.SetTooltipText("Press C or CE to continue")
+	} else {
+		a.display.RemoveCSSClass("error-display")
+		a.display.SetTooltipText("")
+	}
+	a.updateHistory()
+	a.updateVariables()
 }
 
 func (a *App) updateExpression() {
-	if a.engine.PendingOp != calculator.OpNone {
+	// RPN operators act at once, so there is no expression to show
+	if a.engine.RPN {
+		a.refreshDisplay()
+		return
+	}
+	if expr := a.engine.Expression(); expr != "" {
+		a.expressionLbl.SetText(a.engine.FormatExpression(expr))
+	} else if a.engine.PendingOp != calculator.OpNone {
 		a.expressionLbl.SetText(fmt.Sprintf("%s %s", a.engine.Display, a.opSymbol(a.engine.PendingOp)))
 	}
 	a.updateDisplay()
@@ -1210,7 +2370,7 @@ func (a *App) opSymbol(op calculator.Operation) string {
 func (a *App) updateProgrammerDisplay() {
 	a.updateDisplay()
 
-	val := int64(a.engine.CurrentValue)
+	val := a.engine.IntValue()
 
 	// Update all base displays
 	for base, label := range a.baseLabels {
@@ -1220,8 +2380,33 @@ func (a *App) updateProgrammerDisplay() {
 		a.engine.NumberBase = oldBase
 	}
 
-	// Update bit display
-	a.bitDisplay.SetText(a.engine.GetBinaryString(calculator.Bits32))
+	// Show the word size, which may have been set by typing or loading
+	a.widthSpin.SetValue(float64(a.engine.BitWidth))
+	for width, btn := range a.widthButtons {
+		if active := width == a.engine.BitWidth; btn.Active() != active {
+			btn.SetActive(active)
+		}
+	}
+
+	// Keep the shift amount from 1 to one less than the width, which
+	// leaves nothing to choose for a 1-bit word
+	a.shiftAmount = min(max(a.shiftAmount, 1), max(int(a.engine.BitWidth)-1, 1))
+	a.shiftLabel.SetText(fmt.Sprintf("%d", a.shiftAmount))
+	a.shiftBox.SetSensitive(a.engine.BitWidth > 1)
+
+	// Update bit grid
+	a.updateBitGrid()
+	a.updateFloatView()
+
+	// Update the status flags
+	flags := a.engine.Flags
+	for i, set := range []bool{flags.Carry, flags.Overflow, flags.Zero, flags.Negative} {
+		if set {
+			a.flagLabels[i].AddCSSClass("flag-set")
+		} else {
+			a.flagLabels[i].RemoveCSSClass("flag-set")
+		}
+	}
 
 	// Enable/disable hex buttons based on current base
 	hexEnabled := a.engine.NumberBase == calculator.Hexadecimal
@@ -1230,6 +2415,255 @@ func (a *App) updateProgrammerDisplay() {
 	}
 }
 
+// createFloatView returns the float view, which shows the word, or a
+// number typed into it, as the bit patterns of the IEEE 754 formats.
+func (a *App) createFloatView() *gtk.Revealer {
+	box := gtk.NewBox(gtk.OrientationVertical, 4)
+	box.AddCSSClass("base-display")
+	box.SetMarginBottom(4)
+
+	a.floatEntry = gtk.NewEntry()
+	a.floatEntry.SetPlaceholderText("-0.15625 or 0x3E200000, or empty for the word")
+	a.floatEntry.ConnectChanged(a.updateFloatView)
+	box.Append(a.floatEntry)
+
+	a.floatTable = gtk.NewGrid()
+	a.floatTable.SetColumnSpacing(12)
+	a.floatTable.SetRowSpacing(2)
+	box.Append(a.floatTable)
+
+	a.floatView = gtk.NewRevealer()
+	a.floatView.SetChild(box)
+	return a.floatView
+}
+
+// updateFloatView shows the number typed into the float view in each
+// format, split into its fields, or reads the hex pattern typed, or that
+// of the word when nothing is, back as a float.
+func (a *App) updateFloatView() {
+	if !a.floatView.RevealChild() {
+		return
+	}
+	for child := a.floatTable.FirstChild(); child != nil; child = a.floatTable.FirstChild() {
+		a.floatTable.Remove(child)
+	}
+	text := a.floatEntry.Text()
+	if strings.TrimSpace(text) == "" {
+		text = a.engine.FloatPattern()
+	}
+	all, err := calculator.InspectFloat(text)
+	if err != nil {
+		lbl := gtk.NewLabel(err.Error())
+		lbl.AddCSSClass("dim-label")
+		lbl.SetXAlign(0)
+		a.floatTable.Attach(lbl, 0, 0, 6, 1)
+		return
+	}
+	addRow := func(row int, class string, cells ...string) {
+		for i, text := range cells {
+			lbl := gtk.NewLabel(text)
+			lbl.AddCSSClass(class)
+			lbl.SetXAlign(0)
+			lbl.SetSelectable(true)
+			a.floatTable.Attach(lbl, i, row, 1, 1)
+		}
+	}
+	addRow(0, "base-label", "FMT", "BITS", "S", "EXP", "MANTISSA", "VALUE")
+	for i, b := range all {
+		addRow(i+1, "float-value", b.Format.String(), b.Hex(), fmt.Sprint(b.Sign()),
+			floatExponent(b), floatMantissa(b), b.ValueString())
+	}
+}
+
+// bitsPerRow is the number of bits in a row of the bit grid.
+const bitsPerRow = 32
+
+// createBitGrid returns the grid of the bits of the word. Clicking a bit
+// toggles it, and dragging across bits sets them all, or clears them if
+// the bit the drag started on was set.
+func (a *App) createBitGrid() *gtk.Widget {
+	a.bitGrid = gtk.NewBox(gtk.OrientationVertical, 4)
+	a.bitGrid.AddCSSClass("bit-display")
+	a.bitGrid.SetHExpand(true)
+
+	var startX, startY float64
+	drag := gtk.NewGestureDrag()
+	drag.ConnectDragBegin(func(x, y float64) {
+		pos, ok := a.bitAt(x, y)
+		if !ok {
+			return
+		}
+		startX, startY = x, y
+		a.bitDrag.active = true
+		a.bitDrag.start, a.bitDrag.end = pos, pos
+		a.updateBitGrid()
+	})
+	drag.ConnectDragUpdate(func(offsetX, offsetY float64) {
+		if !a.bitDrag.active {
+			return
+		}
+		if pos, ok := a.bitAt(startX+offsetX, startY+offsetY); ok && pos != a.bitDrag.end {
+			a.bitDrag.end = pos
+			a.updateBitGrid()
+		}
+	})
+	drag.ConnectDragEnd(func(offsetX, offsetY float64) {
+		if !a.bitDrag.active {
+			return
+		}
+		a.bitDrag.active = false
+		start, end := a.bitDrag.start, a.bitDrag.end
+		if start == end {
+			a.engine.ToggleBit(start)
+		} else {
+			a.engine.SetBitRange(min(start, end), max(start, end), a.engine.GetBit(start) == 0)
+		}
+		a.updateProgrammerDisplay()
+	})
+	a.bitGrid.AddController(drag)
+	return &a.bitGrid.Widget
+}
+
+// buildBitGrid fills the bit grid with a cell for each bit of the word,
+// highest first, in rows of bitsPerRow. The bits are grouped in nibbles,
+// each labelled with the index of its lowest bit.
+func (a *App) buildBitGrid() {
+	for child := a.bitGrid.FirstChild(); child != nil; child = a.bitGrid.FirstChild() {
+		a.bitGrid.Remove(child)
+	}
+	width := int(a.engine.BitWidth)
+	a.bitCells = make([]*gtk.Label, width)
+	// Rows and nibbles line up with bit 0, so a 48-bit word has a row of
+	// 16 bits above one of 32
+	for top := width - 1; top >= 0; top -= top%bitsPerRow + 1 {
+		row := gtk.NewBox(gtk.OrientationHorizontal, 6)
+		row.SetHAlign(gtk.AlignEnd)
+		for nibble := top; nibble >= top-top%bitsPerRow; nibble -= nibble%4 + 1 {
+			group := gtk.NewBox(gtk.OrientationVertical, 0)
+			cells := gtk.NewBox(gtk.OrientationHorizontal, 0)
+			low := nibble - nibble%4
+			for pos := nibble; pos >= low; pos-- {
+				cell := gtk.NewLabel("0")
+				cell.AddCSSClass("bit-cell")
+				cell.SetName(fmt.Sprintf("bit-%d", pos))
+				cell.SetTooltipText(fmt.Sprintf("Bit %d", pos))
+				a.bitCells[pos] = cell
+				cells.Append(cell)
+			}
+			group.Append(cells)
+			index := gtk.NewLabel(fmt.Sprint(low))
+			index.AddCSSClass("bit-index")
+			index.SetHAlign(gtk.AlignEnd)
+			group.Append(index)
+			row.Append(group)
+		}
+		a.bitGrid.Append(row)
+	}
+}
+
+// updateBitGrid shows the bits of the current value in the bit grid,
+// rebuilding it if the word size has changed, and marks the bits being
+// dragged over.
+func (a *App) updateBitGrid() {
+	if len(a.bitCells) != int(a.engine.BitWidth) {
+		a.buildBitGrid()
+	}
+	lo, hi := min(a.bitDrag.start, a.bitDrag.end), max(a.bitDrag.start, a.bitDrag.end)
+	for pos, cell := range a.bitCells {
+		bit := a.engine.GetBit(uint(pos))
+		cell.SetText(fmt.Sprint(bit))
+		if bit == 1 {
+			cell.AddCSSClass("bit-set")
+		} else {
+			cell.RemoveCSSClass("bit-set")
+		}
+		if a.bitDrag.active && uint(pos) >= lo && uint(pos) <= hi {
+			cell.AddCSSClass("bit-selected")
+		} else {
+			cell.RemoveCSSClass("bit-selected")
+		}
+	}
+}
+
+// bitAt returns the position of the bit cell at x, y in the bit grid.
+func (a *App) bitAt(x, y float64) (uint, bool) {
+	picked := a.bitGrid.Pick(x, y, gtk.PickDefault)
+	if picked == nil {
+		return 0, false
+	}
+	var pos uint
+	if _, err := fmt.Sscanf(gtk.BaseWidget(picked).Name(), "bit-%d", &pos); err != nil {
+		return 0, false
+	}
+	return pos, true
+}
+
+// paste enters the clipboard text, a number in any grouping or an
+// expression, into the calculator.
+func (a *App) paste() {
+	clipboard := a.window.Clipboard()
+	clipboard.ReadTextAsync(context.Background(), func(res gio.AsyncResulter) {
+		text, err := clipboard.ReadTextFinish(res)
+		if err != nil {
+			log.Printf("reading clipboard: %v", err)
+			return
+		}
+		if err := a.engine.Paste(text); err != nil {
+			a.expressionLbl.SetText(err.Error())
+			return
+		}
+		a.refreshDisplay()
+	})
+}
+
+// loadSearchResult makes the result of a desktop search the current
+// value. A conversion such as "255 in hex" opens the programmer mode in
+// that base.
+func (a *App) loadSearchResult(text string) {
+	q, ok := parseSearchQuery(text)
+	if !ok {
+		return
+	}
+	if q.base != calculator.Decimal {
+		a.setMode(ModeProgrammer)
+	}
+	if _, err := a.engine.Execute(q.expr); err != nil {
+		a.updateDisplay()
+		return
+	}
+	if a.mode == ModeProgrammer {
+		a.engine.SetNumberBase(q.base)
+	}
+	a.refreshDisplay()
+	a.saveState()
+}
+
+// refreshDisplay redraws everything that shows engine state, after the
+// state has been replaced wholesale by undo or redo.
+func (a *App) refreshDisplay() {
+	if on := a.engine.Programmer; on != (a.mode == ModeProgrammer) {
+		mode := a.prevMode
+		if on {
+			mode = ModeProgrammer
+		}
+		a.showMode(mode)
+	}
+	if a.mode == ModeProgrammer {
+		a.updateProgrammerDisplay()
+	} else {
+		a.updateDisplay()
+	}
+	a.expressionLbl.SetText(a.engine.FormatExpression(a.engine.Expression()))
+}
+
+// refreshFormatted shows every value again after the display format has
+// changed.
+func (a *App) refreshFormatted() {
+	a.refreshDisplay()
+	a.listHistory()
+	a.listVariables()
+}
+
 func (a *App) calculateProgrammer() {
 	if int(a.engine.PendingOp) >= 100 {
 		a.engine.CalculateBitwise()
@@ -1241,11 +2675,56 @@ func (a *App) calculateProgrammer() {
 }
 
 func (a *App) setupKeyboardHandling() {
+	shortcuts := make(map[shortcutKey][]*calculator.Op)
+	for _, op := range calculator.Ops() {
+		if key, ok := parseShortcut(op.Shortcut); ok {
+			shortcuts[key] = append(shortcuts[key], op)
+		}
+	}
+
 	keyCtrl := gtk.NewEventControllerKey()
 	keyCtrl.ConnectKeyPressed(func(keyval, keycode uint, state gdk.ModifierType) bool {
 		// Check for Ctrl modifier for scientific shortcuts
 		ctrlPressed := state&gdk.ControlMask != 0
 
+		if keyval == gdk.KEY_F1 {
+			a.showHelp()
+			return true
+		}
+		if keyval == gdk.KEY_F5 {
+			a.runWorksheet()
+			return true
+		}
+
+		// Undo (Ctrl+Z), redo (Ctrl+Shift+Z), paste (Ctrl+V), history
+		// (Ctrl+H), variables (Ctrl+J) and open worksheet (Ctrl+O)
+		if ctrlPressed {
+			switch keyval {
+			case gdk.KEY_v, gdk.KEY_V:
+				a.paste()
+				return true
+			case gdk.KEY_h, gdk.KEY_H:
+				a.toggleSidePage("history")
+				return true
+			case gdk.KEY_j, gdk.KEY_J:
+				a.toggleSidePage("variables")
+				return true
+			case gdk.KEY_o, gdk.KEY_O:
+				a.chooseWorksheet()
+				return true
+			case gdk.KEY_z:
+				if a.engine.Undo() {
+					a.refreshDisplay()
+				}
+				return true
+			case gdk.KEY_Z:
+				if a.engine.Redo() {
+					a.refreshDisplay()
+				}
+				return true
+			}
+		}
+
 		// Handle programmer mode hex input (A-F)
 		if a.mode == ModeProgrammer && a.engine.NumberBase == calculator.Hexadecimal {
 			switch keyval {
@@ -1280,72 +2759,19 @@ func (a *App) setupKeyboardHandling() {
 			}
 		}
 
-		// Scientific mode shortcuts (Ctrl+key)
-		if a.mode == ModeScientific && ctrlPressed {
-			switch keyval {
-			case gdk.KEY_s, gdk.KEY_S:
-				a.engine.Sin()
-				a.updateDisplay()
-				return true
-			case gdk.KEY_c, gdk.KEY_C:
-				a.engine.Cos()
-				a.updateDisplay()
-				return true
-			case gdk.KEY_t, gdk.KEY_T:
-				a.engine.Tan()
-				a.updateDisplay()
-				return true
-			case gdk.KEY_l, gdk.KEY_L:
-				a.engine.Log()
-				a.updateDisplay()
-				return true
-			case gdk.KEY_n, gdk.KEY_N:
-				a.engine.Ln()
-				a.updateDisplay()
-				return true
-			case gdk.KEY_r, gdk.KEY_R:
-				a.engine.Sqrt()
-				a.updateDisplay()
-				return true
-			case gdk.KEY_p, gdk.KEY_P:
-				a.engine.Pi()
-				a.updateDisplay()
-				return true
-			case gdk.KEY_e, gdk.KEY_E:
-				a.engine.E()
-				a.updateDisplay()
+		// Shortcuts of the operation registry in the current mode
+		for _, op := range shortcuts[shortcutKey{gdk.KeyvalToLower(keyval), ctrlPressed}] {
+			if op.Keypads&a.keypads() != 0 {
+				a.pressOp(op)
 				return true
 			}
 		}
 
-		// Programmer mode shortcuts
-		if a.mode == ModeProgrammer {
-			switch keyval {
-			case gdk.KEY_ampersand:
-				a.engine.SetBitwiseOperation(calculator.BitOpAnd)
-				a.updateExpression()
-				return true
-			case gdk.KEY_bar:
-				a.engine.SetBitwiseOperation(calculator.BitOpOr)
-				a.updateExpression()
-				return true
-			case gdk.KEY_asciicircum:
-				a.engine.SetBitwiseOperation(calculator.BitOpXor)
-				a.updateExpression()
-				return true
-			case gdk.KEY_asciitilde:
-				a.engine.Not()
-				a.updateProgrammerDisplay()
-				return true
-			case gdk.KEY_less:
-				a.engine.LeftShift(uint(a.shiftAmount))
-				a.updateProgrammerDisplay()
-				return true
-			case gdk.KEY_greater:
-				a.engine.RightShift(uint(a.shiftAmount))
-				a.updateProgrammerDisplay()
-				return true
-			}
+		// Imaginary unit in complex mode
+		if a.mode == ModeScientific && !ctrlPressed && (keyval == gdk.KEY_i || keyval == gdk.KEY_j) {
+			a.engine.InputImaginary()
+			a.updateDisplay()
+			return true
 		}
 
 		switch keyval {
@@ -1391,6 +2817,22 @@ func (a *App) setupKeyboardHandling() {
 			a.engine.Percent()
 			a.updateDisplay()
 			return true
+		case gdk.KEY_asciicircum:
+			a.engine.SetOperation(calculator.OpPower)
+			a.updateExpression()
+			return true
+		case gdk.KEY_parenleft:
+			a.engine.OpenParen()
+			a.updateExpression()
+			return true
+		case gdk.KEY_parenright:
+			a.engine.CloseParen()
+			a.updateExpression()
+			return true
+		case gdk.KEY_semicolon:
+			a.engine.InputComma()
+			a.updateExpression()
+			return true
 		case gdk.KEY_Return, gdk.KEY_KP_Enter, gdk.KEY_equal:
 			if a.mode == ModeProgrammer {
 				a.calculateProgrammer()
@@ -1400,6 +2842,7 @@ func (a *App) setupKeyboardHandling() {
 			}
 		case gdk.KEY_Escape:
 			a.engine.Clear()
+			a.expressionLbl.SetText("")
 		case gdk.KEY_BackSpace:
 			a.engine.Backspace()
 		case gdk.KEY_Delete:
@@ -1465,6 +2908,18 @@ window {
 	letter-spacing: -0.01em;
 }
 
+.stack-display {
+	font-size: 0.95rem;
+	font-family: "Crimson Text", Georgia, serif;
+	color: alpha(#FAFAF8, 0.6);
+}
+
+.error-display {
+	font-size: 1.2rem;
+	font-family: inherit;
+	color: #dd7777;
+}
+
 /* Mode selector - glass buttons with burgundy accent */
 .mode-button {
 	background: alpha(#FAFAF8, 0.04);
@@ -1678,6 +3133,57 @@ window {
 	color: alpha(#FAFAF8, 0.8);
 }
 
+/* Bit grid cells */
+.bit-cell {
+	font-family: "SF Mono", "Consolas", monospace;
+	font-size: 12px;
+	min-width: 9px;
+	padding: 1px;
+	border-radius: 3px;
+	color: alpha(#FAFAF8, 0.35);
+}
+
+.bit-cell.bit-set {
+	color: #FAFAF8;
+}
+
+.bit-cell:hover {
+	background: alpha(#FAFAF8, 0.08);
+}
+
+.bit-cell.bit-selected {
+	background: alpha(#3e0000, 0.5);
+	color: #ddbfbf;
+}
+
+.bit-index {
+	font-size: 8px;
+	color: alpha(#FAFAF8, 0.3);
+}
+
+.float-value {
+	font-family: "SF Mono", "Consolas", monospace;
+	font-size: 11px;
+	color: #FAFAF8;
+}
+
+/* Status flags beside the bit display */
+.flag-indicator {
+	font-family: "SF Mono", "Consolas", monospace;
+	font-size: 11px;
+	min-width: 18px;
+	padding: 2px 4px;
+	border: 1px solid alpha(#FAFAF8, 0.06);
+	border-radius: 4px;
+	color: alpha(#FAFAF8, 0.25);
+}
+
+.flag-indicator.flag-set {
+	background: alpha(#3e0000, 0.4);
+	border-color: alpha(#8b5555, 0.35);
+	color: #ddbfbf;
+}
+
 /* Date calculator result */
 .date-result {
 	font-family: "Crimson Text", Georgia, serif;
@@ -1746,6 +3252,79 @@ entry placeholder {
 	box-shadow: 0 6px 20px alpha(#4e1010, 0.45);
 }
 
+/* History panel */
+.history-panel {
+	background: alpha(#FAFAF8, 0.03);
+	border-left: 1px solid alpha(#FAFAF8, 0.08);
+	padding: 8px;
+}
+
+.history-title {
+	color: #dd9999;
+	font-weight: 600;
+	font-size: 14px;
+}
+
+.history-list {
+	background: transparent;
+}
+
+.history-row {
+	padding: 6px 4px;
+	border-bottom: 1px solid alpha(#FAFAF8, 0.06);
+}
+
+.history-expression {
+	font-size: 12px;
+	font-style: italic;
+	color: alpha(#FAFAF8, 0.5);
+}
+
+.history-result {
+	font-size: 15px;
+	font-weight: 600;
+	color: #FAFAF8;
+}
+
+.history-error {
+	font-size: 13px;
+	font-weight: normal;
+	color: #dd7777;
+}
+
+.variable-name {
+	font-size: 14px;
+	font-weight: 600;
+	color: #dd9999;
+}
+
+.history-toggle {
+	font-size: 11px;
+	padding: 2px 8px;
+	background: alpha(#FAFAF8, 0.04);
+	border: 1px solid alpha(#FAFAF8, 0.08);
+	color: alpha(#FAFAF8, 0.7);
+	border-radius: 8px;
+}
+
+.history-toggle:checked {
+	background: alpha(#5e1515, 0.5);
+	border-color: alpha(#aa7070, 0.45);
+	color: #eedddd;
+}
+
+/* Help window */
+.help-heading {
+	font-size: 14px;
+	font-weight: 600;
+	color: #dd9999;
+	margin-top: 10px;
+}
+
+.help-key {
+	font-weight: 600;
+}
+
 /* Dim label */
 .dim-label {
 	font-size: 12px;
@@ -1800,6 +3379,12 @@ label {
 	background: alpha(#FAFAF8, 0.05);
 }
 
+.bit-width-spin {
+	font-size: 11px;
+	min-height: 24px;
+	font-family: "SF Mono", "Consolas", monospace;
+}
+
 /* Shift control buttons */
 .shift-ctrl-button {
 	font-size: 14px;
@@ -0,0 +1,10 @@
+package main
+
+type CalculatorMode int
+
+const (
+	ModeStandard CalculatorMode = iota
+	ModeScientific
+	ModeProgrammer
+	ModeDateTime
+)
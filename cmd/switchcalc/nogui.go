@@ -0,0 +1,19 @@
+//go:build nogui
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// main of a build without the desktop interface, for machines without
+// GTK: go build -tags nogui ./cmd/switchcalc. Only the commands run.
+func main() {
+	if code, ok := runCommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+	fmt.Fprintln(os.Stderr, "switchcalc: built without the calculator window")
+	printCommands(os.Stderr)
+	os.Exit(exitUsage)
+}
@@ -0,0 +1,782 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	"switchcalc/pkg/calculator"
+)
+
+// repl is an interactive terminal session over the engine and the date
+// calculator. It shares the config, history and saved state with the
+// calculator window.
+type repl struct {
+	engine    *calculator.Engine
+	dates     *calculator.DateTimeCalc
+	config    calculator.Config
+	statePath string
+	out       io.Writer
+
+	mode  CalculatorMode
+	shift uint
+	// prevMode is the mode programmer mode was entered from, which
+	// :undo goes back to.
+	prevMode CalculatorMode
+}
+
+// modeNames are the names of the calculator modes in :mode.
+var modeNames = map[CalculatorMode]string{
+	ModeStandard:   "standard",
+	ModeScientific: "scientific",
+	ModeProgrammer: "programmer",
+	ModeDateTime:   "date",
+}
+
+// lineReader reads the lines typed into the session.
+type lineReader interface {
+	ReadLine() (string, error)
+}
+
+// scanReader reads lines from input that is not a terminal, such as a
+// pipe, without editing or a prompt.
+type scanReader struct {
+	scanner *bufio.Scanner
+}
+
+func (s scanReader) ReadLine() (string, error) {
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return s.scanner.Text(), nil
+}
+
+// runREPL reads lines from the terminal until :quit or end of input. On a
+// terminal the lines can be edited and earlier lines recalled with the
+// arrow keys, and Tab completes names.
+func runREPL(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("repl", "[flags]", stderr)
+	fresh := fs.Bool("fresh", false, "start without the saved variables, memory and modes, and do not save them")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	r := &repl{
+		engine: calculator.NewEngine(),
+		dates:  calculator.NewDateTimeCalc(),
+		out:    stdout,
+		mode:   ModeScientific,
+		shift:  1,
+	}
+	log.SetOutput(stderr)
+	log.SetFlags(0)
+	log.SetPrefix("switchcalc: ")
+	r.loadConfig()
+	if !*fresh {
+		r.loadState()
+	}
+
+	var lines lineReader
+	restore := func() {}
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			fmt.Fprintln(stderr, "switchcalc:", err)
+			return 1
+		}
+		restore = func() { term.Restore(fd, oldState) }
+		t := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, stdout}, r.prompt())
+		t.AutoCompleteCallback = r.complete
+		if width, height, err := term.GetSize(fd); err == nil {
+			t.SetSize(width, height)
+		}
+		r.out = t
+		lines = &promptReader{t, r}
+		fmt.Fprintln(r.out, "SwitchCalc — type :help for commands, :quit to leave")
+	} else {
+		lines = scanReader{bufio.NewScanner(os.Stdin)}
+	}
+
+	for {
+		line, err := lines.ReadLine()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(r.out, "switchcalc:", err)
+			}
+			break
+		}
+		if quit := r.handle(strings.TrimSpace(line)); quit {
+			break
+		}
+	}
+	restore()
+	if !*fresh {
+		r.saveState()
+	}
+	return 0
+}
+
+// promptReader reads from the terminal with the prompt of the current
+// mode.
+type promptReader struct {
+	t *term.Terminal
+	r *repl
+}
+
+func (p *promptReader) ReadLine() (string, error) {
+	p.t.SetPrompt(p.r.prompt())
+	return p.t.ReadLine()
+}
+
+// loadConfig reads the config with the user functions and locale, and
+// the history saved by the calculator window, like App.loadConfig.
+func (r *repl) loadConfig() {
+	cfg, err := calculator.LoadConfig()
+	if err != nil {
+		log.Printf("loading config: %v", err)
+	}
+	r.config = cfg
+	r.engine.SetLocale(cfg.NumberLocale())
+	if err := r.engine.DefineFunctions(cfg.Functions); err != nil {
+		log.Printf("loading functions: %v", err)
+	}
+	r.engine.ClearUndo()
+	path, err := calculator.DefaultHistoryPath()
+	if err != nil {
+		log.Printf("locating history: %v", err)
+		return
+	}
+	store := calculator.NewHistoryStore(path, cfg.HistoryLimit, historyMaxAge(cfg))
+	if err := r.engine.SetHistoryStore(store); err != nil {
+		log.Printf("loading history: %v", err)
+	}
+}
+
+func (r *repl) loadState() {
+	path, err := calculator.DefaultStatePath()
+	if err != nil {
+		log.Printf("locating state: %v", err)
+		return
+	}
+	r.statePath = path
+	if err := r.engine.LoadState(path); err != nil {
+		log.Printf("loading state: %v", err)
+	}
+}
+
+func (r *repl) saveState() {
+	if r.statePath == "" {
+		return
+	}
+	if err := r.engine.SaveState(r.statePath); err != nil {
+		log.Printf("saving state: %v", err)
+	}
+}
+
+func (r *repl) prompt() string {
+	switch r.mode {
+	case ModeProgrammer:
+		sign := ""
+		if !r.engine.Signed {
+			sign = "u"
+		}
+		return fmt.Sprintf("prog %s/%s%d> ", r.engine.NumberBase, sign, r.engine.BitWidth)
+	case ModeDateTime:
+		return "date> "
+	case ModeStandard:
+		return "std> "
+	}
+	return fmt.Sprintf("sci %s> ", r.engine.AngleMode)
+}
+
+// handle runs one line: a :command, a date calculation in date mode, or
+// else an expression, assignment or function definition. It reports
+// whether the session should end.
+func (r *repl) handle(line string) bool {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return false
+	}
+	if name, ok := strings.CutPrefix(line, ":"); ok {
+		fields := strings.Fields(name)
+		if len(fields) == 0 {
+			return false
+		}
+		cmd, ok := replCommands[fields[0]]
+		if !ok {
+			fmt.Fprintf(r.out, "unknown command :%s, try :help\n", fields[0])
+			return false
+		}
+		if cmd.run == nil {
+			return true
+		}
+		if err := cmd.run(r, fields[1:]); err != nil {
+			fmt.Fprintln(r.out, "error:", err)
+		}
+		return false
+	}
+	if r.mode == ModeDateTime {
+		if err := r.date(strings.Fields(line)); err != nil {
+			fmt.Fprintln(r.out, "error:", err)
+		}
+		return false
+	}
+	r.calculate(line)
+	return false
+}
+
+// calculate evaluates a typed line. After a two-value key such as
+// ":press and", the line gives the second value. Bare numbers are read in
+// the base of :base, so that after ":base hex" FFFF+1 is 0x10000.
+func (r *repl) calculate(line string) {
+	pending := r.engine.PendingOp != calculator.OpNone
+	result, err := r.engine.Execute(readBareNumbers(line, r.engine))
+	if err == nil && pending {
+		if r.engine.PendingOp >= 100 {
+			r.engine.CalculateBitwise()
+		} else {
+			r.engine.Calculate()
+		}
+		result, err = r.engine.CurrentValue, r.engine.Err
+	}
+	switch {
+	case err != nil:
+		fmt.Fprintln(r.out, "error:", err)
+		r.engine.ClearEntry()
+	case result == nil:
+		// A function definition, saved like one made in the window
+		r.config.Functions = r.engine.FunctionDefinitions()
+		if err := calculator.SaveConfig(r.config); err != nil {
+			fmt.Fprintln(r.out, "error: saving config:", err)
+		}
+	default:
+		r.printValue()
+	}
+}
+
+// printValue shows the current value, and in programmer mode the value
+// in every base within the word and the status flags.
+func (r *repl) printValue() {
+	fmt.Fprintln(r.out, "=", r.engine.Display)
+	if r.mode != ModeProgrammer {
+		return
+	}
+	b := newBaseValues(r.engine)
+	fmt.Fprintf(r.out, "  HEX %s\n  DEC %s\n  OCT %s\n  BIN %s\n  FLAGS %s\n", b.Hex, b.Dec, b.Oct, b.Bin, r.engine.Flags)
+}
+
+// replCommand is a :command of the session.
+type replCommand struct {
+	usage string
+	help  string
+	// run carries out the command with its arguments; nil quits.
+	run func(r *repl, args []string) error
+}
+
+var replCommands map[string]replCommand
+
+func init() {
+	replCommands = map[string]replCommand{
+		"mode":      {"standard|scientific|programmer|date", "Switch calculator mode", (*repl).setMode},
+		"base":      {"dec|hex|oct|bin", "Base results are shown in", (*repl).setBase},
+		"width":     {"BITS", "Word size in programmer mode, from 1 to 1024 bits", (*repl).setWidth},
+		"signed":    {"on|off", "Show the word as a signed or unsigned integer", (*repl).setSigned},
+		"saturate":  {"on|off", "Saturate instead of wrapping results that do not fit the word", (*repl).setSaturate},
+		"float":     {"[NUMBER|0xBITS]", "Show a number as IEEE 754 floats, or read bits back as one; the word by default", (*repl).float},
+		"shift":     {"N", "Bits the shift and rotate keys move by", (*repl).setShift},
+		"angle":     {"deg|rad|grad", "Angle mode", (*repl).setAngle},
+		"precision": {"N", "Significant digits of decimal arithmetic", (*repl).setPrecision},
+		"press":     {"KEY", "Press a key on the current value, such as sqrt, rol or and", (*repl).press},
+		"history":   {"[N]", "Show the last N calculations, shared with the window", (*repl).history},
+		"memory":    {"[store|recall|add|sub|clear]", "Show or change the memory", (*repl).memory},
+		"vars":      {"", "Show the variables and user functions", (*repl).vars},
+		"date":      {"diff|add|sub|age|workdays|weekday|ts ...", "Date calculation, as typed in date mode", (*repl).date},
+		"keys":      {"", "List the keys for :press", (*repl).keys},
+		"undo":      {"", "Undo the last change", (*repl).undo},
+		"help":      {"", "Show the commands", (*repl).help},
+		"quit":      {"", "Leave, saving variables and modes", nil},
+	}
+	replCommands["q"] = replCommands["quit"]
+}
+
+// oneArg returns the single argument of a command that takes one.
+func oneArg(args []string, usage string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("expected %s", usage)
+	}
+	return args[0], nil
+}
+
+func (r *repl) setMode(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(r.out, modeNames[r.mode])
+		return nil
+	}
+	name, err := oneArg(args, replCommands["mode"].usage)
+	if err != nil {
+		return err
+	}
+	// A prefix such as "s" that starts more than one name is an error
+	// rather than whichever comes first.
+	var matches []CalculatorMode
+	for mode := ModeStandard; mode <= ModeDateTime; mode++ {
+		if strings.HasPrefix(modeNames[mode], strings.ToLower(name)) {
+			matches = append(matches, mode)
+		}
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("unknown mode %q", name)
+	}
+	if len(matches) > 1 {
+		names := make([]string, len(matches))
+		for i, mode := range matches {
+			names[i] = modeNames[mode]
+		}
+		return fmt.Errorf("ambiguous mode %q: %s", name, strings.Join(names, ", "))
+	}
+	mode := matches[0]
+	if mode == ModeProgrammer && r.mode != ModeProgrammer {
+		r.prevMode = r.mode
+	}
+	r.mode = mode
+	r.engine.SetProgrammer(mode == ModeProgrammer)
+	// Like the window, programmer mode starts in decimal
+	if mode == ModeProgrammer {
+		r.engine.SetNumberBase(calculator.Decimal)
+	}
+	return nil
+}
+
+func (r *repl) setBase(args []string) error {
+	name, err := oneArg(args, replCommands["base"].usage)
+	if err != nil {
+		return err
+	}
+	base, err := calculator.ParseNumberBase(name)
+	if err != nil {
+		return err
+	}
+	r.engine.SetNumberBase(base)
+	r.printValue()
+	return nil
+}
+
+func (r *repl) setWidth(args []string) error {
+	text, err := oneArg(args, replCommands["width"].usage)
+	if err != nil {
+		return err
+	}
+	width, err := calculator.ParseBitWidth(text)
+	if err != nil {
+		return err
+	}
+	r.engine.SetBitWidth(width)
+	r.printValue()
+	return nil
+}
+
+func (r *repl) setSigned(args []string) error {
+	text, err := oneArg(args, replCommands["signed"].usage)
+	if err != nil {
+		return err
+	}
+	on, err := onOff(text, replCommands["signed"].usage)
+	if err != nil {
+		return err
+	}
+	r.engine.SetSigned(on)
+	r.printValue()
+	return nil
+}
+
+func (r *repl) setSaturate(args []string) error {
+	text, err := oneArg(args, replCommands["saturate"].usage)
+	if err != nil {
+		return err
+	}
+	on, err := onOff(text, replCommands["saturate"].usage)
+	if err != nil {
+		return err
+	}
+	r.engine.SetSaturate(on)
+	return nil
+}
+
+// onOff reads an on or off argument.
+func onOff(text, usage string) (bool, error) {
+	switch strings.ToLower(text) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected %s", usage)
+}
+
+// float shows a decimal number as the bit patterns of the IEEE 754
+// formats, field by field, or reads a hex pattern back as a float.
+func (r *repl) float(args []string) error {
+	text := r.engine.FloatPattern()
+	if len(args) > 0 {
+		text = strings.Join(args, "")
+	}
+	all, err := calculator.InspectFloat(text)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(r.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  FORMAT\tBITS\tSIGN\tEXPONENT\tMANTISSA\tVALUE")
+	for _, b := range all {
+		fmt.Fprintf(w, "  %s\t%s\t%d\t%s\t%s\t%s\n", b.Format, b.Hex(), b.Sign(), floatExponent(b), floatMantissa(b), b.ValueString())
+	}
+	return w.Flush()
+}
+
+// floatExponent writes the exponent field as stored, and the power of two
+// it stands for. The all-ones field of infinities and NaNs stands for
+// none, so it is labeled special.
+func floatExponent(b calculator.FloatBits) string {
+	if c := b.Class(); c == calculator.FloatInfinite || c == calculator.FloatNaN {
+		return fmt.Sprintf("%d (special)", b.BiasedExponent())
+	}
+	return fmt.Sprintf("%d (%+d)", b.BiasedExponent(), b.Exponent())
+}
+
+// floatMantissa writes the mantissa field in hex.
+func floatMantissa(b calculator.FloatBits) string {
+	return fmt.Sprintf("0x%0*X", (b.Format.MantissaBits()+3)/4, b.Mantissa())
+}
+
+func (r *repl) setShift(args []string) error {
+	text, err := oneArg(args, replCommands["shift"].usage)
+	if err != nil {
+		return err
+	}
+	n := atoi(text)
+	if n < 1 || n >= int(calculator.MaxBitWidth) {
+		return fmt.Errorf("shift must be from 1 to %d", calculator.MaxBitWidth-1)
+	}
+	r.shift = uint(n)
+	return nil
+}
+
+func (r *repl) setAngle(args []string) error {
+	name, err := oneArg(args, replCommands["angle"].usage)
+	if err != nil {
+		return err
+	}
+	mode, err := calculator.ParseAngleMode(name)
+	if err != nil {
+		return err
+	}
+	r.engine.SetAngleMode(mode)
+	return nil
+}
+
+func (r *repl) setPrecision(args []string) error {
+	text, err := oneArg(args, replCommands["precision"].usage)
+	if err != nil {
+		return err
+	}
+	n := atoi(text)
+	if n < 1 {
+		return fmt.Errorf("precision must be at least 1")
+	}
+	r.engine.SetPrecision(n)
+	return nil
+}
+
+// atoi reads a number argument, giving -1 for one that is not a number.
+func atoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// press is a key of the operation registry. A two-value key such as
+// "and" or "^" waits for the next line to give the second value.
+func (r *repl) press(args []string) error {
+	name, err := oneArg(args, replCommands["press"].usage)
+	if err != nil {
+		return err
+	}
+	op, ok := calculator.LookupOp(name)
+	if !ok {
+		return fmt.Errorf("unknown key %q", name)
+	}
+	if err := r.engine.Press(op.Name, calculator.KeySettings{Shift: r.shift}); err != nil {
+		r.engine.ClearEntry()
+		return err
+	}
+	if op.Arity == 2 {
+		fmt.Fprintf(r.out, "%s %s …\n", r.engine.Display, op.Symbol)
+		return nil
+	}
+	r.printValue()
+	return nil
+}
+
+func (r *repl) history(args []string) error {
+	n := 20
+	if len(args) > 0 {
+		if n = atoi(args[0]); n < 1 {
+			return fmt.Errorf("expected a number of entries")
+		}
+	}
+	entries := r.engine.History
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	for _, entry := range entries {
+		result := "= " + entry.Result
+		if entry.Failed() {
+			result = "error: " + entry.Error
+		}
+		fmt.Fprintf(r.out, "%s  %s  %s\n", entry.Time.Format("2006-01-02 15:04"), r.engine.FormatExpression(entry.Expression), result)
+	}
+	return nil
+}
+
+func (r *repl) memory(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "store", "ms":
+			r.engine.MemoryStore()
+		case "recall", "mr":
+			r.engine.MemoryRecall()
+			r.printValue()
+			return nil
+		case "add", "m+":
+			r.engine.MemoryAdd()
+		case "sub", "m-":
+			r.engine.MemorySubtract()
+		case "clear", "mc":
+			r.engine.MemoryClear()
+		default:
+			return fmt.Errorf("expected %s", replCommands["memory"].usage)
+		}
+	}
+	memory := r.engine.Memory
+	if memory == nil {
+		memory = r.engine.Zero()
+	}
+	fmt.Fprintln(r.out, "M =", r.engine.Format(memory))
+	return nil
+}
+
+func (r *repl) vars(args []string) error {
+	fmt.Fprintln(r.out, "ans =", r.engine.Format(r.engine.Ans()))
+	for _, name := range r.engine.VariableNames() {
+		val, _ := r.engine.Variable(name)
+		fmt.Fprintf(r.out, "%s = %s\n", name, r.engine.Format(val))
+	}
+	for _, def := range r.engine.FunctionDefinitions() {
+		fmt.Fprintln(r.out, def)
+	}
+	return nil
+}
+
+func (r *repl) undo(args []string) error {
+	if !r.engine.Undo() {
+		return fmt.Errorf("nothing to undo")
+	}
+	// Undo can turn programmer mode on or off
+	if on := r.engine.Programmer; on && r.mode != ModeProgrammer {
+		r.prevMode, r.mode = r.mode, ModeProgrammer
+	} else if !on && r.mode == ModeProgrammer {
+		r.mode = r.prevMode
+	}
+	r.printValue()
+	return nil
+}
+
+func (r *repl) help(args []string) error {
+	names := make([]string, 0, len(replCommands))
+	for name := range replCommands {
+		if name != "q" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	fmt.Fprintln(r.out, "Type an expression such as 2^10 + sin(30), an assignment such as r = 2,")
+	fmt.Fprintln(r.out, "or a definition such as f(x) = x^2. Commands:")
+	w := tabwriter.NewWriter(r.out, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		cmd := replCommands[name]
+		fmt.Fprintf(w, "  :%s %s\t%s\n", name, cmd.usage, cmd.help)
+	}
+	return w.Flush()
+}
+
+// keys lists the operations of the registry by the name :press takes.
+func (r *repl) keys(args []string) error {
+	w := tabwriter.NewWriter(r.out, 0, 0, 2, ' ', 0)
+	for _, op := range calculator.Ops() {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", op.Name, op.Symbol, op.Help)
+	}
+	return w.Flush()
+}
+
+// date is a calculation of the date calculator: the difference between
+// two dates, a date plus or minus a span such as "1y 2m 3d", an age, the
+// working days between two dates, the day of a date, or a Unix timestamp.
+func (r *repl) date(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected %s", replCommands["date"].usage)
+	}
+	dates := func(n int) ([]time.Time, error) {
+		if len(args)-1 < n {
+			return nil, fmt.Errorf("%s needs %d date(s)", args[0], n)
+		}
+		var ts []time.Time
+		for _, arg := range args[1 : n+1] {
+			t, err := calculator.ParseDate(arg)
+			if err != nil {
+				return nil, err
+			}
+			ts = append(ts, t)
+		}
+		return ts, nil
+	}
+	d := r.dates
+	switch args[0] {
+	case "diff":
+		ts, err := dates(2)
+		if err != nil {
+			return err
+		}
+		d.StartDate, d.EndDate = ts[0], ts[1]
+		diff := d.CalculateDifference()
+		fmt.Fprintf(r.out, "= %s (%d days, %d weeks)\n", calculator.FormatDifference(diff), diff.TotalDays, diff.TotalWeeks)
+	case "add", "sub":
+		ts, err := dates(1)
+		if err != nil {
+			return err
+		}
+		years, months, days := calculator.ParseTimeDelta(strings.Join(args[2:], " "))
+		if args[0] == "sub" {
+			years, months, days = -years, -months, -days
+		}
+		result := ts[0].AddDate(years, months, days)
+		fmt.Fprintf(r.out, "= %s (%s)\n", result.Format("2006-01-02"), result.Format("Monday"))
+	case "age":
+		ts, err := dates(1)
+		if err != nil {
+			return err
+		}
+		years, months, days := d.GetAge(ts[0])
+		fmt.Fprintf(r.out, "= %d years, %d months, %d days\n", years, months, days)
+	case "workdays":
+		ts, err := dates(2)
+		if err != nil {
+			return err
+		}
+		d.StartDate, d.EndDate = ts[0], ts[1]
+		fmt.Fprintf(r.out, "= %d working days (%d days)\n", d.GetWorkingDays(true), d.GetWorkingDays(false))
+	case "weekday":
+		ts, err := dates(1)
+		if err != nil {
+			return err
+		}
+		d.StartDate = ts[0]
+		leap := ""
+		if d.IsLeapYear() {
+			leap = ", leap year"
+		}
+		fmt.Fprintf(r.out, "= %s, week %d, day %d%s\n", ts[0].Format("Monday"), d.GetWeekNumber(), d.GetDayOfYear(), leap)
+	case "ts":
+		if len(args) == 2 {
+			if n, err := strconv.ParseInt(args[1], 10, 64); err == nil {
+				fmt.Fprintln(r.out, "=", d.FromUnixTimestamp(n).Format("2006-01-02 15:04:05 MST"))
+				return nil
+			}
+		}
+		ts, err := dates(1)
+		if err != nil {
+			return err
+		}
+		d.StartDate = ts[0]
+		fmt.Fprintln(r.out, "=", d.UnixTimestamp())
+	default:
+		return fmt.Errorf("unknown date calculation %q, expected %s", args[0], replCommands["date"].usage)
+	}
+	return nil
+}
+
+// complete is the Tab key: it completes the name before the cursor to a
+// command, key, function, constant or variable, or to as much of it as
+// the matches share.
+func (r *repl) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	start := pos
+	for start > 0 && isNameByte(line[start-1]) {
+		start--
+	}
+	prefix := line[start:pos]
+	var candidates []string
+	if start == 1 && line[0] == ':' {
+		for name := range replCommands {
+			candidates = append(candidates, name)
+		}
+	} else if strings.HasPrefix(line, ":press ") {
+		for _, op := range calculator.Ops() {
+			candidates = append(candidates, op.Name)
+		}
+	} else {
+		for _, op := range calculator.Ops() {
+			if op.IsFunction() || op.IsConstant() {
+				candidates = append(candidates, op.Name)
+			}
+		}
+		candidates = append(candidates, r.engine.FunctionNames()...)
+		candidates = append(candidates, r.engine.VariableNames()...)
+	}
+	var matches []string
+	for _, c := range candidates {
+		if prefix != "" && strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	completion := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	return line[:start] + completion + line[pos:], start + len(completion), true
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+
+	"switchcalc/pkg/calculator"
+)
+
+// The search provider has its own bus name, so that it can run while the
+// calculator window holds the application ID. GNOME Shell finds it through
+// com.switchcalc.app.search-provider.ini.
+const (
+	appID               = "com.switchcalc.app"
+	appPath             = dbus.ObjectPath("/com/switchcalc/app")
+	searchProviderName  = appID + ".SearchProvider"
+	searchProviderPath  = appPath + "/SearchProvider"
+	searchProviderIface = "org.gnome.Shell.SearchProvider2"
+)
+
+// searchQuery is a calculation typed in the desktop search: an expression
+// such as "=12*7", or a conversion such as "0xFF in dec".
+type searchQuery struct {
+	expr string
+	base calculator.NumberBase
+}
+
+// ambiguousSearches match searches that read as a date or a phone number
+// as well as arithmetic.
+var ambiguousSearches = []*regexp.Regexp{
+	// 2024-10-16, 16/10/2024, 16.10.2024 and 555-123-4567
+	regexp.MustCompile(`^\d+(-\d+){2,}$|^\d+(/\d+){2,}$|^\d+(\.\d+){2,}$`),
+	// +44 20 7946 0958
+	regexp.MustCompile(`^\+[\d\s()-]+$`),
+	// (555) 123-4567 and 555 1234, numbers side by side
+	regexp.MustCompile(`^[\d\s()-]*\d\)?\s+\(?\d[\d\s()-]*$`),
+}
+
+// parseSearchQuery reads the text of a search. Without a leading = the
+// text must look like arithmetic, a number and an operator, so that other
+// searches do not show a calculator result. Text that also reads as a
+// date or a phone number, such as 2024-10-16 or 555-123-4567, needs the =
+// or a conversion such as "in hex".
+func parseSearchQuery(text string) (searchQuery, bool) {
+	text = strings.TrimSpace(text)
+	explicit := strings.HasPrefix(text, "=")
+	text = strings.TrimSpace(strings.TrimPrefix(text, "="))
+	q := searchQuery{expr: text}
+	fields := strings.Fields(text)
+	if n := len(fields); n >= 3 && (fields[n-2] == "in" || fields[n-2] == "to") {
+		if base, err := calculator.ParseNumberBase(fields[n-1]); err == nil {
+			return searchQuery{strings.Join(fields[:n-2], " "), base}, true
+		}
+	}
+	if text == "" {
+		return q, false
+	}
+	if explicit {
+		return q, true
+	}
+	for _, re := range ambiguousSearches {
+		if re.MatchString(text) {
+			return q, false
+		}
+	}
+	return q, strings.ContainsAny(text, "0123456789") && strings.ContainsAny(text, "+-*/^%!×÷()")
+}
+
+// searchProvider answers the org.gnome.Shell.SearchProvider2 calls of the
+// desktop search. The result ID is the text of the search, which the
+// calculator window reads again when a result is activated.
+type searchProvider struct {
+	conn *dbus.Conn
+
+	mu     sync.Mutex
+	engine *calculator.Engine
+	// idle stops the provider after a time without searches.
+	idle *time.Timer
+}
+
+// evaluate returns the result of the search text, as the calculator
+// shows it.
+func (p *searchProvider) evaluate(text string) (string, bool) {
+	q, ok := parseSearchQuery(text)
+	if !ok {
+		return "", false
+	}
+	node, err := calculator.Parse(q.expr)
+	if err != nil {
+		return "", false
+	}
+	switch node.(type) {
+	case *calculator.AssignNode, *calculator.DefineNode:
+		return "", false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.idle != nil {
+		p.idle.Reset(searchIdleTimeout)
+	}
+	result, err := p.engine.EvaluateNode(node)
+	if err != nil {
+		return "", false
+	}
+	p.engine.NumberBase = q.base
+	return p.engine.Format(result), true
+}
+
+// searchIdleTimeout is how long a provider started by the session bus
+// waits for another search before it exits.
+const searchIdleTimeout = 2 * time.Minute
+
+func (p *searchProvider) results(terms []string) []string {
+	text := strings.Join(terms, " ")
+	if _, ok := p.evaluate(text); !ok {
+		return []string{}
+	}
+	return []string{text}
+}
+
+func (p *searchProvider) GetInitialResultSet(terms []string) ([]string, *dbus.Error) {
+	return p.results(terms), nil
+}
+
+func (p *searchProvider) GetSubsearchResultSet(previous, terms []string) ([]string, *dbus.Error) {
+	return p.results(terms), nil
+}
+
+func (p *searchProvider) GetResultMetas(ids []string) ([]map[string]dbus.Variant, *dbus.Error) {
+	metas := []map[string]dbus.Variant{}
+	for _, id := range ids {
+		result, ok := p.evaluate(id)
+		if !ok {
+			continue
+		}
+		metas = append(metas, map[string]dbus.Variant{
+			"id":            dbus.MakeVariant(id),
+			"name":          dbus.MakeVariant("= " + result),
+			"description":   dbus.MakeVariant(strings.TrimSpace(strings.TrimPrefix(id, "="))),
+			"clipboardText": dbus.MakeVariant(result),
+		})
+	}
+	return metas, nil
+}
+
+func (p *searchProvider) ActivateResult(id string, terms []string, timestamp uint32) *dbus.Error {
+	if err := p.openApp(id); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (p *searchProvider) LaunchSearch(terms []string, timestamp uint32) *dbus.Error {
+	if err := p.openApp(strings.Join(terms, " ")); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// openApp opens the calculator window with the result of the search text
+// loaded, through the load-value action of the application. The session
+// bus starts the application if it is not running and is installed with
+// com.switchcalc.app.service. Otherwise switchcalc is started here.
+func (p *searchProvider) openApp(text string) error {
+	err := p.loadValue(text)
+	var derr dbus.Error
+	if !errors.As(err, &derr) || derr.Name != "org.freedesktop.DBus.Error.ServiceUnknown" {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := exec.Command(exe, "--gapplication-service").Start(); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		var running bool
+		if err := p.conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, appID).Store(&running); err != nil {
+			return err
+		}
+		if running {
+			return p.loadValue(text)
+		}
+	}
+	return fmt.Errorf("%s did not start", appID)
+}
+
+func (p *searchProvider) loadValue(text string) error {
+	return p.conn.Object(appID, appPath).Call("org.freedesktop.Application.ActivateAction", 0,
+		"load-value", []dbus.Variant{dbus.MakeVariant(text)}, map[string]dbus.Variant{}).Err
+}
+
+const searchProviderIntrospection = `<interface name="` + searchProviderIface + `">
+  <method name="GetInitialResultSet">
+    <arg type="as" name="terms" direction="in"/>
+    <arg type="as" name="results" direction="out"/>
+  </method>
+  <method name="GetSubsearchResultSet">
+    <arg type="as" name="previous_results" direction="in"/>
+    <arg type="as" name="terms" direction="in"/>
+    <arg type="as" name="results" direction="out"/>
+  </method>
+  <method name="GetResultMetas">
+    <arg type="as" name="identifiers" direction="in"/>
+    <arg type="aa{sv}" name="metas" direction="out"/>
+  </method>
+  <method name="ActivateResult">
+    <arg type="s" name="identifier" direction="in"/>
+    <arg type="as" name="terms" direction="in"/>
+    <arg type="u" name="timestamp" direction="in"/>
+  </method>
+  <method name="LaunchSearch">
+    <arg type="as" name="terms" direction="in"/>
+    <arg type="u" name="timestamp" direction="in"/>
+  </method>
+</interface>`
+
+// export puts the provider and its introspection data on the bus at
+// searchProviderPath.
+func (p *searchProvider) export() error {
+	if err := p.conn.Export(p, searchProviderPath, searchProviderIface); err != nil {
+		return err
+	}
+	introspection := "<node>" + introspect.IntrospectDataString + searchProviderIntrospection + "</node>"
+	return p.conn.Export(introspect.Introspectable(introspection), searchProviderPath, "org.freedesktop.DBus.Introspectable")
+}
+
+// runSearchProvider serves the desktop search on the session bus, as
+// DBUS_SESSION_BUS_ADDRESS names it, until it is stopped or, with -idle,
+// no search has come for a while.
+func runSearchProvider(args []string, stdout, stderr io.Writer) int {
+	var settings engineFlags
+	fs := newFlagSet("search-provider", "[flags]", stderr)
+	settings.register(fs)
+	idle := fs.Bool("idle", false, fmt.Sprintf("exit after %v without a search, as when started by the session bus", searchIdleTimeout))
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	e, err := settings.newEngine()
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return exitUsage
+	}
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return 1
+	}
+	defer conn.Close()
+
+	p := &searchProvider{conn: conn, engine: e}
+	done := make(chan struct{})
+	if *idle {
+		p.idle = time.AfterFunc(searchIdleTimeout, func() { close(done) })
+	}
+	if err := p.export(); err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return 1
+	}
+
+	reply, err := conn.RequestName(searchProviderName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return 1
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		fmt.Fprintln(stderr, "switchcalc:", searchProviderName, "is already running")
+		return 1
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-sig:
+	case <-done:
+	case <-conn.Context().Done():
+	}
+	return 0
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"switchcalc/pkg/calculator"
+)
+
+// privateBus starts a dbus-daemon of its own for the test and returns its
+// address.
+func privateBus(t *testing.T) string {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	cmd := exec.Command(daemon, "--session", "--address=unix:dir="+t.TempDir(), "--nofork", "--nopidfile", "--print-address")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func ownName(t *testing.T, conn *dbus.Conn, name string) {
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("%s is taken", name)
+	}
+}
+
+// fakeApp stands in for the calculator window, noting the actions the
+// provider activates.
+type fakeApp struct {
+	actions chan []any
+}
+
+func (a *fakeApp) ActivateAction(name string, params []dbus.Variant, platformData map[string]dbus.Variant) *dbus.Error {
+	action := []any{name}
+	for _, p := range params {
+		action = append(action, p.Value())
+	}
+	a.actions <- action
+	return nil
+}
+
+func TestSearchProvider(t *testing.T) {
+	address := privateBus(t)
+
+	p := &searchProvider{conn: connect(t, address), engine: calculator.NewEngine()}
+	if err := p.export(); err != nil {
+		t.Fatal(err)
+	}
+	ownName(t, p.conn, searchProviderName)
+
+	app := &fakeApp{actions: make(chan []any, 1)}
+	appConn := connect(t, address)
+	if err := appConn.Export(app, appPath, "org.freedesktop.Application"); err != nil {
+		t.Fatal(err)
+	}
+	ownName(t, appConn, appID)
+
+	provider := connect(t, address).Object(searchProviderName, searchProviderPath)
+	call := func(method string, result any, args ...any) {
+		t.Helper()
+		c := provider.Call(searchProviderIface+"."+method, 0, args...)
+		if c.Err != nil {
+			t.Fatalf("%s: %v", method, c.Err)
+		}
+		if result != nil {
+			if err := c.Store(result); err != nil {
+				t.Fatalf("%s: %v", method, err)
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		terms []string
+		want  []string
+	}{
+		{[]string{"=12*7"}, []string{"=12*7"}},
+		{[]string{"2", "+", "2"}, []string{"2 + 2"}},
+		{[]string{"0xFF", "in", "dec"}, []string{"0xFF in dec"}},
+		{[]string{"weather"}, []string{}},
+		{[]string{"2024-10-16"}, []string{}},
+		{[]string{"555-123-4567"}, []string{}},
+		{[]string{"=2024-10-16"}, []string{"=2024-10-16"}},
+		{[]string{"=1/0"}, []string{}},
+	} {
+		var ids []string
+		call("GetInitialResultSet", &ids, tt.terms)
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("GetInitialResultSet(%q) = %q, want %q", tt.terms, ids, tt.want)
+		}
+	}
+
+	var metas []map[string]dbus.Variant
+	call("GetResultMetas", &metas, []string{"=12*7", "weather", "0xFF in dec"})
+	if len(metas) != 2 {
+		t.Fatalf("GetResultMetas gave %d results, want 2", len(metas))
+	}
+	for i, want := range []map[string]string{
+		{"id": "=12*7", "name": "= 84", "description": "12*7", "clipboardText": "84"},
+		{"id": "0xFF in dec", "name": "= 255", "description": "0xFF in dec", "clipboardText": "255"},
+	} {
+		for key, value := range want {
+			if got, _ := metas[i][key].Value().(string); got != value {
+				t.Errorf("GetResultMetas result %d: %s = %q, want %q", i, key, got, value)
+			}
+		}
+	}
+
+	call("ActivateResult", nil, "=12*7", []string{"=12*7"}, uint32(0))
+	select {
+	case action := <-app.actions:
+		if want := []any{"load-value", "=12*7"}; !reflect.DeepEqual(action, want) {
+			t.Errorf("ActivateResult activated %q, want %q", action, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("ActivateResult did not activate load-value")
+	}
+
+	var xml string
+	if err := provider.Call("org.freedesktop.DBus.Introspectable.Introspect", 0).Store(&xml); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(xml, searchProviderIface) {
+		t.Errorf("introspection data does not describe %s", searchProviderIface)
+	}
+}
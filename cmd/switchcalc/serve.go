@@ -0,0 +1,649 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"switchcalc/pkg/calculator"
+)
+
+// runServe answers JSON-RPC 2.0 requests on a Unix socket, so that other
+// programs on the machine can use the calculator. Requests and responses
+// are JSON values, one per line. Each connection is a session with its
+// own engine, so variables, ans and settings set by one client are not
+// seen by another.
+func runServe(args []string, stdout, stderr io.Writer) int {
+	var settings engineFlags
+	fs := newFlagSet("serve", "-socket PATH [flags]", stderr)
+	settings.register(fs)
+	socket := fs.String("socket", "", "path of the Unix socket to listen on")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+	if *socket == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	// Check the settings before listening, rather than on each connection.
+	if _, err := settings.newEngine(); err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return exitUsage
+	}
+
+	ln, err := listenUnix(*socket)
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	fmt.Fprintln(stdout, "switchcalc: listening on", *socket)
+
+	var wg sync.WaitGroup
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			fmt.Fprintln(stderr, "switchcalc:", err)
+			return 1
+		}
+		e, err := settings.newEngine()
+		if err != nil {
+			fmt.Fprintln(stderr, "switchcalc:", err)
+			conn.Close()
+			continue
+		}
+		s := &session{engine: e, dates: calculator.NewDateTimeCalc()}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			s.serve(conn)
+		}()
+	}
+	wg.Wait()
+	return 0
+}
+
+// listenUnix listens on the socket at path, replacing a socket left
+// behind by a server that has gone, and lets only the user connect.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	// rpcCalculationError is a request the calculator could not carry
+	// out, such as a division by zero or an unknown name.
+	rpcCalculationError = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func invalidParams(format string, args ...any) error {
+	return &rpcError{rpcInvalidParams, fmt.Sprintf(format, args...)}
+}
+
+// session is the state of one connection.
+type session struct {
+	engine *calculator.Engine
+	dates  *calculator.DateTimeCalc
+}
+
+// serve answers the requests on conn until the client closes it or sends
+// something that is not JSON. A batch, a JSON array of requests, is
+// answered with an array of responses.
+func (s *session) serve(conn io.ReadWriter) {
+	dec := json.NewDecoder(conn)
+	out := bufio.NewWriter(conn)
+	enc := json.NewEncoder(out)
+	for {
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				enc.Encode(rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcParseError, err.Error()}})
+				out.Flush()
+			}
+			return
+		}
+		var response any
+		if strings.HasPrefix(strings.TrimSpace(string(msg)), "[") {
+			response = s.batch(msg)
+		} else if r := s.handle(msg); r != nil {
+			response = r
+		}
+		if response == nil {
+			continue
+		}
+		if err := enc.Encode(response); err != nil {
+			return
+		}
+		if err := out.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// batch answers each request of a batch. It returns nil if they are all
+// notifications.
+func (s *session) batch(msg json.RawMessage) any {
+	var msgs []json.RawMessage
+	if err := json.Unmarshal(msg, &msgs); err != nil || len(msgs) == 0 {
+		return rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcInvalidRequest, "invalid batch"}}
+	}
+	var responses []*rpcResponse
+	for _, m := range msgs {
+		if r := s.handle(m); r != nil {
+			responses = append(responses, r)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+// handle carries out one request and returns its response, or nil for a
+// notification, a request without an id.
+func (s *session) handle(msg json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(msg, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return &rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcInvalidRequest, "invalid request"}}
+	}
+	result, err := s.call(req.Method, req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	r := &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+	if err != nil {
+		var rerr *rpcError
+		if !errors.As(err, &rerr) {
+			rerr = &rpcError{rpcCalculationError, err.Error()}
+		}
+		r.Result, r.Error = nil, rerr
+	}
+	return r
+}
+
+// rpcMethod carries out a method with the parameters decoded into a new
+// value of its params type.
+type rpcMethod struct {
+	params func() any
+	run    func(s *session, params any) (any, error)
+}
+
+// method adapts a method taking parameters of type P.
+func method[P any](run func(s *session, p *P) (any, error)) rpcMethod {
+	return rpcMethod{
+		params: func() any { return new(P) },
+		run:    func(s *session, p any) (any, error) { return run(s, p.(*P)) },
+	}
+}
+
+var rpcMethods = map[string]rpcMethod{
+	"eval":          method((*session).eval),
+	"settings":      method((*session).settings),
+	"programmer":    method((*session).programmer),
+	"convert":       method((*session).convert),
+	"date.diff":     method((*session).dateDiff),
+	"date.add":      method((*session).dateAdd),
+	"date.subtract": method((*session).dateSubtract),
+	"date.workdays": method((*session).workdays),
+	"date.age":      method((*session).age),
+}
+
+func (s *session) call(name string, raw json.RawMessage) (any, error) {
+	m, ok := rpcMethods[name]
+	if !ok {
+		return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method %q", name)}
+	}
+	params := m.params()
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, params); err != nil {
+			return nil, invalidParams("invalid params: %v", err)
+		}
+	}
+	return m.run(s, params)
+}
+
+// operand is a number parameter, which may be a JSON number or a string
+// holding an expression such as "0xFF" or "2^10".
+type operand string
+
+func (o *operand) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, (*string)(o))
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return errors.New("expected a number or an expression")
+	}
+	*o = operand(n)
+	return nil
+}
+
+// value evaluates o, the parameter called name, without changing ans or
+// the history of the session.
+func (s *session) value(name string, o *operand) (calculator.Number, error) {
+	if o == nil {
+		return nil, invalidParams("missing %s", name)
+	}
+	return s.engine.Evaluate(string(*o))
+}
+
+type evalParams struct {
+	Expression string `json:"expression"`
+}
+
+type evalResult struct {
+	// Result is the value as the calculator shows it, absent for a
+	// function definition.
+	Result string `json:"result,omitempty"`
+}
+
+// eval evaluates an expression, assignment or function definition.
+func (s *session) eval(p *evalParams) (any, error) {
+	if strings.TrimSpace(p.Expression) == "" {
+		return nil, invalidParams("missing expression")
+	}
+	result, err := s.engine.Execute(p.Expression)
+	if err != nil {
+		s.engine.ClearEntry()
+		return nil, err
+	}
+	if result == nil {
+		return evalResult{}, nil
+	}
+	return evalResult{Result: s.engine.Format(result)}, nil
+}
+
+type settingsParams struct {
+	Angle     string `json:"angle"`
+	Base      string `json:"base"`
+	Precision int    `json:"precision"`
+	Format    string `json:"format"`
+	Digits    *int   `json:"digits"`
+}
+
+// settings changes the settings given and returns all of them.
+func (s *session) settings(p *settingsParams) (any, error) {
+	e := s.engine
+	if p.Angle != "" {
+		angle, err := calculator.ParseAngleMode(p.Angle)
+		if err != nil {
+			return nil, invalidParams("%v", err)
+		}
+		e.SetAngleMode(angle)
+	}
+	if p.Base != "" {
+		base, err := calculator.ParseNumberBase(p.Base)
+		if err != nil {
+			return nil, invalidParams("%v", err)
+		}
+		e.SetNumberBase(base)
+	}
+	if p.Precision < 0 {
+		return nil, invalidParams("precision must be at least 1, got %d", p.Precision)
+	} else if p.Precision > 0 {
+		e.SetPrecision(p.Precision)
+	}
+	if p.Format != "" || p.Digits != nil {
+		format, digits := e.DisplayFormat, e.DisplayDigits
+		if p.Format != "" {
+			var err error
+			if format, err = calculator.ParseDisplayFormat(p.Format); err != nil {
+				return nil, invalidParams("%v", err)
+			}
+		}
+		if p.Digits != nil {
+			digits = *p.Digits
+		}
+		e.SetDisplayFormat(format, digits)
+	}
+	digits := e.DisplayDigits
+	return settingsParams{
+		Angle:     e.AngleMode.String(),
+		Base:      e.NumberBase.String(),
+		Precision: e.Precision,
+		Format:    strings.ToLower(e.DisplayFormat.String()),
+		Digits:    &digits,
+	}, nil
+}
+
+type programmerParams struct {
+	Op       string   `json:"op"`
+	X        *operand `json:"x"`
+	Y        *operand `json:"y"`
+	Width    int      `json:"width"`
+	Signed   *bool    `json:"signed"`
+	Saturate bool     `json:"saturate"`
+	Shift    uint     `json:"shift"`
+}
+
+type programmerResult struct {
+	Result string `json:"result"`
+	baseValues
+	Flags flagValues `json:"flags"`
+}
+
+// flagValues are the status flags of a programmer result.
+type flagValues struct {
+	Carry    bool `json:"carry"`
+	Overflow bool `json:"overflow"`
+	Zero     bool `json:"zero"`
+	Negative bool `json:"negative"`
+}
+
+// programmerArithmetic are the arithmetic keys of the programmer keypad,
+// which are operators of expressions rather than operations of the
+// registry, by the names the programmer method takes them by.
+var programmerArithmetic = map[string]calculator.Operation{
+	"add": calculator.OpAdd,
+	"sub": calculator.OpSubtract,
+	"mul": calculator.OpMultiply,
+}
+
+// shiftKeys are the programmer keys that move x by the shift amount.
+var shiftKeys = map[string]bool{"shl": true, "shr": true, "rol": true, "ror": true}
+
+// programmer presses a key of the programmer keypad, such as "add",
+// "and", "rol" or "popcount", on x, and for the operators y, in a word of
+// width bits, signed unless signed is false, and saturating arithmetic
+// and left shifts if saturate is true. The shift and rotate keys move x
+// by shift bits, from 1 to one less than the width, as in the window. The
+// result has the status flags the key set. It becomes ans and is
+// recorded in the history, as a key pressed in the window is, but the
+// operands are not.
+func (s *session) programmer(p *programmerParams) (_ any, err error) {
+	name, arity := strings.ToLower(p.Op), 2
+	arith, isArith := programmerArithmetic[name]
+	if !isArith {
+		op, ok := calculator.LookupOp(p.Op)
+		if !ok || op.Keypads&calculator.ProgrammerKeypad == 0 {
+			return nil, invalidParams("unknown programmer operation %q", p.Op)
+		}
+		name, arity = op.Name, op.Arity
+	}
+	switch {
+	case arity == 2 && p.Y == nil:
+		return nil, invalidParams("%s needs y", name)
+	case arity != 2 && p.Y != nil:
+		return nil, invalidParams("%s takes only x", name)
+	}
+	e := s.engine
+	// A failed call leaves no operator pending for the next one
+	defer func() {
+		if err != nil {
+			e.Clear()
+		}
+	}()
+	if err := s.setWord(p.Width, p.Signed); err != nil {
+		return nil, err
+	}
+	defer e.SetProgrammer(false)
+	e.SetSaturate(p.Saturate)
+	shift := p.Shift
+	if shift == 0 {
+		shift = 1
+	}
+	if (shiftKeys[name] || p.Shift != 0) && shift >= uint(e.BitWidth) {
+		if e.BitWidth == 1 {
+			return nil, invalidParams("a 1-bit word cannot be shifted")
+		}
+		return nil, invalidParams("shift must be from 1 to %d", e.BitWidth-1)
+	}
+	x, err := s.value("x", p.X)
+	if err != nil {
+		return nil, err
+	}
+	var y calculator.Number
+	if arity == 2 {
+		if y, err = s.value("y", p.Y); err != nil {
+			return nil, err
+		}
+	}
+	e.EnterValue(x)
+	if isArith {
+		e.SetOperation(arith)
+		e.EnterValue(y)
+		if _, err := e.Calculate(); err != nil {
+			return nil, err
+		}
+		return programmerResult{e.Display, newBaseValues(e), flagValues(e.Flags)}, nil
+	}
+	if err := e.Press(name, calculator.KeySettings{Shift: shift}); err != nil {
+		return nil, err
+	}
+	if arity == 2 {
+		e.EnterValue(y)
+		if e.CalculateBitwise(); e.Err != nil {
+			return nil, e.Err
+		}
+	}
+	return programmerResult{e.Display, newBaseValues(e), flagValues(e.Flags)}, nil
+}
+
+type convertParams struct {
+	Value  *operand `json:"value"`
+	Width  int      `json:"width"`
+	Signed *bool    `json:"signed"`
+}
+
+// convert returns a value in each base, within a word of width bits.
+func (s *session) convert(p *convertParams) (any, error) {
+	if err := s.setWord(p.Width, p.Signed); err != nil {
+		return nil, err
+	}
+	defer s.engine.SetProgrammer(false)
+	n, err := s.value("value", p.Value)
+	if err != nil {
+		return nil, err
+	}
+	s.engine.EnterValue(n)
+	return newBaseValues(s.engine), nil
+}
+
+// setWord sets the programmer word from the width and signed parameters,
+// which are 64 and true if absent, and turns programmer mode on so that
+// values are fitted to it. The caller turns it off again.
+func (s *session) setWord(n int, signed *bool) error {
+	width := calculator.Bits64
+	if n != 0 {
+		var err error
+		if width, err = calculator.ParseBitWidth(strconv.Itoa(n)); err != nil {
+			return invalidParams("width must be from %d to %d", calculator.MinBitWidth, calculator.MaxBitWidth)
+		}
+	}
+	s.engine.SetBitWidth(width)
+	s.engine.SetSigned(signed == nil || *signed)
+	s.engine.SetProgrammer(true)
+	return nil
+}
+
+// date is a date parameter, in any form calculator.ParseDate reads.
+type date struct {
+	time.Time
+}
+
+func (d *date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("expected a date")
+	}
+	t, err := calculator.ParseDate(s)
+	if err != nil {
+		return err
+	}
+	d.Time = t
+	return nil
+}
+
+type dateRangeParams struct {
+	Start *date `json:"start"`
+	End   *date `json:"end"`
+}
+
+// set makes the range the start and end dates of the session's date
+// calculator.
+func (p *dateRangeParams) set(d *calculator.DateTimeCalc) error {
+	if p.Start == nil || p.End == nil {
+		return invalidParams("expected start and end dates")
+	}
+	d.StartDate, d.EndDate = p.Start.Time, p.End.Time
+	return nil
+}
+
+type dateDiffResult struct {
+	Years        int    `json:"years"`
+	Months       int    `json:"months"`
+	Days         int    `json:"days"`
+	TotalDays    int    `json:"total_days"`
+	TotalWeeks   int    `json:"total_weeks"`
+	TotalHours   int    `json:"total_hours"`
+	TotalMinutes int    `json:"total_minutes"`
+	TotalSeconds int    `json:"total_seconds"`
+	Text         string `json:"text"`
+}
+
+func (s *session) dateDiff(p *dateRangeParams) (any, error) {
+	if err := p.set(s.dates); err != nil {
+		return nil, err
+	}
+	diff := s.dates.CalculateDifference()
+	return dateDiffResult{
+		diff.Years, diff.Months, diff.Days,
+		diff.TotalDays, diff.TotalWeeks, diff.TotalHours, diff.TotalMinutes, diff.TotalSeconds,
+		calculator.FormatDifference(diff),
+	}, nil
+}
+
+type dateAddParams struct {
+	Date *date `json:"date"`
+	// Delta is a span such as "1y 2m 3d" or "3w".
+	Delta string `json:"delta"`
+}
+
+type dateResult struct {
+	Date    string `json:"date"`
+	Weekday string `json:"weekday"`
+}
+
+func (s *session) dateAdd(p *dateAddParams) (any, error) {
+	return addDelta(p, 1)
+}
+
+func (s *session) dateSubtract(p *dateAddParams) (any, error) {
+	return addDelta(p, -1)
+}
+
+// addDelta adds the delta of p to its date sign times.
+func addDelta(p *dateAddParams, sign int) (any, error) {
+	if p.Date == nil {
+		return nil, invalidParams("missing date")
+	}
+	years, months, days := calculator.ParseTimeDelta(p.Delta)
+	if years == 0 && months == 0 && days == 0 {
+		return nil, invalidParams("invalid delta %q, expected a span such as 1y 2m 3d", p.Delta)
+	}
+	t := p.Date.AddDate(sign*years, sign*months, sign*days)
+	return dateResult{t.Format("2006-01-02"), t.Format("Monday")}, nil
+}
+
+type workdaysResult struct {
+	WorkingDays int `json:"working_days"`
+	Days        int `json:"days"`
+}
+
+// workdays counts the days from start to end, both included, and those of
+// them from Monday to Friday.
+func (s *session) workdays(p *dateRangeParams) (any, error) {
+	if err := p.set(s.dates); err != nil {
+		return nil, err
+	}
+	return workdaysResult{s.dates.GetWorkingDays(true), s.dates.GetWorkingDays(false)}, nil
+}
+
+type ageParams struct {
+	Birth *date `json:"birth"`
+}
+
+type ageResult struct {
+	Years  int `json:"years"`
+	Months int `json:"months"`
+	Days   int `json:"days"`
+}
+
+func (s *session) age(p *ageParams) (any, error) {
+	if p.Birth == nil {
+		return nil, invalidParams("missing birth date")
+	}
+	var r ageResult
+	r.Years, r.Months, r.Days = s.dates.GetAge(p.Birth.Time)
+	return r, nil
+}
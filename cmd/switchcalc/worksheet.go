@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"switchcalc/pkg/calculator"
+)
+
+// runRun evaluates a worksheet file and prints it with its results.
+func runRun(args []string, stdout, stderr io.Writer) int {
+	var settings engineFlags
+	fs := newFlagSet("run", "[flags] SHEET"+calculator.WorksheetExt, stderr)
+	settings.register(fs)
+	output := fs.String("output", "text", "output format: text, markdown or json")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+	write, ok := worksheetWriters[*output]
+	if !ok || fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	e, err := settings.newEngine()
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return exitUsage
+	}
+	ws, err := calculator.LoadWorksheet(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return 1
+	}
+	failed := e.RunWorksheet(ws)
+	if err := write(stdout, ws); err != nil {
+		fmt.Fprintln(stderr, "switchcalc:", err)
+		return 1
+	}
+	if failed > 0 {
+		for _, line := range ws.Lines {
+			if line.Failed() {
+				fmt.Fprintf(stderr, "switchcalc: %s:%d: %s\n", fs.Arg(0), line.Number, line.Entry.Error)
+			}
+		}
+		return 1
+	}
+	return 0
+}
+
+// worksheetWriters write a worksheet that has run in each output format.
+var worksheetWriters = map[string]func(io.Writer, *calculator.Worksheet) error{
+	"text":     writeWorksheetText,
+	"markdown": writeWorksheetMarkdown,
+	"md":       writeWorksheetMarkdown,
+	"json":     writeWorksheetJSON,
+}
+
+// worksheetOutcome is what the line's calculation gave: "= result",
+// "! error", or nothing for a definition or a line without one.
+func worksheetOutcome(line calculator.WorksheetLine) string {
+	switch {
+	case line.Entry == nil:
+		return ""
+	case line.Failed():
+		return "! " + line.Entry.Error
+	}
+	return "= " + line.Entry.Result
+}
+
+// writeWorksheetText writes the worksheet as it was written, with the
+// result of each calculation lined up to the right of it.
+func writeWorksheetText(w io.Writer, ws *calculator.Worksheet) error {
+	inputWidth := 0
+	for _, line := range ws.Lines {
+		inputWidth = max(inputWidth, len([]rune(line.Input)))
+	}
+	// Comments after a calculation line up after the widest result
+	texts := make([]string, len(ws.Lines))
+	width := 0
+	for i, line := range ws.Lines {
+		texts[i] = line.Input
+		if outcome := worksheetOutcome(line); outcome != "" {
+			texts[i] += strings.Repeat(" ", inputWidth-len([]rune(line.Input))) + "  " + outcome
+		}
+		width = max(width, len([]rune(texts[i])))
+	}
+	var b strings.Builder
+	for i, line := range ws.Lines {
+		switch {
+		case line.Input == "" && line.Comment != "":
+			b.WriteString("# " + line.Comment)
+		case line.Comment != "":
+			b.WriteString(texts[i] + strings.Repeat(" ", width-len([]rune(texts[i]))) + "  # " + line.Comment)
+		default:
+			b.WriteString(texts[i])
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeWorksheetMarkdown writes the calculations of the worksheet as
+// tables, and the comments on lines of their own as text between them.
+func writeWorksheetMarkdown(w io.Writer, ws *calculator.Worksheet) error {
+	cell := func(s string) string {
+		return strings.ReplaceAll(s, "|", `\|`)
+	}
+	var b strings.Builder
+	inTable, blank := false, true
+	for _, line := range ws.Lines {
+		if line.Input == "" {
+			if inTable && line.Comment != "" {
+				b.WriteString("\n")
+			}
+			inTable = false
+			if line.Comment != "" {
+				b.WriteString(line.Comment + "\n")
+			} else {
+				b.WriteString("\n")
+			}
+			blank = line.Comment == ""
+			continue
+		}
+		if !inTable {
+			if !blank {
+				b.WriteString("\n")
+			}
+			b.WriteString("| Calculation | Result | Note |\n|---|---|---|\n")
+			inTable = true
+		}
+		result := ""
+		switch {
+		case line.Failed():
+			result = "**Error:** " + cell(line.Entry.Error)
+		case line.Entry != nil:
+			result = cell(line.Entry.Result)
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s |\n", cell(line.Input), result, cell(line.Comment))
+		blank = false
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// worksheetJSON is a worksheet that has run, as written by -output json.
+type worksheetJSON struct {
+	Lines  []worksheetLineJSON `json:"lines"`
+	Failed int                 `json:"failed"`
+}
+
+type worksheetLineJSON struct {
+	Line    int    `json:"line"`
+	Input   string `json:"input,omitempty"`
+	Result  string `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// writeWorksheetJSON writes the lines of the worksheet with their
+// results, leaving out blank lines.
+func writeWorksheetJSON(w io.Writer, ws *calculator.Worksheet) error {
+	out := worksheetJSON{Lines: []worksheetLineJSON{}}
+	for _, line := range ws.Lines {
+		if line.Input == "" && line.Comment == "" {
+			continue
+		}
+		l := worksheetLineJSON{Line: line.Number, Input: line.Input, Comment: line.Comment}
+		if line.Entry != nil {
+			l.Result, l.Error = line.Entry.Result, line.Entry.Error
+		}
+		if line.Failed() {
+			out.Failed++
+		}
+		out.Lines = append(out.Lines, l)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
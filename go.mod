@@ -2,10 +2,15 @@ module switchcalc
 
 go 1.21.0
 
-require github.com/diamondburned/gotk4/pkg v0.3.1
+require (
+	github.com/diamondburned/gotk4/pkg v0.3.1
+	github.com/godbus/dbus/v5 v5.1.0
+	golang.org/x/term v0.18.0
+)
 
 require (
 	github.com/KarpelesLab/weak v0.1.1 // indirect
 	go4.org/unsafe/assume-no-moving-gc v0.0.0-20231121144256-b99613f794b6 // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+	golang.org/x/sys v0.18.0 // indirect
 )
@@ -0,0 +1,449 @@
+package calculator
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// The functions here compute on big.Float at the precision of their
+// argument, so that decimal results keep the working precision instead of
+// the 15 digits of a float64. Each works with guard bits of its own and
+// rounds its result to the precision of the argument.
+
+// floatPrec is the big.Float precision for a result of digits significant
+// decimal digits, with a few to spare for rounding.
+func floatPrec(digits int) uint {
+	return uint(float64(digits+4)*math.Log2(10)) + 16
+}
+
+func newFloat(prec uint) *big.Float {
+	return new(big.Float).SetPrec(prec)
+}
+
+func floatInt(n int64, prec uint) *big.Float {
+	return newFloat(prec).SetInt64(n)
+}
+
+// floatExponent is the binary exponent of x, or 0 for zero.
+func floatExponent(x *big.Float) int {
+	return x.MantExp(nil)
+}
+
+// negligibleTerm reports whether adding t to sum no longer changes it.
+func negligibleTerm(sum, t *big.Float) bool {
+	return t.Sign() == 0 || sum.Sign() != 0 && floatExponent(sum)-floatExponent(t) > int(sum.Prec())
+}
+
+// oddSeries sums z + z³/3 + z⁵/5 + ..., which is atanh z, or with
+// alternate signs z - z³/3 + z⁵/5 - ..., which is atan z. It converges
+// quickly for small |z|.
+func oddSeries(z *big.Float, alternate bool) *big.Float {
+	prec := z.Prec()
+	sum := newFloat(prec).Set(z)
+	z2 := newFloat(prec).Mul(z, z)
+	if alternate {
+		z2.Neg(z2)
+	}
+	power := newFloat(prec).Set(z)
+	for k := int64(3); ; k += 2 {
+		power.Mul(power, z2)
+		t := newFloat(prec).Quo(power, floatInt(k, prec))
+		if negligibleTerm(sum, t) {
+			return sum
+		}
+		sum.Add(sum, t)
+	}
+}
+
+// floatLn2 is ln 2 = 2 atanh(1/3).
+func floatLn2(prec uint) *big.Float {
+	w := prec + 16
+	third := newFloat(w).Quo(floatInt(1, w), floatInt(3, w))
+	ln2 := oddSeries(third, false)
+	return newFloat(prec).SetMantExp(ln2, 1)
+}
+
+// floatPi is π = 16 atan(1/5) - 4 atan(1/239).
+func floatPi(prec uint) *big.Float {
+	w := prec + 16
+	a := oddSeries(newFloat(w).Quo(floatInt(1, w), floatInt(5, w)), true)
+	b := oddSeries(newFloat(w).Quo(floatInt(1, w), floatInt(239, w)), true)
+	a.SetMantExp(a, 2)
+	a.Sub(a, b)
+	return newFloat(prec).SetMantExp(a, 2)
+}
+
+// floatFloor rounds x down to an integer.
+func floatFloor(x *big.Float) *big.Int {
+	i, acc := x.Int(nil)
+	if acc == big.Above {
+		i.Sub(i, bigOne)
+	}
+	return i
+}
+
+// maxExpArgument bounds the argument of floatExp: beyond it the result is
+// outside the decimal range of checkRange anyway.
+const maxExpArgument = (maxDecimalExponent + 1) * math.Ln10
+
+// floatExp returns e^x, or false if it overflows the decimal range. It
+// underflows to zero.
+func floatExp(x *big.Float) (*big.Float, bool) {
+	prec := x.Prec()
+	f, _ := x.Float64()
+	switch {
+	case f > maxExpArgument:
+		return nil, false
+	case f < -maxExpArgument:
+		return newFloat(prec), true
+	}
+	// e^x = 2^k e^r with r = x - k ln 2 in [0, ln 2), and e^r is the
+	// series for r/256 squared eight times.
+	w := prec + uint(max(floatExponent(x), 0)) + 32
+	ln2 := floatLn2(w)
+	k := floatFloor(newFloat(w).Quo(x, ln2))
+	r := newFloat(w).Mul(newFloat(w).SetInt(k), ln2)
+	r.Sub(newFloat(w).Set(x), r)
+	r.SetMantExp(r, -8)
+	sum := floatInt(1, w)
+	term := floatInt(1, w)
+	for n := int64(1); ; n++ {
+		term.Mul(term, r)
+		term.Quo(term, floatInt(n, w))
+		if negligibleTerm(sum, term) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for i := 0; i < 8; i++ {
+		sum.Mul(sum, sum)
+	}
+	return newFloat(prec).SetMantExp(sum, int(k.Int64())), true
+}
+
+// floatLog returns ln x for x > 0.
+func floatLog(x *big.Float) *big.Float {
+	prec := x.Prec()
+	w := prec + 32
+	// x = m 2^k with m in [1/√2, √2), and ln m = 2 atanh((m-1)/(m+1)).
+	m := newFloat(w)
+	k := x.MantExp(m)
+	if m.Cmp(newFloat(64).SetFloat64(math.Sqrt2/2)) < 0 {
+		m.SetMantExp(m, 1)
+		k--
+	}
+	one := floatInt(1, w)
+	z := newFloat(w).Sub(m, one)
+	z.Quo(z, newFloat(w).Add(m, one))
+	sum := oddSeries(z, false)
+	sum.SetMantExp(sum, 1)
+	if k != 0 {
+		ln2 := floatLn2Times(k, w)
+		sum.Add(sum, ln2)
+	}
+	return newFloat(prec).Set(sum)
+}
+
+// floatLn2Times is k ln 2 to precision prec.
+func floatLn2Times(k int, prec uint) *big.Float {
+	w := prec + uint(big.NewInt(int64(k)).BitLen())
+	ln2 := floatLn2(w)
+	return ln2.Mul(ln2, floatInt(int64(k), w))
+}
+
+// maxReduceExponent bounds the arguments of floatSin and floatCos, since
+// reducing larger ones needs π to more bits than is worth computing.
+const maxReduceExponent = 1 << 14
+
+// reduceAngle returns r = x - qπ/2 with |r| ≤ π/4, and q mod 4.
+func reduceAngle(x *big.Float) (*big.Float, int, bool) {
+	exp := floatExponent(x)
+	if exp > maxReduceExponent {
+		return nil, 0, false
+	}
+	w := x.Prec() + uint(max(exp, 0)) + 32
+	halfPi := floatPi(w)
+	halfPi.SetMantExp(halfPi, -1)
+	q := newFloat(w).Quo(x, halfPi)
+	q.Add(q, newFloat(w).SetFloat64(0.5))
+	qi := floatFloor(q)
+	r := newFloat(w).Mul(newFloat(w).SetInt(qi), halfPi)
+	r.Sub(newFloat(w).Set(x), r)
+	return r, int(new(big.Int).And(qi, big.NewInt(3)).Int64()), true
+}
+
+// sinSeries is r - r³/3! + r⁵/5! - ..., and cosSeries 1 - r²/2! + r⁴/4!
+// - ..., for |r| ≤ π/4.
+func sinSeries(r *big.Float) *big.Float {
+	return trigSeries(r, newFloat(r.Prec()).Set(r), 2)
+}
+
+func cosSeries(r *big.Float) *big.Float {
+	return trigSeries(r, floatInt(1, r.Prec()), 1)
+}
+
+func trigSeries(r, first *big.Float, n int64) *big.Float {
+	prec := r.Prec()
+	r2 := newFloat(prec).Mul(r, r)
+	r2.Neg(r2)
+	sum := newFloat(prec).Set(first)
+	term := newFloat(prec).Set(first)
+	for ; ; n += 2 {
+		term.Mul(term, r2)
+		term.Quo(term, floatInt(n*(n+1), prec))
+		if negligibleTerm(sum, term) {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// floatSin returns sin x, or false if x is too large to reduce.
+func floatSin(x *big.Float) (*big.Float, bool) {
+	r, q, ok := reduceAngle(x)
+	if !ok {
+		return nil, false
+	}
+	return newFloat(x.Prec()).Set(quadrant(r, q)), true
+}
+
+// floatCos returns cos x, or false if x is too large to reduce.
+func floatCos(x *big.Float) (*big.Float, bool) {
+	r, q, ok := reduceAngle(x)
+	if !ok {
+		return nil, false
+	}
+	// cos x = sin(x + π/2).
+	return newFloat(x.Prec()).Set(quadrant(r, (q+1)%4)), true
+}
+
+// quadrant returns sin(r + qπ/2).
+func quadrant(r *big.Float, q int) *big.Float {
+	var s *big.Float
+	if q%2 == 0 {
+		s = sinSeries(r)
+	} else {
+		s = cosSeries(r)
+	}
+	if q >= 2 {
+		s.Neg(s)
+	}
+	return s
+}
+
+// floatAtan returns atan x.
+func floatAtan(x *big.Float) *big.Float {
+	prec := x.Prec()
+	w := prec + 32
+	z := newFloat(w).Abs(x)
+	one := floatInt(1, w)
+	// atan z = π/2 - atan(1/z), and atan z = 2 atan(z/(1 + √(1+z²)))
+	// until z is small enough for the series.
+	invert := z.Cmp(one) > 0
+	if invert {
+		z.Quo(one, z)
+	}
+	halvings := 0
+	for z.Sign() != 0 && floatExponent(z) > -3 {
+		d := newFloat(w).Mul(z, z)
+		d.Add(d, one)
+		d.Sqrt(d)
+		d.Add(d, one)
+		z.Quo(z, d)
+		halvings++
+	}
+	sum := oddSeries(z, true)
+	sum.SetMantExp(sum, halvings)
+	if invert {
+		halfPi := floatPi(w)
+		halfPi.SetMantExp(halfPi, -1)
+		sum.Sub(halfPi, sum)
+	}
+	if x.Sign() < 0 {
+		sum.Neg(sum)
+	}
+	return newFloat(prec).Set(sum)
+}
+
+// floatAsin returns asin x for |x| ≤ 1.
+func floatAsin(x *big.Float) *big.Float {
+	prec := x.Prec()
+	w := prec + 32
+	one := floatInt(1, w)
+	if newFloat(w).Abs(x).Cmp(one) == 0 {
+		halfPi := floatPi(prec)
+		halfPi.SetMantExp(halfPi, -1)
+		if x.Sign() < 0 {
+			halfPi.Neg(halfPi)
+		}
+		return halfPi
+	}
+	// asin x = atan(x/√((1-x)(1+x))).
+	d := newFloat(w).Sub(one, x)
+	d.Mul(d, newFloat(w).Add(one, x))
+	d.Sqrt(d)
+	a := floatAtan(newFloat(w).Quo(x, d))
+	return newFloat(prec).Set(a)
+}
+
+// floatAcos returns acos x for |x| ≤ 1, as 2 atan(√((1-x)/(1+x))), which
+// keeps its precision near 1.
+func floatAcos(x *big.Float) *big.Float {
+	prec := x.Prec()
+	w := prec + 32
+	one := floatInt(1, w)
+	den := newFloat(w).Add(one, x)
+	if den.Sign() == 0 {
+		return floatPi(prec)
+	}
+	q := newFloat(w).Sub(one, x)
+	q.Quo(q, den)
+	a := floatAtan(q.Sqrt(q))
+	return newFloat(prec).SetMantExp(a, 1)
+}
+
+// smallGuard is the extra precision for formulas that cancel for small
+// |x|, such as sinh x = (e^x - e^-x)/2.
+func smallGuard(x *big.Float) uint {
+	return uint(max(-floatExponent(x), 0)) + 32
+}
+
+// floatSinh, floatCosh and floatTanh return false if the result
+// overflows.
+func floatSinh(x *big.Float) (*big.Float, bool) {
+	prec := x.Prec()
+	w := prec + smallGuard(x)
+	a, ok := floatExp(newFloat(w).Set(x))
+	if !ok || a.Sign() == 0 {
+		return nil, false
+	}
+	b := newFloat(w).Quo(floatInt(1, w), a)
+	a.Sub(a, b)
+	return newFloat(prec).SetMantExp(a, -1), true
+}
+
+func floatCosh(x *big.Float) (*big.Float, bool) {
+	prec := x.Prec()
+	w := prec + 32
+	a, ok := floatExp(newFloat(w).Abs(x))
+	if !ok {
+		return nil, false
+	}
+	b := newFloat(w).Quo(floatInt(1, w), a)
+	a.Add(a, b)
+	return newFloat(prec).SetMantExp(a, -1), true
+}
+
+// floatTanh is (e^2x - 1)/(e^2x + 1), or ±1 once e^2x swamps the 1s.
+func floatTanh(x *big.Float) *big.Float {
+	prec := x.Prec()
+	if floatExponent(x) > 0 && new(big.Float).Abs(x).Cmp(floatInt(int64(prec), 64)) > 0 {
+		return floatInt(int64(x.Sign()), prec)
+	}
+	w := prec + smallGuard(x)
+	t, _ := floatExp(newFloat(w).SetMantExp(x, 1))
+	one := floatInt(1, w)
+	num := newFloat(w).Sub(t, one)
+	return newFloat(prec).Quo(num, t.Add(t, one))
+}
+
+// floatAsinh returns asinh x = ln(x + √(x²+1)), computed for |x| since
+// the function is odd.
+func floatAsinh(x *big.Float) *big.Float {
+	prec := x.Prec()
+	w := prec + smallGuard(x)
+	z := newFloat(w).Abs(x)
+	d := newFloat(w).Mul(z, z)
+	d.Add(d, floatInt(1, w))
+	d.Sqrt(d)
+	r := floatLog(d.Add(d, z))
+	if x.Sign() < 0 {
+		r.Neg(r)
+	}
+	return newFloat(prec).Set(r)
+}
+
+// floatAcosh returns acosh x = ln(x + √((x-1)(x+1))) for x ≥ 1.
+func floatAcosh(x *big.Float) *big.Float {
+	prec := x.Prec()
+	w := prec + 32
+	one := floatInt(1, w)
+	d := newFloat(w).Sub(x, one)
+	d.Mul(d, newFloat(w).Add(x, one))
+	d.Sqrt(d)
+	return newFloat(prec).Set(floatLog(d.Add(d, x)))
+}
+
+// floatAtanh returns atanh x = ln((1+x)/(1-x))/2 for |x| < 1.
+func floatAtanh(x *big.Float) *big.Float {
+	prec := x.Prec()
+	w := prec + smallGuard(x)
+	one := floatInt(1, w)
+	q := newFloat(w).Add(one, x)
+	q.Quo(q, newFloat(w).Sub(one, x))
+	r := floatLog(q)
+	return newFloat(prec).SetMantExp(r, -1)
+}
+
+// floatDecimalExponent estimates the decimal exponent of f from its binary
+// one, to within one.
+func floatDecimalExponent(f *big.Float) int {
+	return int(float64(f.MantExp(nil)) * math.Log10(2))
+}
+
+// floatBeyondRange checks f, a result about to be written in decimal,
+// against maxDecimalExponent. It gives ErrOverflow for a larger f, and
+// reports whether f is too small to be anything but zero.
+func floatBeyondRange(f *big.Float) (zero bool, err error) {
+	switch exp := floatDecimalExponent(f); {
+	case exp > maxDecimalExponent+1:
+		return false, ErrOverflow
+	case exp < -maxDecimalExponent-1:
+		return true, nil
+	}
+	return false, nil
+}
+
+// floatText writes f in decimal with n digits after the point, like
+// f.Text('e', n). Text takes time in proportion to the exponent of f,
+// so a large power of ten is divided out first.
+func floatText(f *big.Float, n int) string {
+	exp := floatDecimalExponent(f)
+	if exp > -1000 && exp < 1000 {
+		return f.Text('e', n)
+	}
+	prec := f.Prec() + 64
+	scale := floatInt(1, prec)
+	for ten, k := floatInt(10, prec), max(exp, -exp); k > 0; k >>= 1 {
+		if k&1 == 1 {
+			scale.Mul(scale, ten)
+		}
+		ten.Mul(ten, ten)
+	}
+	m := newFloat(prec)
+	if exp > 0 {
+		m.Quo(f, scale)
+	} else {
+		m.Mul(f, scale)
+	}
+	mant, e, _ := strings.Cut(m.Text('e', n), "e")
+	rest, _ := strconv.Atoi(e)
+	return mant + "e" + strconv.Itoa(rest+exp)
+}
+
+// floatPow returns x^y for x > 0 as e^(y ln x), or false if it overflows.
+func floatPow(x, y *big.Float) (*big.Float, bool) {
+	prec := x.Prec()
+	// The exponent can be as large as maxExpArgument, whose integer bits
+	// are lost to the fraction of the result.
+	w := prec + 64
+	t := floatLog(newFloat(w).Set(x))
+	t.Mul(t, y)
+	r, ok := floatExp(t)
+	if !ok {
+		return nil, false
+	}
+	return newFloat(prec).Set(r), true
+}
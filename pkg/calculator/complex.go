@@ -0,0 +1,475 @@
+package calculator
+
+import (
+	"math"
+	"math/big"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+// ComplexNumber is a complex value held in complex128.
+type ComplexNumber struct {
+	z complex128
+}
+
+func (c *ComplexNumber) Complex128() complex128 {
+	return c.z
+}
+
+// Float64 returns the real part.
+func (c *ComplexNumber) Float64() float64 {
+	return real(c.z)
+}
+
+// IsReal reports whether the imaginary part is zero.
+func (c *ComplexNumber) IsReal() bool {
+	return imag(c.z) == 0
+}
+
+// String returns the number in rectangular form, such as "3-4i", with
+// enough digits to read it back exactly.
+func (c *ComplexNumber) String() string {
+	return formatRectangular(real(c.z), imag(c.z), func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	})
+}
+
+func formatRectangular(re, im float64, format func(float64) string) string {
+	if im == 0 {
+		return format(re)
+	}
+	var s string
+	switch im {
+	case 1:
+		s = "i"
+	case -1:
+		s = "-i"
+	default:
+		s = format(im) + "i"
+	}
+	if re == 0 {
+		return s
+	}
+	if !strings.HasPrefix(s, "-") {
+		s = "+" + s
+	}
+	return format(re) + s
+}
+
+type ComplexDisplay int
+
+const (
+	ComplexRectangular ComplexDisplay = iota
+	ComplexPolar
+)
+
+// ComplexArithmetic computes on complex128 values using math/cmplx.
+type ComplexArithmetic struct{}
+
+func NewComplexArithmetic() *ComplexArithmetic {
+	return &ComplexArithmetic{}
+}
+
+// newComplex drops the sign of zero parts, so that negating 4 and taking
+// the square root gives 2i rather than the root on the other side of the
+// branch cut.
+func newComplex(z complex128) *ComplexNumber {
+	re, im := real(z), imag(z)
+	if re == 0 {
+		re = 0
+	}
+	if im == 0 {
+		im = 0
+	}
+	return &ComplexNumber{z: complex(re, im)}
+}
+
+// Parse accepts real numbers and rectangular forms such as "4i", "-i",
+// "2.5e3i" and "3-4i".
+func (a *ComplexArithmetic) Parse(s string) (Number, error) {
+	s = strings.TrimSpace(s)
+	body, ok := strings.CutSuffix(s, "i")
+	if !ok {
+		re, err := parseComplexPart(s)
+		if err != nil {
+			return nil, err
+		}
+		return newComplex(complex(re, 0)), nil
+	}
+	reText, imText := "", body
+	for i := len(body) - 1; i > 0; i-- {
+		if (body[i] == '+' || body[i] == '-') && body[i-1] != 'e' && body[i-1] != 'E' {
+			reText, imText = body[:i], body[i:]
+			break
+		}
+	}
+	var re float64
+	if reText != "" {
+		var err error
+		if re, err = parseComplexPart(reText); err != nil {
+			return nil, err
+		}
+	}
+	var im float64
+	switch imText {
+	case "", "+":
+		im = 1
+	case "-":
+		im = -1
+	default:
+		var err error
+		if im, err = parseComplexPart(imText); err != nil {
+			return nil, err
+		}
+	}
+	return newComplex(complex(re, im)), nil
+}
+
+func parseComplexPart(s string) (float64, error) {
+	if s == "" || strings.ContainsAny(s, "xXpP_nN") {
+		return 0, errInvalidNumber
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errInvalidNumber
+	}
+	return f, nil
+}
+
+func (a *ComplexArithmetic) FromFloat(f float64) Number {
+	return newComplex(complex(f, 0))
+}
+
+func (a *ComplexArithmetic) FromInt(i *big.Int) Number {
+	f, _ := new(big.Float).SetInt(i).Float64()
+	return a.FromFloat(f)
+}
+
+func (a *ComplexArithmetic) Convert(n Number) Number {
+	switch v := n.(type) {
+	case nil:
+		return newComplex(0)
+	case *ComplexNumber:
+		return v
+	}
+	return a.FromFloat(n.Float64())
+}
+
+func (a *ComplexArithmetic) complex(n Number) complex128 {
+	return a.Convert(n).(*ComplexNumber).z
+}
+
+// Int truncates the real part.
+func (a *ComplexArithmetic) Int(n Number) *big.Int {
+	re := real(a.complex(n))
+	if math.IsNaN(re) || math.IsInf(re, 0) {
+		return new(big.Int)
+	}
+	i, _ := big.NewFloat(re).Int(nil)
+	return i
+}
+
+func (a *ComplexArithmetic) Add(x, y Number) Number {
+	return newComplex(a.complex(x) + a.complex(y))
+}
+
+func (a *ComplexArithmetic) Sub(x, y Number) Number {
+	return newComplex(a.complex(x) - a.complex(y))
+}
+
+func (a *ComplexArithmetic) Mul(x, y Number) Number {
+	return newComplex(a.complex(x) * a.complex(y))
+}
+
+func (a *ComplexArithmetic) Quo(x, y Number) (Number, error) {
+	if a.complex(y) == 0 {
+		return nil, ErrDivideByZero
+	}
+	return newComplex(a.complex(x) / a.complex(y)), nil
+}
+
+// Mod is only defined for real operands.
+func (a *ComplexArithmetic) Mod(x, y Number) (Number, error) {
+	zx, zy := a.complex(x), a.complex(y)
+	if imag(zx) != 0 || imag(zy) != 0 {
+		return nil, errDomain
+	}
+	if zy == 0 {
+		return nil, ErrDivideByZero
+	}
+	return a.FromFloat(math.Mod(real(zx), real(zy))), nil
+}
+
+// Pow multiplies out integer exponents so that, for example, i^2 is
+// exactly -1; other exponents take the principal value.
+func (a *ComplexArithmetic) Pow(x, y Number) (Number, error) {
+	base, exp := a.complex(x), a.complex(y)
+	if imag(exp) == 0 && real(exp) == math.Trunc(real(exp)) && math.Abs(real(exp)) <= maxExactExponent {
+		n := int64(real(exp))
+		if n < 0 {
+			if base == 0 {
+				return nil, ErrDivideByZero
+			}
+			base = 1 / base
+			n = -n
+		}
+		result := complex(1, 0)
+		for ; n > 0; n >>= 1 {
+			if n&1 == 1 {
+				result *= base
+			}
+			base *= base
+		}
+		return newComplex(result), nil
+	}
+	if base == 0 && real(exp) < 0 {
+		return nil, ErrDivideByZero
+	}
+	return newComplex(cmplx.Pow(base, exp)), nil
+}
+
+func (a *ComplexArithmetic) Neg(x Number) Number {
+	return newComplex(-a.complex(x))
+}
+
+// Sign is the sign of the real part, or of the imaginary part for
+// imaginary numbers.
+func (a *ComplexArithmetic) Sign(x Number) int {
+	z := a.complex(x)
+	switch {
+	case real(z) > 0:
+		return 1
+	case real(z) < 0:
+		return -1
+	case imag(z) > 0:
+		return 1
+	case imag(z) < 0:
+		return -1
+	}
+	return 0
+}
+
+// Cmp orders by real part, then by imaginary part.
+func (a *ComplexArithmetic) Cmp(x, y Number) int {
+	return a.Sign(a.Sub(x, y))
+}
+
+func (a *ComplexArithmetic) Floor(x Number) Number {
+	z := a.complex(x)
+	return newComplex(complex(math.Floor(real(z)), math.Floor(imag(z))))
+}
+
+func (a *ComplexArithmetic) Ceil(x Number) Number {
+	z := a.complex(x)
+	return newComplex(complex(math.Ceil(real(z)), math.Ceil(imag(z))))
+}
+
+func (a *ComplexArithmetic) Round(x Number) Number {
+	z := a.complex(x)
+	return newComplex(complex(math.Round(real(z)), math.Round(imag(z))))
+}
+
+// Sqrt returns the principal square root, so negative numbers have an
+// imaginary root.
+func (a *ComplexArithmetic) Sqrt(x Number) (Number, error) {
+	return newComplex(cmplx.Sqrt(a.complex(x))), nil
+}
+
+// complexDigits is the number of significant digits shown for each part of
+// a complex result, the most a float64 reliably carries.
+const complexDigits = 15
+
+// formatComplex shows z in the engine's complex display form. A part that
+// is only rounding noise next to the other, such as the imaginary part of
+// e^iπ, is shown as zero.
+func (e *Engine) formatComplex(z complex128) string {
+	digits := min(e.Precision, complexDigits)
+	format := func(f float64) string {
+		return e.formatDecimal(NewDecimalArithmetic(digits).FromFloat(f).(*DecimalNumber))
+	}
+	if e.ComplexDisplay == ComplexPolar {
+		if z == 0 {
+			return "0"
+		}
+		s := format(cmplx.Abs(z)) + "∠" + format(e.fromRadians(cmplx.Phase(z)))
+		if e.AngleMode == Degrees {
+			s += "°"
+		}
+		return s
+	}
+	re, im := real(z), imag(z)
+	const noise = 1e-14
+	if math.Abs(im) < math.Abs(re)*noise {
+		im = 0
+	}
+	if math.Abs(re) < math.Abs(im)*noise {
+		re = 0
+	}
+	return formatRectangular(re, im, format)
+}
+
+func (e *Engine) SetComplexDisplay(display ComplexDisplay) {
+	defer e.checkpoint()()
+	e.ComplexDisplay = display
+	e.redisplay()
+}
+
+// InputImaginary is the i key: it marks the number being entered as
+// imaginary, or enters i itself when nothing has been typed.
+func (e *Engine) InputImaginary() {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	if e.NumberMode != ModeComplex || e.NumberBase != Decimal {
+		return
+	}
+	switch {
+	case e.NewInput || e.Display == "0":
+		if e.NewInput {
+			e.liftStack()
+		}
+		e.Display = "i"
+		e.NewInput = false
+	case e.imaginaryEntered() || strings.HasSuffix(strings.ToLower(e.Display), "e"):
+		return
+	default:
+		e.Display += "i"
+	}
+	e.parseDisplay()
+	e.operandEntered = true
+}
+
+// imaginaryEntered reports whether the entry in progress already ends in
+// i, after which no more digits can be typed.
+func (e *Engine) imaginaryEntered() bool {
+	return !e.NewInput && strings.HasSuffix(e.Display, "i")
+}
+
+func (e *Engine) complexToRadians(z complex128) complex128 {
+	return complex(e.toRadians(real(z)), e.toRadians(imag(z)))
+}
+
+func (e *Engine) complexFromRadians(z complex128) complex128 {
+	return complex(e.fromRadians(real(z)), e.fromRadians(imag(z)))
+}
+
+func (e *Engine) complexSin(z complex128) (complex128, error) {
+	return cmplx.Sin(e.complexToRadians(z)), nil
+}
+
+func (e *Engine) complexCos(z complex128) (complex128, error) {
+	return cmplx.Cos(e.complexToRadians(z)), nil
+}
+
+func (e *Engine) complexTan(z complex128) (complex128, error) {
+	if imag(z) == 0 {
+		// tan is undefined at odd quarter turns in the complex plane too.
+		t, err := e.tan(real(z))
+		return complex(t, 0), err
+	}
+	return cmplx.Tan(e.complexToRadians(z)), nil
+}
+
+func (e *Engine) complexAsin(z complex128) (complex128, error) {
+	return e.complexFromRadians(cmplx.Asin(z)), nil
+}
+
+func (e *Engine) complexAcos(z complex128) (complex128, error) {
+	return e.complexFromRadians(cmplx.Acos(z)), nil
+}
+
+func (e *Engine) complexAtan(z complex128) (complex128, error) {
+	if z == 1i || z == -1i {
+		return 0, errDomain
+	}
+	return e.complexFromRadians(cmplx.Atan(z)), nil
+}
+
+func (e *Engine) complexSinh(z complex128) (complex128, error) {
+	return cmplx.Sinh(z), nil
+}
+
+func (e *Engine) complexCosh(z complex128) (complex128, error) {
+	return cmplx.Cosh(z), nil
+}
+
+func (e *Engine) complexTanh(z complex128) (complex128, error) {
+	return cmplx.Tanh(z), nil
+}
+
+func (e *Engine) complexAsinh(z complex128) (complex128, error) {
+	return cmplx.Asinh(z), nil
+}
+
+func (e *Engine) complexAcosh(z complex128) (complex128, error) {
+	return cmplx.Acosh(z), nil
+}
+
+func (e *Engine) complexAtanh(z complex128) (complex128, error) {
+	if z == 1 || z == -1 {
+		return 0, errDomain
+	}
+	return cmplx.Atanh(z), nil
+}
+
+func (e *Engine) complexLog(z complex128) (complex128, error) {
+	if z == 0 {
+		return 0, errDomain
+	}
+	return cmplx.Log10(z), nil
+}
+
+func (e *Engine) complexLn(z complex128) (complex128, error) {
+	if z == 0 {
+		return 0, errDomain
+	}
+	return cmplx.Log(z), nil
+}
+
+func (e *Engine) complexLog2(z complex128) (complex128, error) {
+	if z == 0 {
+		return 0, errDomain
+	}
+	return cmplx.Log(z) / math.Ln2, nil
+}
+
+func (e *Engine) complexExp(z complex128) (complex128, error) {
+	return cmplx.Exp(z), nil
+}
+
+func (e *Engine) complexExp10(z complex128) (complex128, error) {
+	return cmplx.Pow(10, z), nil
+}
+
+func (e *Engine) complexExp2(z complex128) (complex128, error) {
+	return cmplx.Pow(2, z), nil
+}
+
+func (e *Engine) complexSqrt(z complex128) (complex128, error) {
+	return cmplx.Sqrt(z), nil
+}
+
+func (e *Engine) complexCbrt(z complex128) (complex128, error) {
+	return cmplx.Pow(z, 1.0/3), nil
+}
+
+func (e *Engine) complexSquare(z complex128) (complex128, error) {
+	return z * z, nil
+}
+
+func (e *Engine) complexCube(z complex128) (complex128, error) {
+	return z * z * z, nil
+}
+
+func (e *Engine) complexReciprocal(z complex128) (complex128, error) {
+	if z == 0 {
+		return 0, errDomain
+	}
+	return 1 / z, nil
+}
+
+func (e *Engine) complexAbs(z complex128) (complex128, error) {
+	return complex(cmplx.Abs(z), 0), nil
+}
@@ -0,0 +1,128 @@
+package calculator
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const appDirName = "switchcalc"
+
+// DataDir returns $XDG_DATA_HOME/switchcalc, defaulting to
+// ~/.local/share/switchcalc.
+func DataDir() (string, error) {
+	return xdgDir("XDG_DATA_HOME", ".local/share")
+}
+
+// ConfigDir returns $XDG_CONFIG_HOME/switchcalc, defaulting to
+// ~/.config/switchcalc.
+func ConfigDir() (string, error) {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+func xdgDir(env, fallback string) (string, error) {
+	base := os.Getenv(env)
+	if !filepath.IsAbs(base) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, fallback)
+	}
+	return filepath.Join(base, appDirName), nil
+}
+
+// Config holds the settings kept in config.json in ConfigDir.
+type Config struct {
+	// HistoryLimit is the number of history entries kept.
+	HistoryLimit int `json:"history_limit"`
+	// HistoryMaxAgeDays is how long history entries are kept, or 0 to
+	// keep them until HistoryLimit pushes them out.
+	HistoryMaxAgeDays int `json:"history_max_age_days"`
+	// Functions are the definitions of the user functions, such as
+	// "f(x) = 3x^2 + 2x - 1".
+	Functions []string `json:"functions,omitempty"`
+	// Locale is the locale name numbers are written in, such as "de_DE"
+	// or "en_IN", or "" for LC_NUMERIC.
+	Locale string `json:"locale,omitempty"`
+}
+
+// NumberLocale returns the number conventions of cfg.Locale, or of the
+// environment when it is not set.
+func (cfg Config) NumberLocale() NumberLocale {
+	if cfg.Locale == "" {
+		return DefaultLocale()
+	}
+	return ParseLocale(cfg.Locale)
+}
+
+func DefaultConfig() Config {
+	return Config{
+		HistoryLimit:      DefaultHistoryLimit,
+		HistoryMaxAgeDays: 90,
+	}
+}
+
+func ConfigPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// LoadConfig reads the config file. Settings missing from it keep their
+// defaults, and a missing file gives the default config.
+func LoadConfig() (Config, error) {
+	cfg := DefaultConfig()
+	path, err := ConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return DefaultConfig(), err
+	}
+	return cfg, nil
+}
+
+func SaveConfig(cfg Config) error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// writeFileAtomic replaces path with data so that readers see either the
+// old or the new contents, never a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -2,6 +2,8 @@ package calculator
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -293,3 +295,70 @@ func (d *DateTimeCalc) SetEndDateTime(year, month, day, hour, minute, second int
 func (d *DateTimeCalc) Today() {
 	d.StartDate = time.Now()
 }
+
+// ParseTimeDelta reads a span of time such as "1y 2m 3d" or "2w": years,
+// months and days, with weeks counted as seven days. Parts it cannot read
+// are ignored.
+func ParseTimeDelta(input string) (years, months, days int) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	parts := strings.Fields(input)
+
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if len(part) < 2 {
+			continue
+		}
+
+		unit := part[len(part)-1]
+		numStr := part[:len(part)-1]
+
+		num, err := strconv.Atoi(numStr)
+		if err != nil {
+			continue
+		}
+
+		switch unit {
+		case 'y':
+			years = num
+		case 'm':
+			months = num
+		case 'd':
+			days = num
+		case 'w':
+			days += num * 7
+		}
+	}
+	return
+}
+
+// dateLayouts are the layouts ParseDate reads: ISO 8601 and the day-first
+// form of the Date mode, with or without a time.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"02/01/2006",
+	"02/01/2006 15:04",
+	"02/01/2006 15:04:05",
+}
+
+// ParseDate reads a date such as "2024-03-15" or "15/03/2024", optionally
+// with a time, in the local time zone. "today" is the start of the current
+// day and "now" the current time.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	now := time.Now()
+	switch strings.ToLower(s) {
+	case "now":
+		return now, nil
+	case "today":
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local), nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or DD/MM/YYYY", s)
+}
@@ -0,0 +1,432 @@
+package calculator
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DecimalNumber is an arbitrary-precision decimal with value coef × 10^exp.
+// Values are immutable; operations return new ones.
+type DecimalNumber struct {
+	coef *big.Int
+	exp  int
+}
+
+var (
+	bigOne = big.NewInt(1)
+	bigTen = big.NewInt(10)
+)
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+func newDecimal(coef *big.Int, exp int) *DecimalNumber {
+	d := &DecimalNumber{coef: coef, exp: exp}
+	if coef.Sign() == 0 {
+		d.exp = 0
+		return d
+	}
+	q, r := new(big.Int), new(big.Int)
+	for {
+		q.QuoRem(d.coef, bigTen, r)
+		if r.Sign() != 0 {
+			break
+		}
+		d.coef = new(big.Int).Set(q)
+		d.exp++
+	}
+	return d
+}
+
+func (d *DecimalNumber) digits() int {
+	if d.coef.Sign() == 0 {
+		return 1
+	}
+	return len(new(big.Int).Abs(d.coef).String())
+}
+
+// adjustedExp is the exponent of the most significant digit.
+func (d *DecimalNumber) adjustedExp() int {
+	return d.exp + d.digits() - 1
+}
+
+func (d *DecimalNumber) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// String returns the value in plain notation when that stays reasonably
+// short, and in scientific notation otherwise.
+func (d *DecimalNumber) String() string {
+	adj := d.adjustedExp()
+	if adj < -20 || adj >= 40 {
+		return d.Scientific()
+	}
+	neg := d.coef.Sign() < 0
+	digits := new(big.Int).Abs(d.coef).String()
+	var s string
+	switch {
+	case d.exp >= 0:
+		s = digits + strings.Repeat("0", d.exp)
+	case -d.exp < len(digits):
+		point := len(digits) + d.exp
+		s = digits[:point] + "." + digits[point:]
+	default:
+		s = "0." + strings.Repeat("0", -d.exp-len(digits)) + digits
+	}
+	if neg {
+		return "-" + s
+	}
+	return s
+}
+
+// float returns d as a big.Float of precision prec.
+func (d *DecimalNumber) float(prec uint) *big.Float {
+	f, _, _ := big.ParseFloat(d.Scientific(), 10, prec, big.ToNearestEven)
+	return f
+}
+
+func (d *DecimalNumber) Scientific() string {
+	neg := d.coef.Sign() < 0
+	digits := new(big.Int).Abs(d.coef).String()
+	s := digits[:1]
+	if len(digits) > 1 {
+		s += "." + digits[1:]
+	}
+	s += "e" + strconv.Itoa(d.adjustedExp())
+	if neg {
+		return "-" + s
+	}
+	return s
+}
+
+// DecimalArithmetic computes on DecimalNumber values, rounding every inexact
+// result to Digits significant digits.
+type DecimalArithmetic struct {
+	Digits int
+}
+
+func NewDecimalArithmetic(digits int) *DecimalArithmetic {
+	return &DecimalArithmetic{Digits: digits}
+}
+
+func (a *DecimalArithmetic) round(d *DecimalNumber) *DecimalNumber {
+	return roundDecimal(d, a.Digits)
+}
+
+// roundDecimal rounds half away from zero to the given number of
+// significant digits.
+func roundDecimal(d *DecimalNumber, digits int) *DecimalNumber {
+	drop := d.digits() - digits
+	if drop <= 0 {
+		return d
+	}
+	q, r := new(big.Int).QuoRem(d.coef, pow10(drop), new(big.Int))
+	half := new(big.Int).Mul(big.NewInt(5), pow10(drop-1))
+	if r.CmpAbs(half) >= 0 {
+		if d.coef.Sign() < 0 {
+			q.Sub(q, bigOne)
+		} else {
+			q.Add(q, bigOne)
+		}
+	}
+	return newDecimal(q, d.exp+drop)
+}
+
+func (a *DecimalArithmetic) Parse(s string) (Number, error) {
+	s = strings.TrimSpace(s)
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return nil, errInvalidNumber
+		}
+		mantissa, exp = s[:i], e
+	}
+	neg := false
+	if strings.HasPrefix(mantissa, "-") || strings.HasPrefix(mantissa, "+") {
+		neg = mantissa[0] == '-'
+		mantissa = mantissa[1:]
+	}
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		exp -= len(mantissa) - i - 1
+		mantissa = mantissa[:i] + mantissa[i+1:]
+	}
+	if mantissa == "" || strings.Trim(mantissa, "0123456789") != "" {
+		return nil, errInvalidNumber
+	}
+	coef, _ := new(big.Int).SetString(mantissa, 10)
+	if neg {
+		coef.Neg(coef)
+	}
+	return a.round(newDecimal(coef, exp)), nil
+}
+
+// FromFloat keeps the 15 significant digits a float64 reliably carries, so
+// that a value such as 0.49999999999999994 from a float64 computation comes
+// out as 0.5.
+func (a *DecimalArithmetic) FromFloat(f float64) Number {
+	n, err := a.Parse(strconv.FormatFloat(f, 'g', 15, 64))
+	if err != nil {
+		return &DecimalNumber{coef: new(big.Int)}
+	}
+	return n
+}
+
+func (a *DecimalArithmetic) FromInt(i *big.Int) Number {
+	return a.round(newDecimal(new(big.Int).Set(i), 0))
+}
+
+func (a *DecimalArithmetic) Convert(n Number) Number {
+	switch v := n.(type) {
+	case nil:
+		return a.FromInt(new(big.Int))
+	case *DecimalNumber:
+		return a.round(v)
+	case *RationalNumber:
+		q, _ := a.Quo(a.FromInt(v.rat.Num()), a.FromInt(v.rat.Denom()))
+		return q
+	}
+	return a.FromFloat(n.Float64())
+}
+
+func (a *DecimalArithmetic) dec(n Number) *DecimalNumber {
+	if d, ok := n.(*DecimalNumber); ok {
+		return d
+	}
+	return a.Convert(n).(*DecimalNumber)
+}
+
+// Int truncates n towards zero. Values too large to represent usefully
+// are clamped to ±10^maxExactExponent.
+func (a *DecimalArithmetic) Int(n Number) *big.Int {
+	d := a.dec(n)
+	if d.exp > maxExactExponent {
+		return new(big.Int).Mul(big.NewInt(int64(d.coef.Sign())), pow10(maxExactExponent))
+	}
+	if d.exp >= 0 {
+		return new(big.Int).Mul(d.coef, pow10(d.exp))
+	}
+	return new(big.Int).Quo(d.coef, pow10(-d.exp))
+}
+
+// align returns the coefficients of x and y scaled to a common exponent.
+// Callers must make sure the exponents are not too far apart.
+func align(x, y *DecimalNumber) (*big.Int, *big.Int, int) {
+	switch {
+	case x.exp > y.exp:
+		return new(big.Int).Mul(x.coef, pow10(x.exp-y.exp)), y.coef, y.exp
+	case y.exp > x.exp:
+		return x.coef, new(big.Int).Mul(y.coef, pow10(y.exp-x.exp)), x.exp
+	}
+	return x.coef, y.coef, x.exp
+}
+
+// negligible reports whether y is too small to change x at the working
+// precision.
+func (a *DecimalArithmetic) negligible(x, y *DecimalNumber) bool {
+	return x.coef.Sign() != 0 && x.adjustedExp()-y.adjustedExp() > a.Digits+2
+}
+
+func (a *DecimalArithmetic) Add(x, y Number) Number {
+	xd, yd := a.dec(x), a.dec(y)
+	switch {
+	case a.negligible(xd, yd):
+		return a.round(xd)
+	case a.negligible(yd, xd):
+		return a.round(yd)
+	}
+	xc, yc, exp := align(xd, yd)
+	return a.round(newDecimal(new(big.Int).Add(xc, yc), exp))
+}
+
+func (a *DecimalArithmetic) Sub(x, y Number) Number {
+	return a.Add(x, a.Neg(y))
+}
+
+func (a *DecimalArithmetic) Mul(x, y Number) Number {
+	xd, yd := a.dec(x), a.dec(y)
+	return a.round(newDecimal(new(big.Int).Mul(xd.coef, yd.coef), xd.exp+yd.exp))
+}
+
+func (a *DecimalArithmetic) Quo(x, y Number) (Number, error) {
+	xd, yd := a.dec(x), a.dec(y)
+	if yd.coef.Sign() == 0 {
+		return nil, ErrDivideByZero
+	}
+	// Scale the dividend so the integer quotient carries two guard digits
+	// beyond the working precision.
+	shift := a.Digits + yd.digits() - xd.digits() + 2
+	if shift < 0 {
+		shift = 0
+	}
+	num := new(big.Int).Mul(xd.coef, pow10(shift))
+	q, r := new(big.Int).QuoRem(num, yd.coef, new(big.Int))
+	exp := xd.exp - yd.exp - shift
+	if r.Sign() != 0 {
+		// Append a sticky digit so rounding sees the discarded remainder.
+		q.Mul(q, bigTen)
+		if num.Sign()*yd.coef.Sign() < 0 {
+			q.Sub(q, bigOne)
+		} else {
+			q.Add(q, bigOne)
+		}
+		exp--
+	}
+	return a.round(newDecimal(q, exp)), nil
+}
+
+// Mod returns the remainder of x/y with the sign of x, like math.Mod.
+func (a *DecimalArithmetic) Mod(x, y Number) (Number, error) {
+	xd, yd := a.dec(x), a.dec(y)
+	if yd.coef.Sign() == 0 {
+		return nil, ErrDivideByZero
+	}
+	if xd.adjustedExp()-yd.adjustedExp() > maxExactExponent {
+		return nil, ErrOverflow
+	}
+	if a.negligible(yd, xd) {
+		return xd, nil
+	}
+	xc, yc, exp := align(xd, yd)
+	return a.round(newDecimal(new(big.Int).Rem(xc, yc), exp)), nil
+}
+
+const maxExactExponent = 10000
+
+// Pow computes x^y. An integer y beyond maxExactExponent is computed
+// like a non-integer one, with the sign of a negative x from whether y is
+// odd.
+func (a *DecimalArithmetic) Pow(x, y Number) (Number, error) {
+	xd, yd := a.dec(x), a.dec(y)
+	odd := false
+	if isInteger(a, yd) {
+		n := a.Int(yd)
+		if n.IsInt64() && n.Int64() >= -maxExactExponent && n.Int64() <= maxExactExponent {
+			return a.powInt(xd, n.Int64())
+		}
+		odd = n.Bit(0) == 1
+	}
+	switch xd.coef.Sign() {
+	case 0:
+		if yd.coef.Sign() < 0 {
+			return nil, ErrDivideByZero
+		}
+		return xd, nil
+	case -1:
+		if !isInteger(a, yd) {
+			return nil, errDomain
+		}
+		xd = a.Neg(xd).(*DecimalNumber)
+	}
+	prec := floatPrec(a.Digits)
+	f, ok := floatPow(xd.float(prec), yd.float(prec))
+	if !ok {
+		return nil, ErrOverflow
+	}
+	if odd && a.Sign(x) < 0 {
+		f.Neg(f)
+	}
+	return a.fromFloat(f)
+}
+
+// fromFloat rounds f to the working precision.
+func (a *DecimalArithmetic) fromFloat(f *big.Float) (Number, error) {
+	zero, err := floatBeyondRange(f)
+	if err != nil {
+		return nil, err
+	}
+	if zero {
+		return a.FromInt(new(big.Int)), nil
+	}
+	return a.Parse(floatText(f, a.Digits+2))
+}
+
+func (a *DecimalArithmetic) powInt(x *DecimalNumber, n int64) (Number, error) {
+	neg := n < 0
+	if neg {
+		if x.coef.Sign() == 0 {
+			return nil, ErrDivideByZero
+		}
+		n = -n
+	}
+	work := &DecimalArithmetic{Digits: a.Digits + 5}
+	var result Number = work.FromInt(bigOne)
+	var base Number = x
+	for n > 0 {
+		if n&1 == 1 {
+			result = work.Mul(result, base)
+		}
+		base = work.Mul(base, base)
+		n >>= 1
+	}
+	if neg {
+		return a.Quo(work.FromInt(bigOne), result)
+	}
+	return a.round(result.(*DecimalNumber)), nil
+}
+
+func (a *DecimalArithmetic) Neg(x Number) Number {
+	d := a.dec(x)
+	return &DecimalNumber{coef: new(big.Int).Neg(d.coef), exp: d.exp}
+}
+
+func (a *DecimalArithmetic) Sign(x Number) int {
+	return a.dec(x).coef.Sign()
+}
+
+func (a *DecimalArithmetic) Cmp(x, y Number) int {
+	xd, yd := a.dec(x), a.dec(y)
+	if xd.coef.Sign() != yd.coef.Sign() {
+		return xd.coef.Sign() - yd.coef.Sign()
+	}
+	if xd.coef.Sign() != 0 && xd.adjustedExp() != yd.adjustedExp() {
+		if (xd.adjustedExp() > yd.adjustedExp()) == (xd.coef.Sign() > 0) {
+			return 1
+		}
+		return -1
+	}
+	xc, yc, _ := align(xd, yd)
+	return xc.Cmp(yc)
+}
+
+func (a *DecimalArithmetic) Floor(x Number) Number {
+	d := a.dec(x)
+	if d.exp >= 0 {
+		return d
+	}
+	if d.adjustedExp() < 0 {
+		if d.coef.Sign() < 0 {
+			return newDecimal(big.NewInt(-1), 0)
+		}
+		return newDecimal(new(big.Int), 0)
+	}
+	return newDecimal(new(big.Int).Div(d.coef, pow10(-d.exp)), 0)
+}
+
+func (a *DecimalArithmetic) Ceil(x Number) Number {
+	return a.Neg(a.Floor(a.Neg(x)))
+}
+
+// Round rounds half away from zero to an integer.
+func (a *DecimalArithmetic) Round(x Number) Number {
+	d := a.dec(x)
+	if d.exp >= 0 {
+		return d
+	}
+	if d.adjustedExp() < -1 {
+		return newDecimal(new(big.Int), 0)
+	}
+	return roundDecimal(d, d.adjustedExp()+1)
+}
+
+func (a *DecimalArithmetic) Sqrt(x Number) (Number, error) {
+	d := a.dec(x)
+	if d.coef.Sign() < 0 {
+		return nil, errDomain
+	}
+	f := d.float(floatPrec(a.Digits))
+	return a.fromFloat(f.Sqrt(f))
+}
@@ -2,8 +2,7 @@ package calculator
 
 import (
 	"fmt"
-	"math"
-	"strconv"
+	"math/big"
 	"strings"
 )
 
@@ -19,16 +18,94 @@ const (
 	OpPower
 )
 
+// Engine is the state of one calculator: the display, the expression or
+// RPN stack being entered, memory, variables and history. An Engine is not
+// safe for concurrent use, but separate engines share nothing, so each
+// goroutine or session can have its own.
 type Engine struct {
-	Display        string
-	CurrentValue   float64
-	StoredValue    float64
-	PendingOp      Operation
-	NewInput       bool
-	Memory         float64
-	History        []string
-	AngleMode      AngleMode
-	NumberBase     NumberBase
+	Display      string
+	CurrentValue Number
+	StoredValue  Number
+	PendingOp    Operation
+	NewInput     bool
+	Memory       Number
+	History      []HistoryEntry
+	HistoryLimit int
+	AngleMode    AngleMode
+	NumberBase   NumberBase
+	NumberMode   NumberMode
+	Precision    int
+
+	// Err is the error of the last operation if it failed, such as
+	// ErrDivideByZero or an ErrDomain. The display shows it, and input is
+	// ignored until Clear or ClearEntry. Recalling a value or loading an
+	// expression also clears it.
+	Err error
+
+	FractionDisplay FractionDisplay
+	ComplexDisplay  ComplexDisplay
+	DisplayFormat   DisplayFormat
+	DisplayDigits   int
+	SIPrefixes      bool
+
+	// Locale is how decimal numbers are written in the display and read
+	// from typed and pasted input.
+	Locale NumberLocale
+
+	// RPN selects Reverse Polish Notation entry, with a stack of
+	// StackDepth registers, or an unlimited one if it is 0.
+	RPN        bool
+	StackDepth int
+
+	// Programmer selects programmer mode, where results are integers
+	// fitted to a word of BitWidth bits, read as a two's complement
+	// integer if Signed. The programmer operations use the word in every
+	// mode.
+	Programmer bool
+	BitWidth   BitWidth
+	Signed     bool
+	// Saturate makes programmer arithmetic give the nearest value of the
+	// word to a result that does not fit, instead of wrapping around.
+	// Flags are the status flags of the last programmer result.
+	Saturate bool
+	Flags    Flags
+
+	arith Arithmetic
+
+	// carry and overflow are noted by the last word operation, and become
+	// Flags with its result.
+	carry    bool
+	overflow bool
+
+	// tokens holds the infix expression built so far from keypad input.
+	// The operand being entered stays in Display until an operator or
+	// parenthesis commits it.
+	tokens         []string
+	parenDepth     int
+	operandEntered bool
+
+	historyStore *HistoryStore
+
+	// variables holds the named values, and ans the last result.
+	variables map[string]Number
+	ans       Number
+
+	// userFunctions holds the functions defined by the user, and frames
+	// the calls to them being evaluated.
+	userFunctions map[string]*UserFunction
+	frames        []callFrame
+
+	// stack holds the RPN registers above X, which is CurrentValue, with
+	// Y first. It is replaced rather than changed in place, because undo
+	// snapshots share it. lastX is X before the last operation, and lift
+	// whether a new value pushes X up the stack.
+	stack []Number
+	lastX Number
+	lift  bool
+
+	undoStack []snapshot
+	redoStack []snapshot
+	inCall    bool
 }
 
 type AngleMode int
@@ -39,6 +116,30 @@ const (
 	Gradians
 )
 
+func (m AngleMode) String() string {
+	switch m {
+	case Radians:
+		return "rad"
+	case Gradians:
+		return "grad"
+	}
+	return "deg"
+}
+
+// ParseAngleMode reads an angle mode as String writes it, or spelt out
+// such as "radians".
+func ParseAngleMode(s string) (AngleMode, error) {
+	switch strings.ToLower(s) {
+	case "deg", "degrees":
+		return Degrees, nil
+	case "rad", "radians":
+		return Radians, nil
+	case "grad", "gradians", "gon":
+		return Gradians, nil
+	}
+	return Degrees, fmt.Errorf("unknown angle mode %q", s)
+}
+
 type NumberBase int
 
 const (
@@ -48,140 +149,467 @@ const (
 	Hexadecimal
 )
 
+func (b NumberBase) String() string {
+	switch b {
+	case Binary:
+		return "bin"
+	case Octal:
+		return "oct"
+	case Hexadecimal:
+		return "hex"
+	}
+	return "dec"
+}
+
+// ParseNumberBase reads a base as String writes it, spelt out such as
+// "hexadecimal", or as its radix such as "16".
+func ParseNumberBase(s string) (NumberBase, error) {
+	switch strings.ToLower(s) {
+	case "dec", "decimal", "10":
+		return Decimal, nil
+	case "bin", "binary", "2":
+		return Binary, nil
+	case "oct", "octal", "8":
+		return Octal, nil
+	case "hex", "hexadecimal", "16":
+		return Hexadecimal, nil
+	}
+	return Decimal, fmt.Errorf("unknown number base %q", s)
+}
+
 func NewEngine() *Engine {
-	return &Engine{
-		Display:    "0",
-		NewInput:   true,
-		AngleMode:  Degrees,
-		NumberBase: Decimal,
-		History:    make([]string, 0),
+	e := &Engine{
+		Display:      "0",
+		NewInput:     true,
+		AngleMode:    Degrees,
+		NumberBase:   Decimal,
+		History:      make([]HistoryEntry, 0),
+		HistoryLimit: DefaultHistoryLimit,
+
+		DisplayDigits: DefaultDisplayDigits,
+		Locale:        PlainLocale,
+		StackDepth:    DefaultStackDepth,
+		BitWidth:      Bits64,
+		Signed:        true,
 	}
+	e.SetPrecision(DefaultPrecision)
+	e.undoStack = nil
+	return e
 }
 
 func (e *Engine) Clear() {
+	defer e.checkpoint()()
+	e.Err = nil
 	e.Display = "0"
-	e.CurrentValue = 0
-	e.StoredValue = 0
+	e.CurrentValue = e.Zero()
+	e.StoredValue = e.Zero()
 	e.PendingOp = OpNone
 	e.NewInput = true
+	e.tokens = nil
+	e.parenDepth = 0
+	e.operandEntered = false
+	e.stack = nil
+	e.fillStack()
+	e.lift = false
+	e.Flags = Flags{}
+	e.carry, e.overflow = false, false
 }
 
+// ClearEntry clears the number being entered, or the error, and keeps the
+// expression so far.
 func (e *Engine) ClearEntry() {
+	defer e.checkpoint()()
+	e.Err = nil
 	e.Display = "0"
-	e.CurrentValue = 0
+	e.CurrentValue = e.Zero()
+	e.NewInput = true
+	e.operandEntered = false
+	e.lift = false
+}
+
+// EnterValue makes n the current value, as if it had been typed, clearing
+// any error. Unlike Execute it does not change ans or the history.
+func (e *Engine) EnterValue(n Number) {
+	defer e.checkpoint()()
+	e.Err = nil
+	e.liftStack()
+	e.CurrentValue = e.fit(n)
+	e.Display = e.formatNumber(n)
 	e.NewInput = true
+	e.operandEntered = true
 }
 
 func (e *Engine) InputDigit(digit string) {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	if e.imaginaryEntered() {
+		return
+	}
 	if e.NewInput {
-		e.Display = digit
+		e.liftStack()
+	}
+	entry := e.entry()
+	if e.NewInput {
+		entry = digit
 		e.NewInput = false
 	} else {
-		if e.Display == "0" && digit != "." {
-			e.Display = digit
+		if entry == "0" && digit != "." {
+			entry = digit
 		} else {
-			e.Display += digit
+			entry += digit
+		}
+		if !e.fitsWord(entry) {
+			return
 		}
 	}
-	e.CurrentValue, _ = strconv.ParseFloat(e.Display, 64)
+	e.setEntry(entry)
+	e.parseDisplay()
+	e.operandEntered = true
+}
+
+// entry returns the text being entered in the plain form, without the
+// locale's separators.
+func (e *Engine) entry() string {
+	if e.NumberBase != Decimal {
+		return e.Display
+	}
+	return e.Locale.delocalize(e.Display)
+}
+
+// setEntry shows the text being entered with the locale's separators.
+func (e *Engine) setEntry(entry string) {
+	if e.NumberBase != Decimal {
+		e.Display = entry
+		return
+	}
+	e.Display = e.Locale.localize(entry)
+}
+
+// fitsWord reports whether an entry in the current base fits in the word.
+// Decimal entries are not limited.
+func (e *Engine) fitsWord(entry string) bool {
+	if e.NumberBase == Decimal {
+		return true
+	}
+	_, err := e.ParseCurrentBase(entry)
+	return err == nil
+}
+
+// parseDisplay sets CurrentValue from the text being entered. Incomplete
+// entries such as "1e" read as zero until they are finished.
+func (e *Engine) parseDisplay() {
+	if e.NumberBase != Decimal {
+		val, _ := e.ParseCurrentBase(e.Display)
+		e.CurrentValue = e.intNumber(val)
+		return
+	}
+	val, err := e.arith.Parse(strings.TrimRight(e.entry(), "/ "))
+	if err != nil {
+		val = e.Zero()
+	}
+	e.CurrentValue = val
 }
 
 func (e *Engine) InputDecimal() {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	if e.imaginaryEntered() {
+		return
+	}
 	if e.NewInput {
-		e.Display = "0."
+		e.liftStack()
+		e.setEntry("0.")
 		e.NewInput = false
-	} else if !strings.Contains(e.Display, ".") {
-		e.Display += "."
+	} else if entry := e.entry(); !strings.Contains(entry, ".") {
+		e.setEntry(entry + ".")
 	}
+	e.operandEntered = true
 }
 
 func (e *Engine) InputExponent() {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	if e.imaginaryEntered() {
+		return
+	}
 	if e.NewInput {
+		e.liftStack()
 		e.Display = "1e"
 		e.NewInput = false
 	} else if !strings.Contains(strings.ToLower(e.Display), "e") {
 		e.Display += "e"
 	}
+	e.operandEntered = true
+}
+
+// InputFraction is the a b/c key: the first press starts the numerator of
+// a simple fraction (2/3), a second press turns what was typed into the
+// whole part of a mixed number (1 2/3).
+func (e *Engine) InputFraction() {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	if e.NumberMode != ModeFraction || e.NewInput {
+		return
+	}
+	switch {
+	case !strings.Contains(e.Display, "/"):
+		e.Display += "/"
+	case !strings.Contains(e.Display, " ") && !strings.HasSuffix(e.Display, "/"):
+		e.Display = strings.Replace(e.Display, "/", " ", 1) + "/"
+	}
+	e.operandEntered = true
+}
+
+func (e *Engine) CycleFractionDisplay() {
+	defer e.checkpoint()()
+	e.FractionDisplay = (e.FractionDisplay + 1) % 3
+	e.redisplay()
 }
 
 func (e *Engine) InputHexDigit(digit string) {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
 	if e.NumberBase != Hexadecimal {
 		return
 	}
 	if e.NewInput {
+		e.liftStack()
 		e.Display = digit
 		e.NewInput = false
 	} else {
 		if e.Display == "0" {
 			e.Display = digit
-		} else {
+		} else if e.fitsWord(e.Display + digit) {
 			e.Display += digit
 		}
 	}
-	val, _ := strconv.ParseInt(e.Display, 16, 64)
-	e.CurrentValue = float64(val)
+	e.parseDisplay()
+	e.operandEntered = true
 }
 
 func (e *Engine) SetOperation(op Operation) {
-	if e.PendingOp != OpNone && !e.NewInput {
-		e.Calculate()
+	if e.RPN {
+		e.applyStackOperation(op)
+		return
+	}
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	if e.bitwisePending() {
+		e.CalculateBitwise()
+	}
+	last := e.lastToken()
+	switch {
+	case isOperatorToken(last) && !e.operandEntered:
+		e.tokens[len(e.tokens)-1] = opSymbol(op)
+	case e.endsWithOperand() && !e.operandEntered:
+		e.tokens = append(e.tokens, opSymbol(op))
+	default:
+		e.tokens = append(e.tokens, e.operandText(), opSymbol(op))
 	}
 	e.StoredValue = e.CurrentValue
 	e.PendingOp = op
 	e.NewInput = true
+	e.operandEntered = false
 }
 
-func (e *Engine) Calculate() float64 {
-	if e.PendingOp == OpNone {
-		return e.CurrentValue
+func (e *Engine) OpenParen() {
+	defer e.checkpoint()()
+	if e.Err != nil || e.RPN {
+		return
+	}
+	if e.bitwisePending() {
+		e.CalculateBitwise()
 	}
+	if e.operandEntered || e.endsWithOperand() {
+		if e.operandEntered {
+			e.tokens = append(e.tokens, e.operandText())
+		}
+		e.tokens = append(e.tokens, opSymbol(OpMultiply))
+	}
+	e.tokens = append(e.tokens, "(")
+	e.parenDepth++
+	e.NewInput = true
+	e.operandEntered = false
+}
 
-	var result float64
-	switch e.PendingOp {
-	case OpAdd:
-		result = e.StoredValue + e.CurrentValue
-	case OpSubtract:
-		result = e.StoredValue - e.CurrentValue
-	case OpMultiply:
-		result = e.StoredValue * e.CurrentValue
-	case OpDivide:
-		if e.CurrentValue != 0 {
-			result = e.StoredValue / e.CurrentValue
-		} else {
-			e.Display = "Error"
-			e.NewInput = true
-			return 0
+func (e *Engine) CloseParen() {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	if e.parenDepth == 0 {
+		return
+	}
+	if e.operandEntered || !e.endsWithOperand() {
+		e.tokens = append(e.tokens, e.operandText())
+	}
+	e.tokens = append(e.tokens, ")")
+	e.parenDepth--
+
+	open := 0
+	for i, depth := len(e.tokens)-1, 0; i >= 0; i-- {
+		if e.tokens[i] == ")" {
+			depth++
+		} else if e.tokens[i] == "(" {
+			depth--
+			if depth == 0 {
+				open = i
+				break
+			}
 		}
-	case OpModulo:
-		if e.CurrentValue != 0 {
-			result = math.Mod(e.StoredValue, e.CurrentValue)
-		} else {
-			e.Display = "Error"
-			e.NewInput = true
-			return 0
+	}
+	if open > 0 && e.isFunction(e.tokens[open-1]) {
+		open--
+	}
+	if val, err := e.Evaluate(strings.Join(e.tokens[open:], " ")); err == nil {
+		e.CurrentValue = val
+		e.Display = e.formatNumber(val)
+	}
+	e.NewInput = true
+	e.operandEntered = false
+}
+
+// Expression returns the expression built so far, not including the
+// operand currently being entered.
+func (e *Engine) Expression() string {
+	var b strings.Builder
+	for i, tok := range e.tokens {
+		if i > 0 && tok != ")" && tok != "," && e.tokens[i-1] != "(" && !(tok == "(" && e.isFunction(e.tokens[i-1])) {
+			b.WriteByte(' ')
 		}
-	case OpPower:
-		result = math.Pow(e.StoredValue, e.CurrentValue)
+		b.WriteString(tok)
 	}
+	return b.String()
+}
 
-	historyEntry := fmt.Sprintf("%s %s %s = %s",
-		e.formatNumber(e.StoredValue),
-		e.opSymbol(e.PendingOp),
-		e.formatNumber(e.CurrentValue),
-		e.formatNumber(result))
-	e.History = append(e.History, historyEntry)
-	if len(e.History) > 50 {
-		e.History = e.History[1:]
+func (e *Engine) lastToken() string {
+	if len(e.tokens) == 0 {
+		return ""
 	}
+	return e.tokens[len(e.tokens)-1]
+}
 
-	e.CurrentValue = result
-	e.Display = e.formatNumber(result)
+// endsWithOperand reports whether the expression so far ends in something
+// that can take an operator: a closing parenthesis, or a number from a
+// loaded expression.
+func (e *Engine) endsWithOperand() bool {
+	last := e.lastToken()
+	return last != "" && last != "(" && last != "," && !isOperatorToken(last)
+}
+
+func isFunctionName(tok string) bool {
+	_, ok := functions[strings.ToLower(tok)]
+	return ok
+}
+
+// isFunction reports whether tok names a built-in or user function.
+func (e *Engine) isFunction(tok string) bool {
+	_, ok := e.userFunctions[tok]
+	return ok || isFunctionName(tok)
+}
+
+func isOperatorToken(tok string) bool {
+	switch tok {
+	case "+", "−", "×", "÷", "mod", "^":
+		return true
+	}
+	return false
+}
+
+func (e *Engine) operandText() string {
+	return e.literal(e.CurrentValue)
+}
+
+// literal writes n so that it reads back as the same number in an
+// expression.
+func (e *Engine) literal(n Number) string {
+	if c, ok := n.(*ComplexNumber); ok && !c.IsReal() {
+		return "(" + c.String() + ")"
+	}
+	neg := e.arith.Sign(n) < 0
+	if neg {
+		n = e.arith.Neg(n)
+	}
+	var text string
+	switch e.NumberBase {
+	case Binary:
+		text = "0b" + e.arith.Int(n).Text(2)
+	case Octal:
+		text = "0o" + e.arith.Int(n).Text(8)
+	case Hexadecimal:
+		text = "0x" + strings.ToUpper(e.arith.Int(n).Text(16))
+	default:
+		text = n.String()
+	}
+	if neg {
+		return "(-" + text + ")"
+	}
+	if strings.Contains(text, "/") {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// Calculate evaluates the expression entered so far. If that fails the
+// engine enters the error state and the error is returned. In RPN mode it
+// is Enter.
+func (e *Engine) Calculate() (Number, error) {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	if e.RPN {
+		e.Enter()
+		return e.CurrentValue, nil
+	}
+	if len(e.tokens) == 0 {
+		return e.CurrentValue, nil
+	}
+
+	if e.operandEntered || !e.endsWithOperand() {
+		e.tokens = append(e.tokens, e.operandText())
+	}
+	for ; e.parenDepth > 0; e.parenDepth-- {
+		e.tokens = append(e.tokens, ")")
+	}
+	expr := e.Expression()
+	e.tokens = nil
 	e.PendingOp = OpNone
 	e.NewInput = true
-	return result
+	e.operandEntered = false
+	e.carry, e.overflow = false, false
+
+	node, err := Parse(expr)
+	var result Number
+	if err == nil {
+		result, err = e.EvaluateNode(node)
+	}
+	e.addHistory(expressionEntry(expr, node), result, err)
+	if err != nil {
+		return nil, e.fail(err)
+	}
+
+	e.CurrentValue = e.fit(result)
+	e.Display = e.formatNumber(result)
+	if e.Programmer {
+		e.setFlags()
+	}
+	return e.CurrentValue, nil
 }
 
-func (e *Engine) opSymbol(op Operation) string {
+func opSymbol(op Operation) string {
 	switch op {
 	case OpAdd:
 		return "+"
@@ -199,93 +627,199 @@ func (e *Engine) opSymbol(op Operation) string {
 	return ""
 }
 
-func (e *Engine) formatNumber(n float64) string {
-	if e.NumberBase != Decimal {
-		return e.FormatInBase(int64(n))
+// redisplay shows the current value again after a display setting has
+// changed, unless an error is being shown.
+func (e *Engine) redisplay() {
+	if e.Err == nil {
+		e.Display = e.formatNumber(e.CurrentValue)
+	}
+	e.NewInput = true
+}
+
+// Format formats n as the display would show it.
+func (e *Engine) Format(n Number) string {
+	return e.formatNumber(n)
+}
+
+func (e *Engine) formatNumber(n Number) string {
+	if e.Programmer || e.NumberBase != Decimal {
+		return e.FormatInBase(e.intValue(n))
+	}
+	return e.Locale.localize(e.formatPlain(n))
+}
+
+// formatPlain shows a decimal-base n without the locale's separators.
+func (e *Engine) formatPlain(n Number) string {
+	if c, ok := n.(*ComplexNumber); ok {
+		return e.formatComplex(c.z)
+	}
+	if r, ok := n.(*RationalNumber); ok {
+		switch {
+		case r.digits > 0 || e.FractionDisplay == FractionDecimal:
+			// An inexact fraction, such as sqrt(2), is shown in decimal
+			// form, as it has no exact fraction to show.
+			n = NewDecimalArithmetic(e.Precision).Convert(r)
+		case e.FractionDisplay == FractionMixed:
+			return r.Mixed()
+		}
 	}
-	if n == float64(int64(n)) {
-		return fmt.Sprintf("%d", int64(n))
+	if d, ok := n.(*DecimalNumber); ok {
+		return e.formatDecimal(d)
 	}
-	formatted := fmt.Sprintf("%.10f", n)
-	formatted = strings.TrimRight(formatted, "0")
-	formatted = strings.TrimRight(formatted, ".")
-	return formatted
+	return n.String()
 }
 
 func (e *Engine) Negate() {
-	e.CurrentValue = -e.CurrentValue
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	e.CurrentValue = e.fit(e.arith.Neg(e.CurrentValue))
 	e.Display = e.formatNumber(e.CurrentValue)
+	e.operandEntered = true
 }
 
 func (e *Engine) Percent() {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	hundredth, _ := e.arith.Quo(e.CurrentValue, e.FromInt64(100))
+	if e.RPN {
+		// Y is kept, as the base of the percentage
+		e.lastX = e.CurrentValue
+		e.setX(e.arith.Mul(e.level(0), hundredth))
+		return
+	}
 	if e.PendingOp == OpAdd || e.PendingOp == OpSubtract {
-		e.CurrentValue = e.StoredValue * (e.CurrentValue / 100)
+		e.CurrentValue = e.arith.Mul(e.StoredValue, hundredth)
 	} else {
-		e.CurrentValue = e.CurrentValue / 100
+		e.CurrentValue = hundredth
 	}
 	e.Display = e.formatNumber(e.CurrentValue)
+	e.operandEntered = true
 }
 
 func (e *Engine) MemoryClear() {
-	e.Memory = 0
+	defer e.checkpoint()()
+	e.Memory = e.Zero()
 }
 
 func (e *Engine) MemoryRecall() {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	e.liftStack()
 	e.CurrentValue = e.Memory
 	e.Display = e.formatNumber(e.Memory)
 	e.NewInput = true
+	e.operandEntered = true
 }
 
 func (e *Engine) MemoryAdd() {
-	e.Memory += e.CurrentValue
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	e.Memory = e.arith.Add(e.Memory, e.CurrentValue)
 }
 
 func (e *Engine) MemorySubtract() {
-	e.Memory -= e.CurrentValue
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	e.Memory = e.arith.Sub(e.Memory, e.CurrentValue)
 }
 
 func (e *Engine) MemoryStore() {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
 	e.Memory = e.CurrentValue
 }
 
 func (e *Engine) Backspace() {
-	if len(e.Display) > 1 {
-		e.Display = e.Display[:len(e.Display)-1]
-		e.CurrentValue, _ = strconv.ParseFloat(e.Display, 64)
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	if entry := e.entry(); len(entry) > 1 {
+		e.setEntry(entry[:len(entry)-1])
+		e.parseDisplay()
 	} else {
 		e.Display = "0"
-		e.CurrentValue = 0
+		e.CurrentValue = e.Zero()
 	}
+	e.operandEntered = true
 }
 
 func (e *Engine) SetNumberBase(base NumberBase) {
-	intVal := int64(e.CurrentValue)
+	defer e.checkpoint()()
+	intVal := e.IntValue()
 	e.NumberBase = base
-	e.Display = e.FormatInBase(intVal)
+	if e.Err == nil {
+		e.Display = e.FormatInBase(intVal)
+	}
 }
 
-func (e *Engine) FormatInBase(n int64) string {
-	switch e.NumberBase {
-	case Binary:
-		return strconv.FormatInt(n, 2)
-	case Octal:
-		return strconv.FormatInt(n, 8)
-	case Hexadecimal:
-		return strings.ToUpper(strconv.FormatInt(n, 16))
-	default:
-		return strconv.FormatInt(n, 10)
+// FormatInBase writes n, fitted to the word, in the current base. In
+// decimal it is shown as a signed or unsigned integer, and in the other
+// bases as the bits of the word, so that -1 in an 8-bit word is FF.
+func (e *Engine) FormatInBase(n *big.Int) string {
+	return e.formatInt(n, e.NumberBase)
+}
+
+// FormatLoss describes what Format drops from n in programmer mode or a
+// base other than decimal, which show the integer part fitted to the
+// word, such as "the fraction" of 1.5 or "the bits beyond 64" of 2^64.
+// It is empty when n is shown exactly.
+func (e *Engine) FormatLoss(n Number) string {
+	if !e.Programmer && e.NumberBase == Decimal {
+		return ""
+	}
+	var lost []string
+	if c, ok := n.(*ComplexNumber); ok && !c.IsReal() {
+		lost = append(lost, "the imaginary part")
+	}
+	if !isInteger(e.arith, n) {
+		lost = append(lost, "the fraction")
+	}
+	// Outside decimal either reading of the word will do, since only its
+	// bits are shown.
+	i := e.arith.Int(n)
+	if e.wrap(i).Cmp(i) != 0 && (e.NumberBase == Decimal || e.bits(i).Cmp(i) != 0) {
+		lost = append(lost, fmt.Sprintf("the bits beyond %d", e.BitWidth))
 	}
+	return strings.Join(lost, " and ")
 }
 
-func (e *Engine) ParseCurrentBase(s string) (int64, error) {
+// ParseCurrentBase reads an integer in the current base. Outside decimal
+// it is the bits of the word, and too many of them is ErrOverflow.
+func (e *Engine) ParseCurrentBase(s string) (*big.Int, error) {
+	radix := 10
 	switch e.NumberBase {
 	case Binary:
-		return strconv.ParseInt(s, 2, 64)
+		radix = 2
 	case Octal:
-		return strconv.ParseInt(s, 8, 64)
+		radix = 8
 	case Hexadecimal:
-		return strconv.ParseInt(s, 16, 64)
-	default:
-		return strconv.ParseInt(s, 10, 64)
+		radix = 16
+	}
+	if radix != 10 && (strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+")) {
+		return nil, errInvalidNumber
+	}
+	n, ok := new(big.Int).SetString(s, radix)
+	if !ok {
+		return nil, errInvalidNumber
+	}
+	if radix == 10 {
+		return n, nil
+	}
+	if n.BitLen() > int(e.BitWidth) {
+		return nil, ErrOverflow
 	}
+	return e.wrap(n), nil
 }
@@ -0,0 +1,70 @@
+package calculator
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrDivideByZero is returned for a division, modulo or reciprocal
+	// of zero.
+	ErrDivideByZero = errors.New("division by zero")
+	// ErrOverflow is returned for a result too large to represent.
+	ErrOverflow = errors.New("overflow")
+)
+
+// ErrDomain is returned when a function or operator is given an input
+// outside its domain, such as the logarithm of a negative number.
+type ErrDomain struct {
+	// Func is the function or operator, such as "ln" or "^".
+	Func string
+	// Input is the input as displayed. The operands of an operator are
+	// separated by commas.
+	Input string
+}
+
+// domainConditions describes where each function or operator is
+// undefined, for the error message. It is filled from the Domain of the
+// registered operations.
+var domainConditions = map[string]string{}
+
+func (e ErrDomain) Error() string {
+	if cond, ok := domainConditions[e.Func]; ok {
+		return e.Func + " undefined for " + cond
+	}
+	return e.Func + " undefined for x = " + e.Input
+}
+
+// errDomain is returned by the arithmetic and the function
+// implementations, which do not know the name they were called by. The
+// engine turns it into an ErrDomain with domainError.
+var errDomain = errors.New("domain error")
+
+func (e *Engine) domainError(err error, fn string, inputs ...Number) error {
+	if err != errDomain {
+		return err
+	}
+	texts := make([]string, len(inputs))
+	for i, in := range inputs {
+		texts[i] = e.formatNumber(in)
+	}
+	return ErrDomain{Func: fn, Input: strings.Join(texts, ", ")}
+}
+
+// isCalculationError reports whether err came from evaluating an
+// expression that parsed, rather than from the expression itself.
+func isCalculationError(err error) bool {
+	var domain ErrDomain
+	return errors.Is(err, ErrDivideByZero) || errors.Is(err, ErrOverflow) || errors.As(err, &domain)
+}
+
+// fail enters the error state: the display shows err, and input is
+// ignored until Clear or ClearEntry.
+func (e *Engine) fail(err error) error {
+	e.Err = err
+	e.Display = err.Error()
+	e.CurrentValue = e.Zero()
+	e.NewInput = true
+	e.operandEntered = false
+	return err
+}
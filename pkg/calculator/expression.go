@@ -0,0 +1,571 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type TokenKind int
+
+const (
+	TokenNumber TokenKind = iota
+	TokenIdent
+	TokenOperator
+	TokenLParen
+	TokenRParen
+	TokenComma
+	TokenEOF
+)
+
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  int
+}
+
+// Tokenize splits an infix expression into tokens. The display symbols used
+// by the keypad (×, ÷, −, π) are accepted alongside their ASCII forms.
+func Tokenize(expr string) ([]Token, error) {
+	var tokens []Token
+	i := 0
+	for i < len(expr) {
+		r, size := utf8.DecodeRuneInString(expr[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9' || r == '.':
+			n, err := scanNumber(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at position %d", err, i)
+			}
+			tokens = append(tokens, Token{TokenNumber, expr[i : i+n], i})
+			i += n
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(expr) {
+				r, size := utf8.DecodeRuneInString(expr[i:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, Token{TokenIdent, expr[start:i], start})
+		case r == '(':
+			tokens = append(tokens, Token{TokenLParen, "(", i})
+			i += size
+		case r == ')':
+			tokens = append(tokens, Token{TokenRParen, ")", i})
+			i += size
+		case r == ',':
+			tokens = append(tokens, Token{TokenComma, ",", i})
+			i += size
+		case strings.ContainsRune("+-*/^%!=×÷−", r):
+			text := string(r)
+			switch r {
+			case '×':
+				text = "*"
+			case '÷':
+				text = "/"
+			case '−':
+				text = "-"
+			case '*':
+				if strings.HasPrefix(expr[i:], "**") {
+					text = "^"
+					size = 2
+				}
+			}
+			tokens = append(tokens, Token{TokenOperator, text, i})
+			i += size
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+		}
+	}
+	tokens = append(tokens, Token{TokenEOF, "", len(expr)})
+	return tokens, nil
+}
+
+func scanNumber(s string) (int, error) {
+	if len(s) > 2 && s[0] == '0' {
+		var valid func(byte) bool
+		switch s[1] {
+		case 'x', 'X':
+			valid = func(c byte) bool { return strings.IndexByte("0123456789abcdefABCDEF", c) >= 0 }
+		case 'b', 'B':
+			valid = func(c byte) bool { return c == '0' || c == '1' }
+		case 'o', 'O':
+			valid = func(c byte) bool { return c >= '0' && c <= '7' }
+		}
+		if valid != nil {
+			n := 2
+			for n < len(s) && valid(s[n]) {
+				n++
+			}
+			if n == 2 {
+				return 0, errors.New("malformed number")
+			}
+			return n, nil
+		}
+	}
+
+	n := 0
+	digits := 0
+	for n < len(s) && (s[n] >= '0' && s[n] <= '9') {
+		n++
+		digits++
+	}
+	if n < len(s) && s[n] == '.' {
+		n++
+		for n < len(s) && (s[n] >= '0' && s[n] <= '9') {
+			n++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, errors.New("malformed number")
+	}
+	if n < len(s) && (s[n] == 'e' || s[n] == 'E') {
+		m := n + 1
+		if m < len(s) && (s[m] == '+' || s[m] == '-') {
+			m++
+		}
+		if m < len(s) && s[m] >= '0' && s[m] <= '9' {
+			for m < len(s) && s[m] >= '0' && s[m] <= '9' {
+				m++
+			}
+			n = m
+		}
+	}
+	if n < len(s) && s[n] == '.' {
+		return 0, errors.New("malformed number")
+	}
+	return n, nil
+}
+
+// Node is an element of a parsed expression tree.
+type Node interface {
+	String() string
+}
+
+type NumberNode struct {
+	Text string
+}
+
+type IdentNode struct {
+	Name string
+}
+
+type UnaryNode struct {
+	Op      string
+	Operand Node
+}
+
+type BinaryNode struct {
+	Op    Operation
+	Left  Node
+	Right Node
+}
+
+type CallNode struct {
+	Name string
+	Args []Node
+}
+
+type FactorialNode struct {
+	Operand Node
+}
+
+// AssignNode is a variable assignment such as "rate = 0.0375". It is
+// only allowed as a whole expression.
+type AssignNode struct {
+	Name  string
+	Value Node
+}
+
+// DefineNode is a function definition such as "f(x) = 3x^2 + 2x - 1". Like
+// an assignment it is only allowed as a whole expression, and BodyText
+// keeps the body as it was written.
+type DefineNode struct {
+	Name     string
+	Params   []string
+	Body     Node
+	BodyText string
+}
+
+func (n *NumberNode) String() string    { return n.Text }
+func (n *IdentNode) String() string     { return n.Name }
+func (n *UnaryNode) String() string     { return "(" + n.Op + n.Operand.String() + ")" }
+func (n *FactorialNode) String() string { return "(" + n.Operand.String() + "!)" }
+func (n *AssignNode) String() string    { return n.Name + " = " + n.Value.String() }
+
+func (n *DefineNode) String() string {
+	return n.Name + "(" + strings.Join(n.Params, ", ") + ") = " + n.Body.String()
+}
+
+func (n *BinaryNode) String() string {
+	return "(" + n.Left.String() + " " + opSymbol(n.Op) + " " + n.Right.String() + ")"
+}
+
+func (n *CallNode) String() string {
+	args := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = arg.String()
+	}
+	return n.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+type binaryOperator struct {
+	op         Operation
+	precedence int
+	rightAssoc bool
+}
+
+var binaryOperators = map[string]binaryOperator{
+	"+":   {OpAdd, 1, false},
+	"-":   {OpSubtract, 1, false},
+	"*":   {OpMultiply, 2, false},
+	"/":   {OpDivide, 2, false},
+	"%":   {OpModulo, 2, false},
+	"mod": {OpModulo, 2, false},
+	"^":   {OpPower, 4, true},
+}
+
+// Unary minus binds tighter than multiplication but looser than powers, so
+// -2^2 is -4 and 2*-3 is -6.
+const unaryPrecedence = 3
+
+type parser struct {
+	tokens []Token
+	pos    int
+}
+
+// Parse builds an expression tree from infix text using precedence climbing.
+func Parse(expr string) (Node, error) {
+	tokens, err := Tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().Kind == TokenEOF {
+		return nil, errors.New("empty expression")
+	}
+	var assign *AssignNode
+	define := p.definition()
+	if define == nil && len(tokens) > 2 && tokens[0].Kind == TokenIdent && tokens[1].Text == "=" {
+		assign = &AssignNode{Name: tokens[0].Text}
+		p.pos = 2
+	}
+	if define != nil && p.peek().Kind != TokenEOF {
+		define.BodyText = strings.TrimSpace(expr[p.peek().Pos:])
+	}
+	node, err := p.parseExpr(1)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.Kind != TokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.Text, tok.Pos)
+	}
+	switch {
+	case assign != nil:
+		assign.Value = node
+		return assign, nil
+	case define != nil:
+		define.Body = node
+		return define, nil
+	}
+	return node, nil
+}
+
+// definition reads the head of a function definition, "name(a, b) =", and
+// leaves p after the "=". Otherwise it returns nil and leaves p alone.
+func (p *parser) definition() *DefineNode {
+	tokens := p.tokens
+	if len(tokens) < 5 || tokens[0].Kind != TokenIdent || tokens[1].Kind != TokenLParen {
+		return nil
+	}
+	define := &DefineNode{Name: tokens[0].Text}
+	i := 2
+	for {
+		if tokens[i].Kind != TokenIdent {
+			return nil
+		}
+		define.Params = append(define.Params, tokens[i].Text)
+		i++
+		if tokens[i].Kind != TokenComma {
+			break
+		}
+		i++
+	}
+	if tokens[i].Kind != TokenRParen || tokens[i+1].Text != "=" {
+		return nil
+	}
+	p.pos = i + 2
+	return define
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() Token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != TokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) binaryOperator() (binaryOperator, bool) {
+	tok := p.peek()
+	if tok.Kind != TokenOperator && tok.Kind != TokenIdent {
+		return binaryOperator{}, false
+	}
+	op, ok := binaryOperators[strings.ToLower(tok.Text)]
+	return op, ok
+}
+
+// startsOperand reports whether the next token can begin an operand that
+// directly follows another one, which is read as implicit multiplication
+// (2π, 3x, 2(1+1)). Two numbers side by side, as in "2 3", are not.
+func (p *parser) startsOperand() bool {
+	switch tok := p.peek(); tok.Kind {
+	case TokenNumber:
+		return p.pos == 0 || p.tokens[p.pos-1].Kind != TokenNumber
+	case TokenLParen:
+		return true
+	case TokenIdent:
+		_, isOp := binaryOperators[strings.ToLower(tok.Text)]
+		return !isOp
+	}
+	return false
+}
+
+func (p *parser) parseExpr(minPrec int) (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.binaryOperator()
+		if !ok {
+			if minPrec > 2 || !p.startsOperand() {
+				return left, nil
+			}
+			op = binaryOperator{op: OpMultiply, precedence: 2}
+		} else {
+			if op.precedence < minPrec {
+				return left, nil
+			}
+			p.next()
+		}
+		nextMin := op.precedence + 1
+		if op.rightAssoc {
+			nextMin = op.precedence
+		}
+		right, err := p.parseExpr(nextMin)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Op: op.op, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	tok := p.peek()
+	if tok.Kind == TokenOperator && (tok.Text == "-" || tok.Text == "+") {
+		p.next()
+		operand, err := p.parseExpr(unaryPrecedence)
+		if err != nil {
+			return nil, err
+		}
+		if tok.Text == "+" {
+			return operand, nil
+		}
+		return &UnaryNode{Op: "-", Operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (Node, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().Kind == TokenOperator && p.peek().Text == "!" {
+		p.next()
+		node = &FactorialNode{Operand: node}
+	}
+	return node, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	tok := p.next()
+	switch tok.Kind {
+	case TokenNumber:
+		return &NumberNode{Text: tok.Text}, nil
+	case TokenIdent:
+		if p.peek().Kind != TokenLParen {
+			return &IdentNode{Name: tok.Text}, nil
+		}
+		p.next()
+		call := &CallNode{Name: tok.Text}
+		if p.peek().Kind == TokenRParen {
+			p.next()
+			return call, nil
+		}
+		for {
+			arg, err := p.parseExpr(1)
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if p.peek().Kind == TokenComma {
+				p.next()
+				continue
+			}
+			if p.next().Kind != TokenRParen {
+				return nil, fmt.Errorf("missing ) after arguments to %s", tok.Text)
+			}
+			return call, nil
+		}
+	case TokenLParen:
+		node, err := p.parseExpr(1)
+		if err != nil {
+			return nil, err
+		}
+		if p.next().Kind != TokenRParen {
+			return nil, fmt.Errorf("missing ) for ( at position %d", tok.Pos)
+		}
+		return node, nil
+	case TokenEOF:
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.Text, tok.Pos)
+}
+
+// Evaluate parses and evaluates expr using the engine's arithmetic and
+// angle mode. It does not change the engine state, except that an
+// assignment sets its variable.
+func (e *Engine) Evaluate(expr string) (Number, error) {
+	defer func(carry, overflow bool) { e.carry, e.overflow = carry, overflow }(e.carry, e.overflow)
+	node, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return e.EvaluateNode(node)
+}
+
+func (e *Engine) EvaluateNode(node Node) (Number, error) {
+	switch n := node.(type) {
+	case *NumberNode:
+		val, err := e.parseLiteral(n.Text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", n.Text)
+		}
+		return val, nil
+	case *IdentNode:
+		if c, ok := expressionConstants[strings.ToLower(n.Name)]; ok {
+			return c.Value(e), nil
+		}
+		if n.Name == "i" && e.NumberMode == ModeComplex {
+			return newComplex(1i), nil
+		}
+		if val, ok := e.argument(n.Name); ok {
+			return val, nil
+		}
+		if val, ok := e.Variable(n.Name); ok {
+			return val, nil
+		}
+		return nil, fmt.Errorf("unknown name %q", n.Name)
+	case *AssignNode:
+		val, err := e.EvaluateNode(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.SetVariable(n.Name, val); err != nil {
+			return nil, err
+		}
+		return val, nil
+	case *DefineNode:
+		return nil, fmt.Errorf("%s can only be defined on its own", n.Name)
+	case *UnaryNode:
+		val, err := e.EvaluateNode(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return e.arith.Neg(val), nil
+	case *FactorialNode:
+		val, err := e.EvaluateNode(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return e.callFunction("fact", val)
+	case *BinaryNode:
+		left, err := e.EvaluateNode(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.EvaluateNode(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return e.applyOperation(n.Op, left, right)
+	case *CallNode:
+		name := strings.ToLower(n.Name)
+		f, user := e.userFunctions[n.Name]
+		if _, ok := functions[name]; !ok && !user {
+			return nil, fmt.Errorf("unknown function %q", n.Name)
+		}
+		args := make([]Number, len(n.Args))
+		for i, argNode := range n.Args {
+			arg, err := e.EvaluateNode(argNode)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = arg
+		}
+		if user {
+			return e.callUserFunction(f, args)
+		}
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s takes 1 argument, got %d", n.Name, len(args))
+		}
+		return e.callFunction(name, args[0])
+	}
+	return nil, fmt.Errorf("unsupported expression %s", node)
+}
+
+// applyOperation computes x op y. In programmer mode addition,
+// subtraction and multiplication are done in the word.
+func (e *Engine) applyOperation(op Operation, x, y Number) (Number, error) {
+	if e.Programmer && (op == OpAdd || op == OpSubtract || op == OpMultiply) {
+		return e.intNumber(e.wordOperation(op, e.intValue(x), e.intValue(y))), nil
+	}
+	var result Number
+	var err error
+	switch op {
+	case OpAdd:
+		result = e.arith.Add(x, y)
+	case OpSubtract:
+		result = e.arith.Sub(x, y)
+	case OpMultiply:
+		result = e.arith.Mul(x, y)
+	case OpDivide:
+		result, err = e.arith.Quo(x, y)
+	case OpModulo:
+		result, err = e.arith.Mod(x, y)
+	case OpPower:
+		result, err = e.arith.Pow(x, y)
+	default:
+		return nil, fmt.Errorf("unsupported operation %d", op)
+	}
+	if err == nil {
+		result, err = e.checkRange(result)
+	}
+	if err != nil {
+		return nil, e.domainError(err, opSymbol(op), x, y)
+	}
+	return result, nil
+}
@@ -0,0 +1,367 @@
+package calculator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FloatFormat is an IEEE 754 binary floating-point format, as stored in
+// memory by programs and GPUs.
+type FloatFormat int
+
+const (
+	// Float16 is half precision: 5 exponent and 10 mantissa bits.
+	Float16 FloatFormat = iota
+	// BFloat16 is the brain float: float32 cut to 16 bits, with 8
+	// exponent and 7 mantissa bits.
+	BFloat16
+	// Float32 is single precision: 8 exponent and 23 mantissa bits.
+	Float32
+	// Float64 is double precision: 11 exponent and 52 mantissa bits.
+	Float64
+)
+
+// FloatFormats are the formats in the order the float view lists them.
+var FloatFormats = []FloatFormat{Float16, BFloat16, Float32, Float64}
+
+func (f FloatFormat) String() string {
+	switch f {
+	case BFloat16:
+		return "bf16"
+	case Float32:
+		return "f32"
+	case Float64:
+		return "f64"
+	}
+	return "f16"
+}
+
+// ParseFloatFormat reads a format as String writes it, or by a common
+// name such as "half", "single" or "float64".
+func ParseFloatFormat(s string) (FloatFormat, error) {
+	switch strings.ToLower(s) {
+	case "f16", "half", "float16", "fp16", "binary16":
+		return Float16, nil
+	case "bf16", "bfloat16":
+		return BFloat16, nil
+	case "f32", "single", "float", "float32", "fp32", "binary32":
+		return Float32, nil
+	case "f64", "double", "float64", "fp64", "binary64":
+		return Float64, nil
+	}
+	return Float16, fmt.Errorf("unknown float format %q", s)
+}
+
+// Bits returns the size of the format in bits.
+func (f FloatFormat) Bits() int {
+	return 1 + f.ExponentBits() + f.MantissaBits()
+}
+
+// ExponentBits returns the size of the exponent field.
+func (f FloatFormat) ExponentBits() int {
+	switch f {
+	case Float16:
+		return 5
+	case Float64:
+		return 11
+	}
+	return 8
+}
+
+// MantissaBits returns the size of the mantissa field, without the
+// implicit leading bit.
+func (f FloatFormat) MantissaBits() int {
+	switch f {
+	case Float16:
+		return 10
+	case BFloat16:
+		return 7
+	case Float64:
+		return 52
+	}
+	return 23
+}
+
+// Bias is the exponent bias of the format.
+func (f FloatFormat) Bias() int {
+	return 1<<(f.ExponentBits()-1) - 1
+}
+
+// FloatClass is the kind of value a bit pattern holds.
+type FloatClass int
+
+const (
+	FloatZero FloatClass = iota
+	FloatSubnormal
+	FloatNormal
+	FloatInfinite
+	FloatNaN
+)
+
+func (c FloatClass) String() string {
+	switch c {
+	case FloatSubnormal:
+		return "subnormal"
+	case FloatNormal:
+		return "normal"
+	case FloatInfinite:
+		return "infinity"
+	case FloatNaN:
+		return "NaN"
+	}
+	return "zero"
+}
+
+// FloatBits is a floating-point value as its bit pattern in a format.
+type FloatBits struct {
+	Format FloatFormat
+	Bits   uint64
+}
+
+// EncodeFloat returns x in format f, rounded to the nearest value with
+// ties to even. Values too large for the format become infinities, and
+// a NaN keeps as much of its payload as fits.
+func EncodeFloat(x float64, f FloatFormat) FloatBits {
+	if f == Float64 {
+		return FloatBits{f, math.Float64bits(x)}
+	}
+	eb, mb := f.ExponentBits(), f.MantissaBits()
+	b := math.Float64bits(x)
+	sign := b >> 63 << (eb + mb)
+	exp := int(b >> 52 & 0x7FF)
+	mant := b & (1<<52 - 1)
+	maxExp := uint64(1<<eb - 1)
+	switch {
+	case exp == 0x7FF:
+		m := mant >> (52 - mb)
+		if mant != 0 && m == 0 {
+			// A payload only in the low bits would read as infinity
+			m = 1 << (mb - 1)
+		}
+		return FloatBits{f, sign | maxExp<<mb | m}
+	case exp == 0 && mant == 0:
+		return FloatBits{f, sign}
+	}
+
+	// x is sig × 2^e2, and the result T × 2^q with T of mb+1 bits, or
+	// fewer for a subnormal.
+	sig, e2 := mant|1<<52, exp-1075
+	if exp == 0 {
+		sig, e2 = mant, -1074
+	}
+	top := e2 + bitLen(sig) - 1
+	q := max(top-mb, 1-f.Bias()-mb)
+	shift := q - e2
+	var t uint64
+	if shift < 64 {
+		t = sig >> shift
+		rem, half := sig&(1<<shift-1), uint64(1)<<(shift-1)
+		if rem > half || rem == half && t&1 == 1 {
+			t++
+		}
+	}
+	if t >= 1<<(mb+1) {
+		t >>= 1
+		q++
+	}
+	if t < 1<<mb {
+		return FloatBits{f, sign | t}
+	}
+	biased := uint64(q + mb + f.Bias())
+	if biased >= maxExp {
+		return FloatBits{f, sign | maxExp<<mb}
+	}
+	return FloatBits{f, sign | biased<<mb | t&(1<<mb-1)}
+}
+
+func bitLen(x uint64) int {
+	n := 0
+	for ; x != 0; x >>= 1 {
+		n++
+	}
+	return n
+}
+
+// ParseFloatBits reads a decimal number, such as -0.15625, 1e-8 or inf,
+// and rounds it to format f.
+func ParseFloatBits(s string, f FloatFormat) (FloatBits, error) {
+	if f == Float32 {
+		// Round once, from the decimal, rather than through float64
+		x, err := strconv.ParseFloat(s, 32)
+		if err != nil && !isRangeError(err) {
+			return FloatBits{}, errInvalidNumber
+		}
+		return FloatBits{f, uint64(math.Float32bits(float32(x)))}, nil
+	}
+	x, err := strconv.ParseFloat(s, 64)
+	if err != nil && !isRangeError(err) {
+		return FloatBits{}, errInvalidNumber
+	}
+	if math.IsNaN(x) {
+		// The default quiet NaN, where Go's has a payload of 1
+		x = math.Float64frombits(0x7FF8 << 48)
+	}
+	return EncodeFloat(x, f), nil
+}
+
+// isRangeError reports whether strconv gave up on a number too large or
+// small for the format, where it still returns ±Inf or 0.
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
+
+// ReadFloatPattern reads a bit pattern written in hex, such as 0x3E200000,
+// in the formats of its width, counting leading zeros: up to 4 digits is
+// f16 and bf16, up to 8 is f32 and up to 16 is f64.
+func ReadFloatPattern(s string) ([]FloatBits, error) {
+	digits, ok := strings.CutPrefix(strings.ToLower(s), "0x")
+	if !ok || digits == "" {
+		return nil, errInvalidNumber
+	}
+	bits, err := strconv.ParseUint(digits, 16, 64)
+	if err != nil {
+		return nil, errInvalidNumber
+	}
+	switch {
+	case len(digits) <= 4:
+		return []FloatBits{{Float16, bits}, {BFloat16, bits}}, nil
+	case len(digits) <= 8:
+		return []FloatBits{{Float32, bits}}, nil
+	}
+	return []FloatBits{{Float64, bits}}, nil
+}
+
+// InspectFloat reads text for the float view: a hex bit pattern is read
+// back as the formats of its width, and a decimal number is shown in
+// every format.
+func InspectFloat(text string) ([]FloatBits, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(strings.ToLower(text), "0x") {
+		return ReadFloatPattern(text)
+	}
+	var all []FloatBits
+	for _, f := range FloatFormats {
+		b, err := ParseFloatBits(text, f)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, b)
+	}
+	return all, nil
+}
+
+// Sign returns the sign bit.
+func (b FloatBits) Sign() int {
+	return int(b.Bits >> (b.Format.Bits() - 1) & 1)
+}
+
+// BiasedExponent returns the exponent field as stored.
+func (b FloatBits) BiasedExponent() int {
+	return int(b.Bits >> b.Format.MantissaBits() & (1<<b.Format.ExponentBits() - 1))
+}
+
+// Exponent returns the power of two the significand is scaled by. For
+// zero and subnormals it is that of the smallest normal number, and for
+// infinities and NaNs that of the field as stored.
+func (b FloatBits) Exponent() int {
+	if b.BiasedExponent() == 0 {
+		return 1 - b.Format.Bias()
+	}
+	return b.BiasedExponent() - b.Format.Bias()
+}
+
+// Mantissa returns the mantissa field, without the implicit leading bit.
+func (b FloatBits) Mantissa() uint64 {
+	return b.Bits & (1<<b.Format.MantissaBits() - 1)
+}
+
+// Class returns the kind of value the pattern holds.
+func (b FloatBits) Class() FloatClass {
+	maxExp := 1<<b.Format.ExponentBits() - 1
+	switch exp, mant := b.BiasedExponent(), b.Mantissa(); {
+	case exp == maxExp && mant == 0:
+		return FloatInfinite
+	case exp == maxExp:
+		return FloatNaN
+	case exp == 0 && mant == 0:
+		return FloatZero
+	case exp == 0:
+		return FloatSubnormal
+	}
+	return FloatNormal
+}
+
+// Quiet reports whether a NaN is quiet, with the top mantissa bit set,
+// rather than signaling.
+func (b FloatBits) Quiet() bool {
+	return b.Mantissa()>>(b.Format.MantissaBits()-1) == 1
+}
+
+// Payload returns the mantissa bits of a NaN below the quiet bit.
+func (b FloatBits) Payload() uint64 {
+	return b.Mantissa() & (1<<(b.Format.MantissaBits()-1) - 1)
+}
+
+// Float64 returns the value of the pattern. It is exact, as float64 holds
+// every value of the smaller formats.
+func (b FloatBits) Float64() float64 {
+	mb := b.Format.MantissaBits()
+	sign := 1.0
+	if b.Sign() == 1 {
+		sign = -1
+	}
+	switch b.Class() {
+	case FloatNaN:
+		return math.Float64frombits(uint64(b.Sign())<<63 | 0x7FF<<52 | b.Mantissa()<<(52-mb))
+	case FloatInfinite:
+		return math.Inf(1 - 2*b.Sign())
+	case FloatNormal:
+		return sign * math.Ldexp(float64(b.Mantissa()|1<<mb), b.Exponent()-mb)
+	}
+	return sign * math.Ldexp(float64(b.Mantissa()), b.Exponent()-mb)
+}
+
+// Hex writes the pattern in hex with every digit of the format.
+func (b FloatBits) Hex() string {
+	return fmt.Sprintf("0x%0*X", b.Format.Bits()/4, b.Bits)
+}
+
+// ValueString writes the value of the pattern, naming the special ones:
+// "-0", "+Inf", "NaN (quiet, payload 0x1)", or the value with
+// "(subnormal)" after it.
+func (b FloatBits) ValueString() string {
+	sign := "+"
+	if b.Sign() == 1 {
+		sign = "-"
+	}
+	switch b.Class() {
+	case FloatZero:
+		return sign + "0"
+	case FloatInfinite:
+		return sign + "Inf"
+	case FloatNaN:
+		kind := "signaling"
+		if b.Quiet() {
+			kind = "quiet"
+		}
+		return fmt.Sprintf("%sNaN (%s, payload 0x%X)", sign, kind, b.Payload())
+	}
+	size := 64
+	if b.Format == Float32 {
+		size = 32
+	}
+	text := strconv.FormatFloat(b.Float64(), 'g', -1, size)
+	if b.Class() == FloatSubnormal {
+		text += " (subnormal)"
+	}
+	return text
+}
+
+// FloatPattern writes the word as a hex bit pattern with every digit of
+// the width, such as 0x3E200000, for InspectFloat to read back.
+func (e *Engine) FloatPattern() string {
+	return fmt.Sprintf("0x%0*X", (int(e.BitWidth)+3)/4, e.bits(e.IntValue()))
+}
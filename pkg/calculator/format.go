@@ -0,0 +1,248 @@
+package calculator
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DisplayFormat is the notation decimal results are shown in.
+type DisplayFormat int
+
+const (
+	// FormatAuto shows every digit of the working precision, in plain
+	// notation unless the value is very small or has more integer digits
+	// than the precision, which would be padded with zeros.
+	FormatAuto DisplayFormat = iota
+	// FormatFixed shows DisplayDigits digits after the point.
+	FormatFixed
+	// FormatScientific shows one digit before the point and DisplayDigits
+	// after it, with an exponent.
+	FormatScientific
+	// FormatEngineering is like FormatScientific with the exponent a
+	// multiple of 3, optionally written as an SI prefix.
+	FormatEngineering
+	// FormatSignificant shows DisplayDigits significant digits.
+	FormatSignificant
+)
+
+func (f DisplayFormat) String() string {
+	switch f {
+	case FormatFixed:
+		return "FIX"
+	case FormatScientific:
+		return "SCI"
+	case FormatEngineering:
+		return "ENG"
+	case FormatSignificant:
+		return "SIG"
+	}
+	return "AUTO"
+}
+
+// ParseDisplayFormat reads a display format as String writes it, in
+// either case, or spelt out such as "scientific".
+func ParseDisplayFormat(s string) (DisplayFormat, error) {
+	switch strings.ToLower(s) {
+	case "auto":
+		return FormatAuto, nil
+	case "fix", "fixed":
+		return FormatFixed, nil
+	case "sci", "scientific":
+		return FormatScientific, nil
+	case "eng", "engineering":
+		return FormatEngineering, nil
+	case "sig", "significant":
+		return FormatSignificant, nil
+	}
+	return FormatAuto, fmt.Errorf("unknown display format %q", s)
+}
+
+// DefaultDisplayDigits is the number of digits for the formats other than
+// FormatAuto until SetDisplayFormat is called.
+const DefaultDisplayDigits = 4
+
+// siPrefixes are the SI prefixes for the exponents -24 to 24 in steps of 3.
+var siPrefixes = []string{"y", "z", "a", "f", "p", "n", "µ", "m", "", "k", "M", "G", "T", "P", "E", "Z", "Y"}
+
+// SetDisplayFormat sets the notation results are shown in, and for the
+// formats other than FormatAuto the number of digits: after the point for
+// FIX, SCI and ENG, or significant for SIG. The digits are at most the
+// working precision, as no more of them are known.
+func (e *Engine) SetDisplayFormat(format DisplayFormat, digits int) {
+	defer e.checkpoint()()
+	e.DisplayFormat = format
+	e.DisplayDigits = min(max(digits, 0), e.Precision)
+	e.redisplay()
+}
+
+// SetSIPrefixes chooses whether the ENG format writes exponents as SI
+// prefixes, such as 4.7k for 4.7e3.
+func (e *Engine) SetSIPrefixes(on bool) {
+	defer e.checkpoint()()
+	e.SIPrefixes = on
+	e.redisplay()
+}
+
+// formatDecimal shows d in the display format. A value that cannot be
+// shown in FIX, because it is too large or would round to zero, is shown
+// in SCI instead.
+func (e *Engine) formatDecimal(d *DecimalNumber) string {
+	n := e.DisplayDigits
+	switch e.DisplayFormat {
+	case FormatFixed:
+		sig := d.adjustedExp() + 1 + n
+		roundsToZero := sig < 0 || sig == 0 && roundDecimal(d, 0).coef.Sign() == 0
+		if d.coef.Sign() != 0 && (d.adjustedExp() >= e.Precision || roundsToZero) {
+			return formatScientific(d, n)
+		}
+		return formatFixed(d, n)
+	case FormatScientific:
+		return formatScientific(d, n)
+	case FormatEngineering:
+		return formatEngineering(d, n, e.SIPrefixes)
+	case FormatSignificant:
+		n = max(n, 1)
+		if d.coef.Sign() == 0 {
+			return formatFixed(d, n-1)
+		}
+		r := roundDecimal(d, n)
+		adj := r.adjustedExp()
+		if adj < -5 || adj >= n {
+			return formatScientific(d, n-1)
+		}
+		return formatFixed(r, n-1-adj)
+	}
+	if d.coef.Sign() != 0 && d.adjustedExp() >= e.Precision {
+		return d.Scientific()
+	}
+	return d.String()
+}
+
+// formatFixed writes d rounded to places digits after the point.
+func formatFixed(d *DecimalNumber, places int) string {
+	if d.coef.Sign() != 0 {
+		if sig := d.adjustedExp() + 1 + places; sig >= 0 {
+			d = roundDecimal(d, sig)
+		} else {
+			d = newDecimal(new(big.Int), 0)
+		}
+	}
+	neg := d.coef.Sign() < 0
+	digits := new(big.Int).Abs(d.coef).String()
+	if d.exp > 0 {
+		digits += strings.Repeat("0", d.exp)
+	}
+	// Pad so the digits run to exactly places after the point.
+	scale := -min(d.exp, 0)
+	if places > scale {
+		digits += strings.Repeat("0", places-scale)
+	}
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+	s := digits
+	if places > 0 {
+		point := len(digits) - places
+		s = digits[:point] + "." + digits[point:]
+	}
+	if neg {
+		return "-" + s
+	}
+	return s
+}
+
+// mantissa rounds d to sig significant digits and returns the rounded
+// value with its exponent.
+func mantissa(d *DecimalNumber, sig int) (*DecimalNumber, int) {
+	if d.coef.Sign() == 0 {
+		return d, 0
+	}
+	r := roundDecimal(d, sig)
+	return r, r.adjustedExp()
+}
+
+func formatScientific(d *DecimalNumber, places int) string {
+	r, exp := mantissa(d, places+1)
+	return formatFixed(newDecimal(r.coef, r.exp-exp), places) + "e" + strconv.Itoa(exp)
+}
+
+func formatEngineering(d *DecimalNumber, places int, prefixes bool) string {
+	var r *DecimalNumber
+	exp := 0
+	if d.coef.Sign() != 0 {
+		// Rounding can carry into a new power of ten, which may move the
+		// value to the next multiple of 3.
+		adj := d.adjustedExp()
+		for {
+			exp = floorDiv(adj, 3) * 3
+			r = roundDecimal(d, adj-exp+1+places)
+			if r.adjustedExp() == adj {
+				break
+			}
+			adj = r.adjustedExp()
+		}
+	} else {
+		r = d
+	}
+	s := formatFixed(newDecimal(r.coef, r.exp-exp), places)
+	if prefixes && exp >= -24 && exp <= 24 {
+		return s + siPrefixes[exp/3+8]
+	}
+	if exp == 0 {
+		return s
+	}
+	return s + "e" + strconv.Itoa(exp)
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// FormatExpression shows the numbers in expr, such as the expression being
+// entered or the Expression of a history entry, in the display format and
+// the locale. With a decimal comma, ";" separates function arguments. The
+// rest of expr is kept as written.
+func (e *Engine) FormatExpression(expr string) string {
+	if e.DisplayFormat == FormatAuto && e.Locale == PlainLocale || e.NumberBase != Decimal {
+		return expr
+	}
+	tokens, err := Tokenize(expr)
+	if err != nil {
+		return expr
+	}
+	var b strings.Builder
+	last := 0
+	for _, tok := range tokens {
+		var text string
+		switch tok.Kind {
+		case TokenNumber:
+			n, err := e.arith.Parse(tok.Text)
+			if err != nil {
+				continue
+			}
+			if e.DisplayFormat == FormatAuto {
+				text = e.Locale.localize(tok.Text)
+			} else {
+				text = e.formatNumber(n)
+			}
+		case TokenComma:
+			if e.Locale.Decimal != "," {
+				continue
+			}
+			text = ";"
+		default:
+			continue
+		}
+		b.WriteString(expr[last:tok.Pos])
+		b.WriteString(text)
+		last = tok.Pos + len(tok.Text)
+	}
+	b.WriteString(expr[last:])
+	return b.String()
+}
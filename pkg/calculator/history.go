@@ -0,0 +1,258 @@
+package calculator
+
+import (
+	"math/big"
+	"strings"
+	"time"
+)
+
+// DefaultHistoryLimit is the number of entries kept in Engine.History
+// unless HistoryLimit is changed.
+const DefaultHistoryLimit = 1000
+
+// HistoryEntry records one calculation: an evaluated expression, a
+// function key or a bitwise operation.
+type HistoryEntry struct {
+	// Expression is the calculation as entered, such as "2 + 3 × 4",
+	// "sin(30)" or "12 AND 10".
+	Expression string
+	// Operator is the outermost operator or function of the expression,
+	// and Operands are its operands as written.
+	Operator string
+	Operands []string
+	// Result is the result as it was displayed, and Value the number
+	// itself. Both are empty if the calculation failed.
+	Result string
+	Value  Number
+	// Error describes why the calculation failed, if it did.
+	Error string
+
+	NumberMode NumberMode
+	AngleMode  AngleMode
+	Base       NumberBase
+	Time       time.Time
+}
+
+func (h HistoryEntry) Failed() bool {
+	return h.Error != ""
+}
+
+func (e *Engine) addHistory(entry HistoryEntry, result Number, err error) {
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Value = result
+		entry.Result = e.formatNumber(result)
+		e.ans = result
+	}
+	entry.NumberMode = e.NumberMode
+	entry.AngleMode = e.AngleMode
+	entry.Base = e.NumberBase
+	entry.Time = time.Now()
+	e.History = append(e.History, entry)
+	if e.HistoryLimit > 0 && len(e.History) > e.HistoryLimit {
+		e.History = e.History[len(e.History)-e.HistoryLimit:]
+	}
+	if e.historyStore != nil {
+		// Saving is best effort; a failure must not stop the calculation.
+		_ = e.historyStore.Append(entry)
+	}
+}
+
+// SetHistoryStore replaces the history with the entries saved in store,
+// and saves each new entry to it. The store's Limit becomes HistoryLimit.
+func (e *Engine) SetHistoryStore(store *HistoryStore) error {
+	e.historyStore = store
+	e.HistoryLimit = store.Limit
+	entries, err := store.Load()
+	e.History = entries
+	return err
+}
+
+// expressionEntry describes expr by the outermost node of its parse tree.
+func expressionEntry(expr string, node Node) HistoryEntry {
+	entry := HistoryEntry{Expression: expr}
+	switch n := node.(type) {
+	case *BinaryNode:
+		entry.Operator = opSymbol(n.Op)
+		entry.Operands = []string{n.Left.String(), n.Right.String()}
+	case *UnaryNode:
+		entry.Operator = n.Op
+		entry.Operands = []string{n.Operand.String()}
+	case *FactorialNode:
+		entry.Operator = "!"
+		entry.Operands = []string{n.Operand.String()}
+	case *AssignNode:
+		entry.Operator = "="
+		entry.Operands = []string{n.Name, n.Value.String()}
+	case *CallNode:
+		entry.Operator = n.Name
+		for _, arg := range n.Args {
+			entry.Operands = append(entry.Operands, arg.String())
+		}
+	case nil:
+	default:
+		entry.Operands = []string{n.String()}
+	}
+	return entry
+}
+
+// setBitwiseResult shows the result of a bitwise operation and records it.
+// One operand is written after the operator, as in "NOT 5"; two are
+// written either side of it, as in "12 AND 10".
+func (e *Engine) setBitwiseResult(operator string, result *big.Int, operands ...*big.Int) {
+	if e.Err != nil {
+		return
+	}
+	entry := HistoryEntry{Operator: operator}
+	for _, op := range operands {
+		entry.Operands = append(entry.Operands, e.FormatInBase(op))
+	}
+	if len(entry.Operands) == 2 {
+		entry.Expression = entry.Operands[0] + " " + operator + " " + entry.Operands[1]
+	} else {
+		entry.Expression = operator + " " + strings.Join(entry.Operands, " ")
+	}
+	e.setIntResult(result)
+	e.addHistory(entry, e.CurrentValue, nil)
+}
+
+// RecallHistory makes the result of entry the current value, clearing any
+// error. Entries that failed are ignored.
+func (e *Engine) RecallHistory(entry HistoryEntry) {
+	defer e.checkpoint()()
+	if entry.Failed() {
+		return
+	}
+	val := entry.Value
+	if val == nil {
+		var err error
+		if val, err = e.arith.Parse(e.Locale.delocalize(entry.Result)); err != nil {
+			return
+		}
+	}
+	e.Err = nil
+	e.liftStack()
+	e.CurrentValue = e.arith.Convert(val)
+	e.Display = e.formatNumber(e.CurrentValue)
+	e.NewInput = true
+	e.operandEntered = true
+}
+
+// LoadExpression replaces the expression being entered with expr, such as
+// the Expression of a history entry, so it can be extended or evaluated
+// again. The display shows its current value. An expression that parses
+// but fails to evaluate, such as a division by zero, is still loaded so it
+// can be corrected: the display shows the error, but input is not
+// blocked.
+func (e *Engine) LoadExpression(expr string) error {
+	defer e.checkpoint()()
+	val, evalErr := e.Evaluate(expr)
+	if evalErr != nil && !isCalculationError(evalErr) {
+		return evalErr
+	}
+	tokens, err := Tokenize(expr)
+	if err != nil {
+		return err
+	}
+
+	e.tokens = nil
+	for i := 0; i < len(tokens)-1; i++ {
+		tok := tokens[i]
+		text := tok.Text
+		if tok.Kind == TokenOperator {
+			switch text {
+			case "*":
+				text = opSymbol(OpMultiply)
+			case "/":
+				text = opSymbol(OpDivide)
+			case "%":
+				text = opSymbol(OpModulo)
+			case "-":
+				if i > 0 && endsOperand(tokens[i-1]) {
+					text = opSymbol(OpSubtract)
+				} else if tokens[i+1].Kind == TokenNumber {
+					// Keep a negative number in one piece, as it is
+					// written when entered from the keypad.
+					i++
+					text = "-" + tokens[i].Text
+				}
+			}
+		}
+		e.tokens = append(e.tokens, text)
+	}
+	e.parenDepth = 0
+	e.PendingOp = OpNone
+	e.Err = nil
+	if evalErr == nil {
+		e.CurrentValue = val
+		e.Display = e.formatNumber(val)
+	} else {
+		e.CurrentValue = e.Zero()
+		e.Display = evalErr.Error()
+	}
+	e.NewInput = true
+	e.operandEntered = false
+	return nil
+}
+
+func endsOperand(tok Token) bool {
+	switch tok.Kind {
+	case TokenNumber, TokenRParen:
+		return true
+	case TokenIdent:
+		return tok.Text != "mod"
+	case TokenOperator:
+		return tok.Text == "!"
+	}
+	return false
+}
+
+// ClearHistory empties the history, including any saved to a
+// HistoryStore.
+func (e *Engine) ClearHistory() error {
+	e.History = nil
+	if e.historyStore != nil {
+		return e.historyStore.Clear()
+	}
+	return nil
+}
+
+// HistoryQuery selects history entries for SearchHistory. Zero fields
+// match every entry.
+type HistoryQuery struct {
+	// Text is looked for in the expression and the result, ignoring case
+	// and spaces.
+	Text string
+	// From and To bound the time of the calculation: From inclusive, To
+	// exclusive.
+	From, To time.Time
+}
+
+func (q HistoryQuery) matches(entry HistoryEntry) bool {
+	if !q.From.IsZero() && entry.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !entry.Time.Before(q.To) {
+		return false
+	}
+	text := searchText(q.Text)
+	return text == "" ||
+		strings.Contains(searchText(entry.Expression), text) ||
+		strings.Contains(searchText(entry.Result), text)
+}
+
+func searchText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), ""))
+}
+
+// SearchHistory returns the history entries matching q, oldest first.
+func (e *Engine) SearchHistory(q HistoryQuery) []HistoryEntry {
+	var found []HistoryEntry
+	for _, entry := range e.History {
+		if q.matches(entry) {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
@@ -0,0 +1,249 @@
+package calculator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// historyFormatVersion is written with every record in the history file.
+// Records with a newer version are skipped when loading, but kept in the
+// file.
+const historyFormatVersion = 1
+
+// historyRecord is one line of the history file.
+type historyRecord struct {
+	Version    int        `json:"v"`
+	Time       time.Time  `json:"time"`
+	Expression string     `json:"expr"`
+	Operator   string     `json:"op,omitempty"`
+	Operands   []string   `json:"operands,omitempty"`
+	Result     string     `json:"result,omitempty"`
+	Value      string     `json:"value,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	NumberMode NumberMode `json:"mode"`
+	AngleMode  AngleMode  `json:"angle"`
+	Base       NumberBase `json:"base"`
+}
+
+func newHistoryRecord(entry HistoryEntry) historyRecord {
+	rec := historyRecord{
+		Version:    historyFormatVersion,
+		Time:       entry.Time,
+		Expression: entry.Expression,
+		Operator:   entry.Operator,
+		Operands:   entry.Operands,
+		Result:     entry.Result,
+		Error:      entry.Error,
+		NumberMode: entry.NumberMode,
+		AngleMode:  entry.AngleMode,
+		Base:       entry.Base,
+	}
+	if entry.Value != nil {
+		rec.Value = entry.Value.String()
+	}
+	return rec
+}
+
+func (r historyRecord) entry() HistoryEntry {
+	entry := HistoryEntry{
+		Expression: r.Expression,
+		Operator:   r.Operator,
+		Operands:   r.Operands,
+		Result:     r.Result,
+		Error:      r.Error,
+		NumberMode: r.NumberMode,
+		AngleMode:  r.AngleMode,
+		Base:       r.Base,
+		Time:       r.Time,
+	}
+	if r.Value != "" {
+		entry.Value = parseStoredValue(r.NumberMode, r.Value)
+	}
+	return entry
+}
+
+// parseStoredValue reads a value saved with Number.String in the given
+// mode, or returns nil if it cannot.
+func parseStoredValue(mode NumberMode, text string) Number {
+	var arith Arithmetic
+	switch mode {
+	case ModeFraction:
+		arith = NewRationalArithmetic(DefaultPrecision)
+	case ModeComplex:
+		arith = NewComplexArithmetic()
+	default:
+		arith = NewDecimalArithmetic(max(len(text), DefaultPrecision))
+	}
+	n, err := arith.Parse(text)
+	if err != nil {
+		return nil
+	}
+	return n
+}
+
+// HistoryStore saves history entries to a JSON Lines file, one record per
+// line. New entries are appended; the file is rewritten only to drop
+// entries beyond Limit or older than MaxAge, keeping the records of newer
+// versions as they are.
+type HistoryStore struct {
+	path string
+	// Limit is the number of entries kept, or 0 for no limit.
+	Limit int
+	// MaxAge is how long entries are kept, or 0 to keep them until Limit
+	// pushes them out.
+	MaxAge time.Duration
+
+	// records is the number of entries in the file, counting ones that
+	// are due to be dropped.
+	records int
+}
+
+// DefaultHistoryPath returns history.jsonl in DataDir.
+func DefaultHistoryPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+func NewHistoryStore(path string, limit int, maxAge time.Duration) *HistoryStore {
+	return &HistoryStore{path: path, Limit: limit, MaxAge: maxAge}
+}
+
+func (s *HistoryStore) Path() string {
+	return s.path
+}
+
+// Load reads the saved entries, oldest first. Lines that cannot be read,
+// or that were written by a newer version, are skipped. If entries were
+// dropped for Limit or MaxAge the file is rewritten without them and
+// without the lines that cannot be read; lines of a newer version are
+// copied through.
+func (s *HistoryStore) Load() ([]HistoryEntry, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.records = 0
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// lines holds the lines to keep if the file is rewritten, and
+	// entryLines the index in it of the line of each entry.
+	var (
+		entries    []HistoryEntry
+		lines      [][]byte
+		entryLines []int
+	)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec historyRecord
+		if err := json.Unmarshal(line, &rec); err != nil || rec.Version < 1 {
+			continue
+		}
+		if rec.Version <= historyFormatVersion {
+			entries = append(entries, rec.entry())
+			entryLines = append(entryLines, len(lines))
+		}
+		lines = append(lines, bytes.Clone(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	s.records = len(entries)
+
+	kept := s.prune(entries, time.Now())
+	if len(kept) == len(entries) {
+		return entries, nil
+	}
+	keep := make([]bool, len(lines))
+	for i := range keep {
+		keep[i] = true
+	}
+	for _, i := range entryLines {
+		keep[i] = false
+	}
+	result := make([]HistoryEntry, len(kept))
+	for j, i := range kept {
+		keep[entryLines[i]] = true
+		result[j] = entries[i]
+	}
+	var buf bytes.Buffer
+	for i, line := range lines {
+		if keep[i] {
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	}
+	if err := writeFileAtomic(s.path, buf.Bytes()); err != nil {
+		return result, err
+	}
+	s.records = len(result)
+	return result, nil
+}
+
+// prune returns the indexes of the entries to keep, in order: those no
+// older than MaxAge, and of them the newest Limit.
+func (s *HistoryStore) prune(entries []HistoryEntry, now time.Time) []int {
+	var kept []int
+	cutoff := now.Add(-s.MaxAge)
+	for i, entry := range entries {
+		if s.MaxAge <= 0 || !entry.Time.Before(cutoff) {
+			kept = append(kept, i)
+		}
+	}
+	if s.Limit > 0 && len(kept) > s.Limit {
+		kept = kept[len(kept)-s.Limit:]
+	}
+	return kept
+}
+
+// Append adds entry to the end of the file. Once the file holds twice
+// Limit records it is reloaded, which rewrites it with just the newest.
+func (s *HistoryStore) Append(entry HistoryEntry) error {
+	line, err := json.Marshal(newHistoryRecord(entry))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.records++
+	if s.Limit > 0 && s.records >= 2*s.Limit {
+		_, err = s.Load()
+	}
+	return err
+}
+
+// Clear deletes the history file.
+func (s *HistoryStore) Clear() error {
+	s.records = 0
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
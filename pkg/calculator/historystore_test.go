@@ -0,0 +1,84 @@
+package calculator
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeHistory writes lines to a history file in a temporary directory
+// and returns its path.
+func writeHistory(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func historyLine(t *testing.T, expr string, at time.Time) string {
+	t.Helper()
+	line, err := json.Marshal(newHistoryRecord(HistoryEntry{Expression: expr, Result: "1", Time: at}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(line)
+}
+
+func loadExpressions(t *testing.T, s *HistoryStore) string {
+	t.Helper()
+	entries, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exprs []string
+	for _, entry := range entries {
+		exprs = append(exprs, entry.Expression)
+	}
+	return strings.Join(exprs, " ")
+}
+
+func TestHistoryLoadKeepsFile(t *testing.T) {
+	now := time.Now()
+	newer := `{"v":2,"time":"2030-01-01T00:00:00Z","expr":"new"}`
+	path := writeHistory(t,
+		historyLine(t, "1+1", now),
+		newer,
+		"not json",
+		historyLine(t, "2+2", now),
+	)
+	before, _ := os.ReadFile(path)
+	s := NewHistoryStore(path, 2, time.Hour)
+	if got := loadExpressions(t, s); got != "1+1 2+2" {
+		t.Errorf("loaded %q, want %q", got, "1+1 2+2")
+	}
+	after, _ := os.ReadFile(path)
+	if string(after) != string(before) {
+		t.Errorf("file rewritten with nothing dropped:\n%s", after)
+	}
+}
+
+func TestHistoryLoadPrunes(t *testing.T) {
+	now := time.Now()
+	newer := `{"v":2,"time":"2030-01-01T00:00:00Z","expr":"new"}`
+	path := writeHistory(t,
+		historyLine(t, "old", now.Add(-2*time.Hour)),
+		historyLine(t, "1+1", now),
+		newer,
+		"not json",
+		historyLine(t, "2+2", now),
+		historyLine(t, "3+3", now),
+	)
+	s := NewHistoryStore(path, 2, time.Hour)
+	if got := loadExpressions(t, s); got != "2+2 3+3" {
+		t.Errorf("loaded %q, want %q", got, "2+2 3+3")
+	}
+	want := strings.Join([]string{newer, historyLine(t, "2+2", now), historyLine(t, "3+3", now)}, "\n") + "\n"
+	if got, _ := os.ReadFile(path); string(got) != want {
+		t.Errorf("rewritten file:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,267 @@
+package calculator
+
+import (
+	"os"
+	"strings"
+)
+
+// Grouping is how the digits before the decimal separator are grouped.
+type Grouping int
+
+const (
+	GroupNone Grouping = iota
+	// GroupThousands groups by threes: 1,234,567.
+	GroupThousands
+	// GroupIndian groups the last three digits and then by twos, for
+	// lakh and crore: 12,34,567.
+	GroupIndian
+)
+
+// NumberLocale is how numbers are written for the user: the decimal
+// separator, and the separator and grouping of the whole digits.
+// Expressions and saved values always use the plain form.
+type NumberLocale struct {
+	Decimal  string
+	Group    string
+	Grouping Grouping
+}
+
+// PlainLocale writes numbers the way expressions are parsed, with a
+// decimal point and no grouping. It is the locale of a new Engine.
+var PlainLocale = NumberLocale{Decimal: "."}
+
+const thinSpace = "\u2009"
+
+// Languages that write a decimal comma, by the thousands separator they
+// use with it.
+var (
+	periodGroupLanguages = []string{"da", "de", "el", "es", "hr", "id", "it", "nl", "pt", "ro", "sl", "sr", "tr"}
+	spaceGroupLanguages  = []string{"bg", "cs", "et", "fi", "fr", "hu", "lt", "lv", "nb", "nn", "no", "pl", "ru", "sk", "sv", "uk"}
+)
+
+// ParseLocale returns the number conventions of a POSIX locale name such
+// as "de_DE.UTF-8", "fr_FR" or "en_IN". "C", "POSIX" and "" give
+// PlainLocale, and an unknown language the English conventions.
+func ParseLocale(name string) NumberLocale {
+	name, _, _ = strings.Cut(name, "@")
+	name, _, _ = strings.Cut(name, ".")
+	if name == "" || name == "C" || name == "POSIX" {
+		return PlainLocale
+	}
+	lang, territory, _ := strings.Cut(name, "_")
+	lang = strings.ToLower(lang)
+	territory = strings.ToUpper(territory)
+	switch {
+	case territory == "IN":
+		return NumberLocale{Decimal: ".", Group: ",", Grouping: GroupIndian}
+	case territory == "CH" && (lang == "de" || lang == "it"):
+		return NumberLocale{Decimal: ".", Group: "'", Grouping: GroupThousands}
+	case lang == "pt" && territory == "PT", contains(spaceGroupLanguages, lang):
+		return NumberLocale{Decimal: ",", Group: thinSpace, Grouping: GroupThousands}
+	case contains(periodGroupLanguages, lang):
+		return NumberLocale{Decimal: ",", Group: ".", Grouping: GroupThousands}
+	}
+	return NumberLocale{Decimal: ".", Group: ",", Grouping: GroupThousands}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultLocale returns the number conventions of the environment: the
+// first of LC_ALL, LC_NUMERIC and LANG that is set.
+func DefaultLocale() NumberLocale {
+	for _, env := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+		if name := os.Getenv(env); name != "" {
+			return ParseLocale(name)
+		}
+	}
+	return PlainLocale
+}
+
+// SetLocale sets how numbers are written in the display, the history and
+// the expression, and read from typed and pasted input.
+func (e *Engine) SetLocale(l NumberLocale) {
+	defer e.checkpoint()()
+	if l.Decimal == "" {
+		l.Decimal = "."
+	}
+	e.Locale = l
+	e.redisplay()
+}
+
+// localize rewrites the plain numbers in s, such as "-1234.5e-7" or
+// "3.5+2i", with the locale's separators. A point after digits is always a
+// decimal point, so an entry such as "12." is written too. Exponents and
+// the parts of fractions are not grouped.
+func (l NumberLocale) localize(s string) string {
+	if l == PlainLocale {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if !isDigit(s[i]) {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && isDigit(s[j]) {
+			j++
+		}
+		exponent := i > 0 && (s[i-1] == 'e' || i > 1 && s[i-2] == 'e' && (s[i-1] == '-' || s[i-1] == '+'))
+		fraction := i > 0 && s[i-1] == '/' || j < len(s) && s[j] == '/'
+		if exponent || fraction {
+			b.WriteString(s[i:j])
+		} else {
+			b.WriteString(l.group(s[i:j]))
+		}
+		i = j
+		if i < len(s) && s[i] == '.' {
+			b.WriteString(l.Decimal)
+			for i++; i < len(s) && isDigit(s[i]); i++ {
+				b.WriteByte(s[i])
+			}
+		}
+	}
+	return b.String()
+}
+
+// group inserts the group separator into a run of whole digits.
+func (l NumberLocale) group(digits string) string {
+	if l.Grouping == GroupNone || l.Group == "" || len(digits) <= 3 {
+		return digits
+	}
+	head, tail := digits[:len(digits)-3], digits[len(digits)-3:]
+	size := 3
+	if l.Grouping == GroupIndian {
+		size = 2
+	}
+	var parts []string
+	for len(head) > size {
+		parts = append([]string{head[len(head)-size:]}, parts...)
+		head = head[:len(head)-size]
+	}
+	parts = append([]string{head}, parts...)
+	return strings.Join(append(parts, tail), l.Group)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// delocalize turns a number written by localize back into the plain form.
+func (l NumberLocale) delocalize(s string) string {
+	if l == PlainLocale {
+		return s
+	}
+	if l.Group != "" {
+		s = strings.ReplaceAll(s, l.Group, "")
+	}
+	return strings.ReplaceAll(s, l.Decimal, ".")
+}
+
+// readNumber converts a number as it might be pasted, written with
+// grouping and either decimal separator such as "1.234.567,89" or
+// "1,234,567.89", to the plain form. When both a comma and a period
+// appear, the last is the decimal separator, and one that appears more
+// than once groups digits. A single one is read as the locale writes it,
+// or, when the locale writes no group separator, as grouping if exactly
+// three digits follow a comma, so that "1,234" is 1234.
+func (l NumberLocale) readNumber(text string) string {
+	s := strings.NewReplacer(" ", "", thinSpace, "", "\u202f", "", "\u00a0", "", "'", "", "’", "", "−", "-").Replace(text)
+	decimal := l.Decimal
+	dots, commas := strings.Count(s, "."), strings.Count(s, ",")
+	switch {
+	case dots > 0 && commas > 0:
+		decimal = "."
+		if strings.LastIndex(s, ",") > strings.LastIndex(s, ".") {
+			decimal = ","
+		}
+	case dots > 1:
+		decimal = ","
+	case commas > 1:
+		decimal = "."
+	case dots == 1 && l.Group != ".":
+		decimal = "."
+	case commas == 1 && l.Group == "" && isGroup(s[strings.Index(s, ",")+1:]):
+		decimal = "."
+	case commas == 1 && l.Group != ",":
+		decimal = ","
+	}
+	group := ","
+	if decimal == "," {
+		group = "."
+	}
+	s = strings.ReplaceAll(s, group, "")
+	return strings.ReplaceAll(s, decimal, ".")
+}
+
+// readExpression converts the numbers of an expression typed in the
+// locale to the plain form. With a decimal comma, "2,5" is 2.5 and ";"
+// separates function arguments. Group separators between digits are
+// dropped, except a comma, which always separates arguments when the
+// decimal separator is a point.
+func (l NumberLocale) readExpression(expr string) string {
+	if l == PlainLocale {
+		return expr
+	}
+	digitAt := func(i int) bool { return i >= 0 && i < len(expr) && isDigit(expr[i]) }
+	var b strings.Builder
+	for i := 0; i < len(expr); {
+		switch {
+		case l.Group != "" && l.Group != "," && strings.HasPrefix(expr[i:], l.Group) && digitAt(i-1) && isGroup(expr[i+len(l.Group):]):
+			i += len(l.Group)
+			continue
+		case l.Decimal == "," && expr[i] == ',' && digitAt(i-1) && digitAt(i+1):
+			b.WriteByte('.')
+		case l.Decimal == "," && expr[i] == ';':
+			b.WriteByte(',')
+		default:
+			b.WriteByte(expr[i])
+		}
+		i++
+	}
+	return b.String()
+}
+
+// isGroup reports whether s starts with exactly three digits, as follow a
+// group separator.
+func isGroup(s string) bool {
+	return len(s) >= 3 && isDigit(s[0]) && isDigit(s[1]) && isDigit(s[2]) && (len(s) == 3 || !isDigit(s[3]))
+}
+
+// Paste enters text from the clipboard. A number, with any grouping and
+// either decimal separator, becomes the entry as if typed. Anything else
+// is loaded as an expression written in the locale, like LoadExpression.
+func (e *Engine) Paste(text string) error {
+	text = strings.TrimSpace(text)
+	if e.NumberBase == Decimal {
+		entry := e.Locale.readNumber(text)
+		if _, err := e.arith.Parse(entry); err == nil {
+			e.pasteEntry(entry)
+			return nil
+		}
+	} else if _, err := e.ParseCurrentBase(text); err == nil {
+		e.pasteEntry(text)
+		return nil
+	}
+	return e.LoadExpression(e.Locale.readExpression(text))
+}
+
+func (e *Engine) pasteEntry(entry string) {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	e.liftStack()
+	e.setEntry(entry)
+	e.NewInput = false
+	e.parseDisplay()
+	e.operandEntered = true
+}
@@ -0,0 +1,219 @@
+package calculator
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"math/cmplx"
+)
+
+// Number is a value held by the engine. Its concrete type is decided by the
+// engine's Arithmetic, so values should only be combined through it.
+type Number interface {
+	Float64() float64
+	String() string
+}
+
+// Arithmetic implements the engine's operations for one representation of
+// Number.
+type Arithmetic interface {
+	Parse(s string) (Number, error)
+	FromFloat(f float64) Number
+	FromInt(i *big.Int) Number
+	Convert(n Number) Number
+	Int(n Number) *big.Int
+
+	Add(x, y Number) Number
+	Sub(x, y Number) Number
+	Mul(x, y Number) Number
+	Quo(x, y Number) (Number, error)
+	Mod(x, y Number) (Number, error)
+	Pow(x, y Number) (Number, error)
+	Neg(x Number) Number
+	Sign(x Number) int
+	Cmp(x, y Number) int
+
+	Floor(x Number) Number
+	Ceil(x Number) Number
+	Round(x Number) Number
+	Sqrt(x Number) (Number, error)
+}
+
+type NumberMode int
+
+const (
+	ModeDecimal NumberMode = iota
+	ModeFraction
+	ModeComplex
+)
+
+const DefaultPrecision = 20
+
+var errInvalidNumber = errors.New("invalid number")
+
+func (e *Engine) SetNumberMode(mode NumberMode) {
+	defer e.checkpoint()()
+	e.NumberMode = mode
+	e.resetArithmetic()
+}
+
+// resetArithmetic sets up the arithmetic of the number mode. In
+// programmer mode decimal arithmetic keeps enough digits for every value
+// of the word, so that a 128-bit word is exact at the default precision.
+func (e *Engine) resetArithmetic() {
+	switch e.NumberMode {
+	case ModeFraction:
+		e.setArithmetic(NewRationalArithmetic(e.Precision))
+	case ModeComplex:
+		e.setArithmetic(NewComplexArithmetic())
+	default:
+		digits := e.Precision
+		if e.Programmer {
+			digits = max(digits, e.BitWidth.decimalDigits())
+		}
+		e.setArithmetic(NewDecimalArithmetic(digits))
+	}
+}
+
+// SetPrecision sets the number of significant digits decimal results are
+// rounded to. Fractions stay exact but are shown to this many digits in
+// decimal form.
+func (e *Engine) SetPrecision(digits int) {
+	defer e.checkpoint()()
+	if digits < 1 {
+		digits = 1
+	}
+	e.Precision = digits
+	e.SetNumberMode(e.NumberMode)
+}
+
+func (e *Engine) setArithmetic(arith Arithmetic) {
+	e.arith = arith
+	e.CurrentValue = arith.Convert(e.CurrentValue)
+	e.StoredValue = arith.Convert(e.StoredValue)
+	e.Memory = arith.Convert(e.Memory)
+	for name, val := range e.variables {
+		e.variables[name] = arith.Convert(val)
+	}
+	if e.ans != nil {
+		e.ans = arith.Convert(e.ans)
+	}
+	stack := make([]Number, len(e.stack))
+	for i, val := range e.stack {
+		stack[i] = arith.Convert(val)
+	}
+	e.stack = stack
+	if e.lastX != nil {
+		e.lastX = arith.Convert(e.lastX)
+	}
+	e.redisplay()
+}
+
+// Arithmetic returns the arithmetic the engine currently computes with.
+func (e *Engine) Arithmetic() Arithmetic {
+	return e.arith
+}
+
+func (e *Engine) Zero() Number {
+	return e.arith.FromInt(new(big.Int))
+}
+
+func (e *Engine) FromInt64(i int64) Number {
+	return e.arith.FromInt(big.NewInt(i))
+}
+
+// IntValue returns the integer part of the current value fitted to the
+// word of BitWidth bits, read as signed or unsigned.
+func (e *Engine) IntValue() *big.Int {
+	return e.intValue(e.CurrentValue)
+}
+
+// setIntResult shows the result of a programmer operation, fitted to the
+// word. In the error state the operation is ignored.
+func (e *Engine) setIntResult(result *big.Int) {
+	if e.Err != nil {
+		return
+	}
+	e.lastX = e.CurrentValue
+	e.CurrentValue = e.intNumber(e.wrap(result))
+	e.Display = e.FormatInBase(result)
+	e.NewInput = true
+	e.operandEntered = true
+	e.lift = true
+	e.setFlags()
+}
+
+// parseLiteral reads a number as written in an expression, including the
+// 0x, 0b and 0o prefixed integer forms.
+func (e *Engine) parseLiteral(text string) (Number, error) {
+	if len(text) > 2 && text[0] == '0' {
+		base := 0
+		switch text[1] {
+		case 'x', 'X':
+			base = 16
+		case 'b', 'B':
+			base = 2
+		case 'o', 'O':
+			base = 8
+		}
+		if base != 0 {
+			i, ok := new(big.Int).SetString(text[2:], base)
+			if !ok {
+				return nil, errInvalidNumber
+			}
+			return e.arith.FromInt(i), nil
+		}
+	}
+	return e.arith.Parse(text)
+}
+
+// fromFloatResult converts the result of a float64 computation, mapping
+// NaN and infinities to errors.
+func (e *Engine) fromFloatResult(f float64) (Number, error) {
+	if math.IsNaN(f) {
+		return nil, errDomain
+	}
+	if math.IsInf(f, 0) {
+		return nil, ErrOverflow
+	}
+	return e.arith.FromFloat(f), nil
+}
+
+func isInteger(arith Arithmetic, n Number) bool {
+	return arith.Cmp(arith.Floor(n), n) == 0
+}
+
+// maxDecimalExponent bounds the magnitude of decimal results so runaway
+// values are reported as overflow instead of growing without limit.
+const maxDecimalExponent = 999999
+
+// maxRationalBits bounds the size of a fraction's numerator and
+// denominator for the same reason.
+const maxRationalBits = 1 << 20
+
+func (e *Engine) checkRange(n Number) (Number, error) {
+	switch v := n.(type) {
+	case *DecimalNumber:
+		if v.coef.Sign() == 0 {
+			break
+		}
+		if v.adjustedExp() > maxDecimalExponent {
+			return nil, ErrOverflow
+		}
+		if v.adjustedExp() < -maxDecimalExponent {
+			return e.Zero(), nil
+		}
+	case *RationalNumber:
+		if v.rat.Num().BitLen() > maxRationalBits || v.rat.Denom().BitLen() > maxRationalBits {
+			return nil, ErrOverflow
+		}
+	case *ComplexNumber:
+		if cmplx.IsNaN(v.z) {
+			return nil, errDomain
+		}
+		if cmplx.IsInf(v.z) {
+			return nil, ErrOverflow
+		}
+	}
+	return n, nil
+}
@@ -2,240 +2,468 @@ package calculator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
 )
 
+// BitWidth is the word size of programmer mode, any number of bits from
+// MinBitWidth to MaxBitWidth. Programmer operations give a result that
+// fits in the word, and the value is shown as that word read as a signed
+// or unsigned integer.
 type BitWidth int
 
 const (
-	Bits8  BitWidth = 8
-	Bits16 BitWidth = 16
-	Bits32 BitWidth = 32
-	Bits64 BitWidth = 64
+	Bits8   BitWidth = 8
+	Bits16  BitWidth = 16
+	Bits32  BitWidth = 32
+	Bits64  BitWidth = 64
+	Bits128 BitWidth = 128
+	Bits256 BitWidth = 256
+
+	MinBitWidth BitWidth = 1
+	MaxBitWidth BitWidth = 1024
 )
 
-func (e *Engine) And(other int64) {
-	val := int64(e.CurrentValue)
-	result := val & other
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+// ParseBitWidth reads a word size in bits, from 1 to 1024.
+func ParseBitWidth(s string) (BitWidth, error) {
+	n, err := strconv.Atoi(s)
+	if width := BitWidth(n); err == nil && width.valid() {
+		return width, nil
+	}
+	return 0, fmt.Errorf("unknown bit width %q, want %d to %d", s, MinBitWidth, MaxBitWidth)
 }
 
-func (e *Engine) Or(other int64) {
-	val := int64(e.CurrentValue)
-	result := val | other
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+func (w BitWidth) valid() bool {
+	return w >= MinBitWidth && w <= MaxBitWidth
 }
 
-func (e *Engine) Xor(other int64) {
-	val := int64(e.CurrentValue)
-	result := val ^ other
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+// mask has the bits of the word set.
+func (w BitWidth) mask() *big.Int {
+	m := new(big.Int).Lsh(bigOne, uint(w))
+	return m.Sub(m, bigOne)
+}
+
+// decimalDigits is the number of digits of the largest value of the word.
+func (w BitWidth) decimalDigits() int {
+	return int(float64(w)*math.Log10(2)) + 1
+}
+
+// SetBitWidth sets the word size of programmer mode, cutting the current
+// value down to the new word in that mode. Widths out of range are
+// ignored.
+func (e *Engine) SetBitWidth(width BitWidth) {
+	defer e.checkpoint()()
+	if !width.valid() {
+		return
+	}
+	e.BitWidth = width
+	// Cut the value down before a narrower word lowers the precision
+	e.rewrap()
+	e.resetArithmetic()
+}
+
+// SetSigned chooses whether the word is read as a signed, two's
+// complement, integer or an unsigned one. In programmer mode the current
+// value keeps its bits, so in an 8-bit word 255 becomes -1.
+func (e *Engine) SetSigned(signed bool) {
+	defer e.checkpoint()()
+	e.Signed = signed
+	e.rewrap()
+}
+
+// SetProgrammer turns programmer mode on or off. Turning it on fits the
+// current value to the word, so it is an undo step that brings back both
+// the mode and the value.
+func (e *Engine) SetProgrammer(on bool) {
+	defer e.checkpoint()()
+	e.Programmer = on
+	e.resetArithmetic()
+	e.rewrap()
+}
+
+// rewrap fits the current value to the word in programmer mode, after a
+// change of the mode or the word.
+func (e *Engine) rewrap() {
+	if e.Err != nil || !e.Programmer {
+		return
+	}
+	e.CurrentValue = e.fit(e.CurrentValue)
+	e.redisplay()
+}
+
+// fit returns n fitted to the word in programmer mode, and otherwise n.
+func (e *Engine) fit(n Number) Number {
+	if !e.Programmer {
+		return n
+	}
+	if c, ok := n.(*ComplexNumber); ok && !c.IsReal() {
+		return n
+	}
+	return e.intNumber(e.intValue(n))
+}
+
+// wrap fits the bits of v to the word: the bits above it are dropped, and
+// in a signed word a set sign bit makes it negative.
+func (e *Engine) wrap(v *big.Int) *big.Int {
+	u := e.bits(v)
+	if e.Signed && u.Bit(int(e.BitWidth)-1) == 1 {
+		u.Sub(u, new(big.Int).Lsh(bigOne, uint(e.BitWidth)))
+	}
+	return u
+}
+
+// bits returns the word holding v, as an unsigned number.
+func (e *Engine) bits(v *big.Int) *big.Int {
+	return new(big.Int).And(v, e.BitWidth.mask())
+}
+
+// intNumber is the value of the word v, which wrap has fitted to it.
+func (e *Engine) intNumber(v *big.Int) Number {
+	return e.arith.FromInt(v)
+}
+
+// intValue returns the integer part of n fitted to the word.
+func (e *Engine) intValue(n Number) *big.Int {
+	return e.wrap(e.arith.Int(n))
+}
+
+// formatInt writes v, fitted to the word, in base: as a signed or
+// unsigned integer in decimal, and as the bits of the word in the others.
+func (e *Engine) formatInt(v *big.Int, base NumberBase) string {
+	switch base {
+	case Binary:
+		return e.bits(v).Text(2)
+	case Octal:
+		return e.bits(v).Text(8)
+	case Hexadecimal:
+		return strings.ToUpper(e.bits(v).Text(16))
+	}
+	return e.wrap(v).String()
+}
+
+// Flags are the status flags of the last programmer result, as a CPU
+// sets them after an instruction. Carry and Overflow come from addition,
+// subtraction, multiplication and shifts, and are clear after the other
+// operations.
+type Flags struct {
+	// Carry is set when the result read as unsigned does not fit the
+	// word: a carry out of an addition, a borrow in a subtraction, a
+	// product of more than the word's bits, or the last bit shifted out.
+	Carry bool
+	// Overflow is set when the result read as signed does not fit.
+	Overflow bool
+	// Zero is set when every bit of the word is clear.
+	Zero bool
+	// Negative is the sign bit of the word.
+	Negative bool
+}
+
+// String writes the flags as a CPU status register: C, V, Z and N for
+// the flags set and - for those clear, such as "C-Z-".
+func (f Flags) String() string {
+	b := []byte("----")
+	for i, set := range []bool{f.Carry, f.Overflow, f.Zero, f.Negative} {
+		if set {
+			b[i] = "CVZN"[i]
+		}
+	}
+	return string(b)
+}
+
+// SetSaturate chooses whether programmer addition, subtraction,
+// multiplication and left shifts saturate, giving the largest or smallest
+// value of the word when the result does not fit, instead of wrapping
+// around.
+func (e *Engine) SetSaturate(on bool) {
+	defer e.checkpoint()()
+	e.Saturate = on
+}
+
+// setFlags sets Flags for the current value, a programmer result, with
+// the carry and overflow of the word operation that gave it.
+func (e *Engine) setFlags() {
+	v := e.bits(e.IntValue())
+	e.Flags = Flags{
+		Carry:    e.carry,
+		Overflow: e.overflow,
+		Zero:     v.Sign() == 0,
+		Negative: v.Bit(int(e.BitWidth)-1) == 1,
+	}
+	e.carry, e.overflow = false, false
+}
+
+// readings returns the word holding v read as an unsigned and as a
+// signed integer.
+func (e *Engine) readings(v *big.Int) (unsigned, signed *big.Int) {
+	unsigned = e.bits(v)
+	signed = new(big.Int).Set(unsigned)
+	if unsigned.Bit(int(e.BitWidth)-1) == 1 {
+		signed.Sub(signed, new(big.Int).Lsh(bigOne, uint(e.BitWidth)))
+	}
+	return unsigned, signed
+}
+
+// wordResult gives the result of a word operation from its exact results
+// on the unsigned and the signed readings of the operands. It notes the
+// carry and overflow, and in saturating mode clamps the result to the
+// range of the word as it is read.
+func (e *Engine) wordResult(unsigned, signed *big.Int) *big.Int {
+	maxUnsigned := e.BitWidth.mask()
+	minSigned := new(big.Int).Neg(new(big.Int).Lsh(bigOne, uint(e.BitWidth)-1))
+	maxSigned := new(big.Int).Sub(new(big.Int).Neg(minSigned), bigOne)
+	e.carry = unsigned.Sign() < 0 || unsigned.Cmp(maxUnsigned) > 0
+	e.overflow = signed.Cmp(minSigned) < 0 || signed.Cmp(maxSigned) > 0
+	switch {
+	case !e.Saturate:
+	case e.Signed && signed.Cmp(minSigned) < 0:
+		return minSigned
+	case e.Signed && signed.Cmp(maxSigned) > 0:
+		return maxSigned
+	case !e.Signed && unsigned.Sign() < 0:
+		return new(big.Int)
+	case !e.Signed && unsigned.Cmp(maxUnsigned) > 0:
+		return maxUnsigned
+	}
+	return e.wrap(unsigned)
+}
+
+// wordOperation adds, subtracts or multiplies x and y in the word, as a
+// CPU does, noting the carry and overflow.
+func (e *Engine) wordOperation(op Operation, x, y *big.Int) *big.Int {
+	ux, sx := e.readings(x)
+	uy, sy := e.readings(y)
+	switch op {
+	case OpAdd:
+		return e.wordResult(ux.Add(ux, uy), sx.Add(sx, sy))
+	case OpSubtract:
+		return e.wordResult(ux.Sub(ux, uy), sx.Sub(sx, sy))
+	}
+	return e.wordResult(ux.Mul(ux, uy), sx.Mul(sx, sy))
+}
+
+// shiftLeft shifts v left by bits, noting the last bit shifted out as the
+// carry, and an overflow if the signed value does not fit.
+func (e *Engine) shiftLeft(v *big.Int, bits uint) *big.Int {
+	width := uint(e.BitWidth)
+	// Any shift past the word moves every bit out
+	bits = min(bits, width+1)
+	ux, sx := e.readings(v)
+	result := e.wordResult(new(big.Int).Lsh(ux, bits), new(big.Int).Lsh(sx, bits))
+	e.carry = bits > 0 && bits <= width && ux.Bit(int(width-bits)) == 1
+	return result
+}
+
+// shiftRight shifts v right by bits: arithmetically, copying the sign
+// bit, in a signed word and logically in an unsigned one. The last bit
+// shifted out is the carry.
+func (e *Engine) shiftRight(v *big.Int, bits uint) *big.Int {
+	ux, sx := e.readings(v)
+	e.carry = bits > 0 && bits <= uint(e.BitWidth) && ux.Bit(int(bits-1)) == 1
+	e.overflow = false
+	if e.Signed {
+		return sx.Rsh(sx, bits)
+	}
+	return ux.Rsh(ux, bits)
+}
+
+func (e *Engine) And(other *big.Int) {
+	defer e.checkpoint()()
+	val, other := e.IntValue(), e.wrap(other)
+	result := new(big.Int).And(val, other)
+	e.setBitwiseResult("AND", result, val, other)
+}
+
+func (e *Engine) Or(other *big.Int) {
+	defer e.checkpoint()()
+	val, other := e.IntValue(), e.wrap(other)
+	result := new(big.Int).Or(val, other)
+	e.setBitwiseResult("OR", result, val, other)
+}
+
+func (e *Engine) Xor(other *big.Int) {
+	defer e.checkpoint()()
+	val, other := e.IntValue(), e.wrap(other)
+	result := new(big.Int).Xor(val, other)
+	e.setBitwiseResult("XOR", result, val, other)
 }
 
 func (e *Engine) Not() {
-	val := int64(e.CurrentValue)
-	result := ^val
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+	defer e.checkpoint()()
+	val := e.IntValue()
+	result := new(big.Int).Not(val)
+	e.setBitwiseResult("NOT", result, val)
 }
 
-func (e *Engine) Nand(other int64) {
-	val := int64(e.CurrentValue)
-	result := ^(val & other)
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+func (e *Engine) Nand(other *big.Int) {
+	defer e.checkpoint()()
+	val, other := e.IntValue(), e.wrap(other)
+	result := new(big.Int).Not(new(big.Int).And(val, other))
+	e.setBitwiseResult("NAND", result, val, other)
 }
 
-func (e *Engine) Nor(other int64) {
-	val := int64(e.CurrentValue)
-	result := ^(val | other)
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+func (e *Engine) Nor(other *big.Int) {
+	defer e.checkpoint()()
+	val, other := e.IntValue(), e.wrap(other)
+	result := new(big.Int).Not(new(big.Int).Or(val, other))
+	e.setBitwiseResult("NOR", result, val, other)
 }
 
 func (e *Engine) LeftShift(bits uint) {
-	val := int64(e.CurrentValue)
-	result := val << bits
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+	defer e.checkpoint()()
+	val := e.IntValue()
+	result := e.shiftLeft(val, bits)
+	e.setBitwiseResult("<<", result, val, big.NewInt(int64(bits)))
 }
 
 func (e *Engine) RightShift(bits uint) {
-	val := int64(e.CurrentValue)
-	result := val >> bits
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+	defer e.checkpoint()()
+	val := e.IntValue()
+	result := e.shiftRight(val, bits)
+	e.setBitwiseResult(">>", result, val, big.NewInt(int64(bits)))
 }
 
-func (e *Engine) RotateLeft(bits uint, width BitWidth) {
-	val := uint64(e.CurrentValue)
-	mask := uint64((1 << width) - 1)
-	val &= mask
-	bits = bits % uint(width)
-	result := ((val << bits) | (val >> (uint(width) - bits))) & mask
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(int64(result))
-	e.NewInput = true
+func (e *Engine) RotateLeft(bits uint) {
+	defer e.checkpoint()()
+	val := e.bits(e.IntValue())
+	width := uint(e.BitWidth)
+	bits = bits % width
+	result := new(big.Int).Lsh(val, bits)
+	result.Or(result, new(big.Int).Rsh(val, width-bits))
+	e.setBitwiseResult("RoL", result, val, big.NewInt(int64(bits)))
 }
 
-func (e *Engine) RotateRight(bits uint, width BitWidth) {
-	val := uint64(e.CurrentValue)
-	mask := uint64((1 << width) - 1)
-	val &= mask
-	bits = bits % uint(width)
-	result := ((val >> bits) | (val << (uint(width) - bits))) & mask
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(int64(result))
-	e.NewInput = true
+func (e *Engine) RotateRight(bits uint) {
+	defer e.checkpoint()()
+	val := e.bits(e.IntValue())
+	width := uint(e.BitWidth)
+	bits = bits % width
+	result := new(big.Int).Rsh(val, bits)
+	result.Or(result, new(big.Int).Lsh(val, width-bits))
+	e.setBitwiseResult("RoR", result, val, big.NewInt(int64(bits)))
 }
 
 func (e *Engine) GetBit(position uint) int {
-	val := int64(e.CurrentValue)
-	return int((val >> position) & 1)
+	val := e.bits(e.IntValue())
+	return int(val.Bit(int(position)))
 }
 
 func (e *Engine) SetBit(position uint) {
-	val := int64(e.CurrentValue)
-	result := val | (1 << position)
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+	defer e.checkpoint()()
+	val := e.bits(e.IntValue())
+	result := val.SetBit(val, int(position), 1)
+	e.setIntResult(result)
 }
 
 func (e *Engine) ClearBit(position uint) {
-	val := int64(e.CurrentValue)
-	result := val &^ (1 << position)
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+	defer e.checkpoint()()
+	val := e.bits(e.IntValue())
+	result := val.SetBit(val, int(position), 0)
+	e.setIntResult(result)
 }
 
 func (e *Engine) ToggleBit(position uint) {
-	val := int64(e.CurrentValue)
-	result := val ^ (1 << position)
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+	defer e.checkpoint()()
+	val := e.bits(e.IntValue())
+	result := val.SetBit(val, int(position), val.Bit(int(position))^1)
+	e.setIntResult(result)
 }
 
-func (e *Engine) CountBits() {
-	val := uint64(e.CurrentValue)
-	count := 0
-	for val != 0 {
-		count += int(val & 1)
-		val >>= 1
+// SetBitRange sets the bits at positions from to to, counted from 0, or
+// clears them if set is false, as one step.
+func (e *Engine) SetBitRange(from, to uint, set bool) {
+	defer e.checkpoint()()
+	lastX := e.CurrentValue
+	for pos := from; pos <= to; pos++ {
+		if set {
+			e.SetBit(pos)
+		} else {
+			e.ClearBit(pos)
+		}
+	}
+	if e.Err == nil {
+		e.lastX = lastX
 	}
-	e.CurrentValue = float64(count)
-	e.Display = e.FormatInBase(int64(count))
-	e.NewInput = true
 }
 
-func (e *Engine) LeadingZeros(width BitWidth) {
-	val := uint64(e.CurrentValue)
-	mask := uint64((1 << width) - 1)
-	val &= mask
+func (e *Engine) CountBits() {
+	defer e.checkpoint()()
+	orig := e.IntValue()
+	val := e.bits(orig)
 	count := 0
-	for i := int(width) - 1; i >= 0; i-- {
-		if (val>>uint(i))&1 == 0 {
-			count++
-		} else {
-			break
-		}
+	for i := 0; i < val.BitLen(); i++ {
+		count += int(val.Bit(i))
 	}
-	e.CurrentValue = float64(count)
-	e.Display = e.FormatInBase(int64(count))
-	e.NewInput = true
+	e.setBitwiseResult("Cnt", big.NewInt(int64(count)), orig)
+}
+
+func (e *Engine) LeadingZeros() {
+	defer e.checkpoint()()
+	val := e.bits(e.IntValue())
+	count := int(e.BitWidth) - val.BitLen()
+	e.setBitwiseResult("LZ", big.NewInt(int64(count)), val)
 }
 
 func (e *Engine) TrailingZeros() {
-	val := uint64(e.CurrentValue)
-	if val == 0 {
-		e.CurrentValue = 64
-		e.Display = e.FormatInBase(64)
-		e.NewInput = true
+	defer e.checkpoint()()
+	orig := e.IntValue()
+	val := e.bits(orig)
+	if val.Sign() == 0 {
+		e.setBitwiseResult("TZ", big.NewInt(int64(e.BitWidth)), orig)
 		return
 	}
-	count := 0
-	for (val & 1) == 0 {
-		count++
-		val >>= 1
-	}
-	e.CurrentValue = float64(count)
-	e.Display = e.FormatInBase(int64(count))
-	e.NewInput = true
+	count := val.TrailingZeroBits()
+	e.setBitwiseResult("TZ", big.NewInt(int64(count)), orig)
 }
 
-func (e *Engine) ByteSwap(width BitWidth) {
-	val := uint64(e.CurrentValue)
-	var result uint64
-
-	switch width {
-	case Bits16:
-		result = ((val & 0xFF) << 8) | ((val & 0xFF00) >> 8)
-	case Bits32:
-		result = ((val & 0xFF) << 24) |
-			((val & 0xFF00) << 8) |
-			((val & 0xFF0000) >> 8) |
-			((val & 0xFF000000) >> 24)
-	case Bits64:
-		result = ((val & 0xFF) << 56) |
-			((val & 0xFF00) << 40) |
-			((val & 0xFF0000) << 24) |
-			((val & 0xFF000000) << 8) |
-			((val & 0xFF00000000) >> 8) |
-			((val & 0xFF0000000000) >> 24) |
-			((val & 0xFF000000000000) >> 40) |
-			((val & 0xFF00000000000000) >> 56)
-	default:
-		result = val
+// ByteSwap reverses the order of the bytes of the word, as between big
+// and little endian. A word that is not a whole number of bytes is left
+// as it is.
+func (e *Engine) ByteSwap() {
+	defer e.checkpoint()()
+	val := e.bits(e.IntValue())
+	result := val
+	if e.BitWidth%8 == 0 {
+		b := val.FillBytes(make([]byte, e.BitWidth/8))
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		result = new(big.Int).SetBytes(b)
 	}
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(int64(result))
-	e.NewInput = true
+	e.setBitwiseResult("Swap", result, val)
 }
 
-func (e *Engine) TwosComplement(width BitWidth) {
-	val := int64(e.CurrentValue)
-	mask := int64((1 << width) - 1)
-	result := (^val + 1) & mask
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
-	e.NewInput = true
+func (e *Engine) TwosComplement() {
+	defer e.checkpoint()()
+	val := e.IntValue()
+	result := new(big.Int).Neg(val)
+	e.setBitwiseResult("2's", result, val)
 }
 
+// GetBinaryString writes the low width bits of the current value, in
+// groups of four from the lowest bit.
 func (e *Engine) GetBinaryString(width BitWidth) string {
-	val := uint64(e.CurrentValue)
-	result := ""
-	for i := int(width) - 1; i >= 0; i-- {
-		if (val>>uint(i))&1 == 1 {
-			result += "1"
-		} else {
-			result += "0"
-		}
-		if i > 0 && i%4 == 0 {
-			result += " "
+	val := new(big.Int).And(e.IntValue(), width.mask())
+	digits := val.Text(2)
+	digits = strings.Repeat("0", int(width)-len(digits)) + digits
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%4 == 0 {
+			b.WriteByte(' ')
 		}
+		b.WriteRune(d)
 	}
-	return result
+	return b.String()
 }
 
 func (e *Engine) GetAllBases() map[string]string {
-	val := int64(e.CurrentValue)
+	val := e.IntValue()
 	return map[string]string{
-		"DEC": fmt.Sprintf("%d", val),
-		"HEX": fmt.Sprintf("%X", val),
-		"OCT": fmt.Sprintf("%o", val),
-		"BIN": e.GetBinaryString(Bits64),
+		"DEC": e.formatInt(val, Decimal),
+		"HEX": e.formatInt(val, Hexadecimal),
+		"OCT": e.formatInt(val, Octal),
+		"BIN": e.GetBinaryString(e.BitWidth),
 	}
 }
 
@@ -251,43 +479,94 @@ const (
 	BitOpRightShift
 )
 
+func (op BitwiseOperation) String() string {
+	switch op {
+	case BitOpAnd:
+		return "AND"
+	case BitOpOr:
+		return "OR"
+	case BitOpXor:
+		return "XOR"
+	case BitOpNand:
+		return "NAND"
+	case BitOpNor:
+		return "NOR"
+	case BitOpLeftShift:
+		return "<<"
+	case BitOpRightShift:
+		return ">>"
+	}
+	return ""
+}
+
 func (e *Engine) SetBitwiseOperation(op BitwiseOperation) {
-	if e.PendingOp != OpNone && !e.NewInput {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	if e.RPN {
+		e.StoredValue = e.pop()
+		e.PendingOp = Operation(100 + int(op))
+		e.CalculateBitwise()
+		return
+	}
+	if e.bitwisePending() && e.operandEntered {
+		e.CalculateBitwise()
+	} else if len(e.tokens) > 0 {
 		e.Calculate()
 	}
 	e.StoredValue = e.CurrentValue
 	e.PendingOp = Operation(100 + int(op))
 	e.NewInput = true
+	e.operandEntered = false
 }
 
-func (e *Engine) CalculateBitwise() int64 {
+func (e *Engine) bitwisePending() bool {
+	return e.PendingOp >= 100
+}
+
+func (e *Engine) CalculateBitwise() *big.Int {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return e.IntValue()
+	}
 	op := BitwiseOperation(int(e.PendingOp) - 100)
-	stored := int64(e.StoredValue)
-	current := int64(e.CurrentValue)
-	var result int64
+	stored := e.intValue(e.StoredValue)
+	current := e.IntValue()
+	result := new(big.Int)
 
 	switch op {
 	case BitOpAnd:
-		result = stored & current
+		result.And(stored, current)
 	case BitOpOr:
-		result = stored | current
+		result.Or(stored, current)
 	case BitOpXor:
-		result = stored ^ current
+		result.Xor(stored, current)
 	case BitOpNand:
-		result = ^(stored & current)
+		result.Not(result.And(stored, current))
 	case BitOpNor:
-		result = ^(stored | current)
+		result.Not(result.Or(stored, current))
 	case BitOpLeftShift:
-		result = stored << uint(current)
+		result = e.shiftLeft(stored, shiftCount(current))
 	case BitOpRightShift:
-		result = stored >> uint(current)
+		result = e.shiftRight(stored, shiftCount(current))
 	default:
 		return current
 	}
 
-	e.CurrentValue = float64(result)
-	e.Display = e.FormatInBase(result)
+	e.setBitwiseResult(op.String(), result, stored, current)
 	e.PendingOp = OpNone
-	e.NewInput = true
-	return result
+	return e.wrap(result)
+}
+
+// shiftCount is the number of bits n shifts by. A negative count shifts
+// by nothing, and a count past the largest word by all of it.
+func shiftCount(n *big.Int) uint {
+	switch {
+	case n.Sign() < 0:
+		return 0
+	case n.Cmp(big.NewInt(int64(MaxBitWidth))) > 0:
+		return uint(MaxBitWidth) + 1
+	}
+	return uint(n.Uint64())
 }
@@ -0,0 +1,151 @@
+package calculator
+
+import "testing"
+
+func programmerEngine(width BitWidth, signed, saturate bool) *Engine {
+	e := NewEngine()
+	e.SetProgrammer(true)
+	e.SetBitWidth(width)
+	e.SetSigned(signed)
+	e.SetSaturate(saturate)
+	return e
+}
+
+func TestFlags(t *testing.T) {
+	tests := []struct {
+		width    BitWidth
+		signed   bool
+		saturate bool
+		expr     string
+		want     string
+		flags    string
+	}{
+		{Bits8, false, false, "255 + 1", "0", "C-Z-"},
+		{Bits8, false, false, "0 - 1", "255", "C--N"},
+		{Bits8, false, false, "16 * 16", "0", "CVZ-"},
+		{Bits8, false, false, "100 + 27", "127", "----"},
+		{Bits8, true, false, "127 + 1", "-128", "-V-N"},
+		{Bits8, true, false, "-128 - 1", "127", "-V--"},
+		{Bits8, true, false, "-1 + 1", "0", "C-Z-"},
+		{Bits8, true, false, "-3 * 5", "-15", "C--N"},
+		{Bits16, false, false, "65535 + 1", "0", "C-Z-"},
+		{Bits16, false, false, "300 * 300", "24464", "CV--"},
+		{Bits16, true, false, "32767 + 1", "-32768", "-V-N"},
+		{Bits16, true, false, "-32768 + -1", "32767", "CV--"},
+		{Bits64, false, false, "18446744073709551615 + 1", "0", "C-Z-"},
+		{Bits64, false, false, "0 - 1", "18446744073709551615", "C--N"},
+		{Bits64, true, false, "9223372036854775807 + 1", "-9223372036854775808", "-V-N"},
+		{Bits64, true, false, "-9223372036854775808 - 1", "9223372036854775807", "-V--"},
+		{12, false, false, "4095 + 1", "0", "C-Z-"},
+		{12, false, false, "2047 + 1", "2048", "-V-N"},
+		{12, true, false, "2047 + 1", "-2048", "-V-N"},
+		{12, true, false, "-2048 - 1", "2047", "-V--"},
+		{1, false, false, "1 + 1", "0", "CVZ-"},
+		{1, true, false, "-1 + 0", "-1", "---N"},
+	}
+	for _, tt := range tests {
+		e := programmerEngine(tt.width, tt.signed, tt.saturate)
+		if _, err := e.Execute(tt.expr); err != nil {
+			t.Errorf("%d-bit signed=%v: %s: %v", tt.width, tt.signed, tt.expr, err)
+			continue
+		}
+		if e.Display != tt.want || e.Flags.String() != tt.flags {
+			t.Errorf("%d-bit signed=%v: %s = %s %s, want %s %s",
+				tt.width, tt.signed, tt.expr, e.Display, e.Flags, tt.want, tt.flags)
+		}
+	}
+}
+
+func TestSaturate(t *testing.T) {
+	tests := []struct {
+		width  BitWidth
+		signed bool
+		expr   string
+		want   string
+		flags  string
+	}{
+		{Bits8, false, "200 + 100", "255", "C--N"},
+		{Bits8, false, "5 - 10", "0", "C-Z-"},
+		{Bits8, false, "16 * 16", "255", "CV-N"},
+		{Bits8, true, "100 + 100", "127", "-V--"},
+		{Bits8, true, "-100 - 100", "-128", "-V-N"},
+		{Bits8, true, "-100 + 50", "-50", "---N"},
+		{Bits16, false, "300 * 300", "65535", "CV-N"},
+		{Bits16, false, "65535 + 1", "65535", "C--N"},
+		{Bits16, true, "32767 + 1", "32767", "-V--"},
+		{Bits16, true, "-32768 - 1", "-32768", "-V-N"},
+		{Bits64, false, "18446744073709551615 + 1", "18446744073709551615", "C--N"},
+		{Bits64, false, "0 - 1", "0", "C-Z-"},
+		{Bits64, true, "9223372036854775807 * 2", "9223372036854775807", "-V--"},
+		{Bits64, true, "-9223372036854775808 - 1", "-9223372036854775808", "-V-N"},
+		{12, false, "4095 + 1", "4095", "C--N"},
+		{12, true, "2047 + 1", "2047", "-V--"},
+		{12, true, "-2048 * 2", "-2048", "CV-N"},
+		{1, false, "1 + 1", "1", "CV-N"},
+		{1, true, "-1 + -1", "-1", "CV-N"},
+	}
+	for _, tt := range tests {
+		e := programmerEngine(tt.width, tt.signed, true)
+		if _, err := e.Execute(tt.expr); err != nil {
+			t.Errorf("%d-bit signed=%v: %s: %v", tt.width, tt.signed, tt.expr, err)
+			continue
+		}
+		if e.Display != tt.want || e.Flags.String() != tt.flags {
+			t.Errorf("%d-bit signed=%v: %s = %s %s, want %s %s",
+				tt.width, tt.signed, tt.expr, e.Display, e.Flags, tt.want, tt.flags)
+		}
+	}
+}
+
+func TestShiftFlags(t *testing.T) {
+	tests := []struct {
+		width  BitWidth
+		signed bool
+		value  string
+		left   bool
+		bits   uint
+		want   string
+		flags  string
+	}{
+		{Bits8, false, "129", true, 1, "2", "CV--"},
+		{Bits8, false, "64", true, 1, "128", "-V-N"},
+		{Bits8, false, "3", false, 1, "1", "C---"},
+		{Bits8, true, "-128", false, 7, "-1", "---N"},
+		{Bits16, false, "32768", true, 1, "0", "CVZ-"},
+		{Bits64, true, "1", true, 63, "-9223372036854775808", "-V-N"},
+		{12, false, "2049", true, 1, "2", "CV--"},
+		{12, true, "-2048", false, 12, "-1", "C--N"},
+	}
+	for _, tt := range tests {
+		e := programmerEngine(tt.width, tt.signed, false)
+		if _, err := e.Execute(tt.value); err != nil {
+			t.Fatal(err)
+		}
+		if tt.left {
+			e.LeftShift(tt.bits)
+		} else {
+			e.RightShift(tt.bits)
+		}
+		if e.Display != tt.want || e.Flags.String() != tt.flags {
+			t.Errorf("%d-bit signed=%v: %s shifted %d left=%v = %s %s, want %s %s",
+				tt.width, tt.signed, tt.value, tt.bits, tt.left, e.Display, e.Flags, tt.want, tt.flags)
+		}
+	}
+}
+
+func TestClearResetsFlags(t *testing.T) {
+	e := programmerEngine(Bits8, false, false)
+	if _, err := e.Execute("255 + 1"); err != nil {
+		t.Fatal(err)
+	}
+	e.Clear()
+	if e.Flags != (Flags{}) {
+		t.Errorf("flags after Clear = %s, want ----", e.Flags)
+	}
+	if _, err := e.Execute("1 + 1"); err != nil {
+		t.Fatal(err)
+	}
+	if e.Flags.String() != "----" {
+		t.Errorf("1 + 1 after Clear: flags %s, want ----", e.Flags)
+	}
+}
@@ -0,0 +1,356 @@
+package calculator
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RationalNumber is a fraction. It is exact unless digits is set: then it
+// approximates a result without a rational value, such as sqrt(2), to that
+// many significant digits.
+type RationalNumber struct {
+	rat    *big.Rat
+	digits int
+}
+
+func (r *RationalNumber) Rat() *big.Rat {
+	return new(big.Rat).Set(r.rat)
+}
+
+func (r *RationalNumber) Float64() float64 {
+	f, _ := r.rat.Float64()
+	return f
+}
+
+// String returns the fraction as n/d, or just n for whole numbers. An
+// inexact fraction is written as a decimal with two digits more than it
+// was computed to, which Parse reads back as inexact.
+func (r *RationalNumber) String() string {
+	if r.digits > 0 {
+		return NewDecimalArithmetic(r.digits + 2).Convert(newRational(r.rat)).String()
+	}
+	return r.rat.RatString()
+}
+
+// Mixed returns the fraction as a mixed number such as "1 2/3".
+func (r *RationalNumber) Mixed() string {
+	if r.rat.IsInt() {
+		return r.rat.Num().String()
+	}
+	num := new(big.Int).Abs(r.rat.Num())
+	den := r.rat.Denom()
+	whole, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	sign := ""
+	if r.rat.Sign() < 0 {
+		sign = "-"
+	}
+	if whole.Sign() == 0 {
+		return sign + rem.String() + "/" + den.String()
+	}
+	return sign + whole.String() + " " + rem.String() + "/" + den.String()
+}
+
+type FractionDisplay int
+
+const (
+	FractionSimple FractionDisplay = iota
+	FractionMixed
+	FractionDecimal
+)
+
+// RationalArithmetic computes exactly on fractions. Functions without a
+// rational result, such as sin or a non-square root, are computed to
+// Digits significant digits and give inexact fractions, which are shown in
+// decimal form.
+type RationalArithmetic struct {
+	Digits int
+}
+
+func NewRationalArithmetic(digits int) *RationalArithmetic {
+	return &RationalArithmetic{Digits: digits}
+}
+
+func newRational(r *big.Rat) *RationalNumber {
+	return &RationalNumber{rat: r}
+}
+
+// Parse accepts integers, decimals, n/d fractions and mixed numbers
+// written as "w n/d". A decimal with more significant digits than Digits,
+// as String writes an inexact fraction, is read as inexact.
+func (a *RationalArithmetic) Parse(s string) (Number, error) {
+	s = strings.TrimSpace(s)
+	if whole, frac, ok := strings.Cut(s, " "); ok {
+		w, ok1 := new(big.Rat).SetString(whole)
+		f, ok2 := new(big.Rat).SetString(strings.TrimSpace(frac))
+		if !ok1 || !ok2 || !w.IsInt() || f.Sign() < 0 {
+			return nil, errInvalidNumber
+		}
+		if w.Sign() < 0 || strings.HasPrefix(whole, "-") {
+			f.Neg(f)
+		}
+		return newRational(w.Add(w, f)), nil
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, errInvalidNumber
+	}
+	n := newRational(r)
+	if significantDigits(s) > a.Digits {
+		n.digits = a.Digits
+	}
+	return n, nil
+}
+
+// significantDigits counts the digits of a decimal such as "0.0120" or
+// "1.5e-7" from the first nonzero one, or gives 0 for an integer or a
+// fraction.
+func significantDigits(s string) int {
+	mantissa, _, _ := strings.Cut(strings.ToLower(s), "e")
+	whole, frac, ok := strings.Cut(strings.TrimLeft(mantissa, "+-"), ".")
+	if !ok {
+		return 0
+	}
+	return len(strings.TrimLeft(whole+frac, "0"))
+}
+
+// FromFloat gives an inexact fraction with the 15 significant digits a
+// float64 reliably carries.
+func (a *RationalArithmetic) FromFloat(f float64) Number {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', 15, 64))
+	if !ok {
+		r = new(big.Rat)
+	}
+	return &RationalNumber{rat: r, digits: a.Digits}
+}
+
+// fromFloat gives the inexact fraction of f to the working precision.
+func (a *RationalArithmetic) fromFloat(f *big.Float) (Number, error) {
+	zero, err := floatBeyondRange(f)
+	if err != nil {
+		return nil, err
+	}
+	if zero {
+		return a.FromInt(new(big.Int)), nil
+	}
+	n, err := a.Parse(floatText(f, a.Digits+2))
+	if err != nil {
+		return nil, err
+	}
+	return &RationalNumber{rat: n.(*RationalNumber).rat, digits: a.Digits}, nil
+}
+
+func (a *RationalArithmetic) FromInt(i *big.Int) Number {
+	return newRational(new(big.Rat).SetInt(i))
+}
+
+func (a *RationalArithmetic) Convert(n Number) Number {
+	switch v := n.(type) {
+	case nil:
+		return newRational(new(big.Rat))
+	case *RationalNumber:
+		return v
+	case *DecimalNumber:
+		r := new(big.Rat).SetInt(v.coef)
+		if v.exp >= 0 {
+			return newRational(r.Mul(r, new(big.Rat).SetInt(pow10(v.exp))))
+		}
+		return newRational(r.Quo(r, new(big.Rat).SetInt(pow10(-v.exp))))
+	}
+	return a.FromFloat(n.Float64())
+}
+
+func (a *RationalArithmetic) rat(n Number) *big.Rat {
+	return a.Convert(n).(*RationalNumber).rat
+}
+
+// result gives r computed from operands. It is inexact if any of them is,
+// to the fewest digits among them.
+func (a *RationalArithmetic) result(r *big.Rat, operands ...Number) Number {
+	n := newRational(r)
+	for _, x := range operands {
+		if d := a.Convert(x).(*RationalNumber).digits; d > 0 && (n.digits == 0 || d < n.digits) {
+			n.digits = d
+		}
+	}
+	return n
+}
+
+func (a *RationalArithmetic) Int(n Number) *big.Int {
+	r := a.rat(n)
+	return new(big.Int).Quo(r.Num(), r.Denom())
+}
+
+func (a *RationalArithmetic) Add(x, y Number) Number {
+	return a.result(new(big.Rat).Add(a.rat(x), a.rat(y)), x, y)
+}
+
+func (a *RationalArithmetic) Sub(x, y Number) Number {
+	return a.result(new(big.Rat).Sub(a.rat(x), a.rat(y)), x, y)
+}
+
+func (a *RationalArithmetic) Mul(x, y Number) Number {
+	return a.result(new(big.Rat).Mul(a.rat(x), a.rat(y)), x, y)
+}
+
+func (a *RationalArithmetic) Quo(x, y Number) (Number, error) {
+	if a.rat(y).Sign() == 0 {
+		return nil, ErrDivideByZero
+	}
+	return a.result(new(big.Rat).Quo(a.rat(x), a.rat(y)), x, y), nil
+}
+
+// Mod returns the remainder of x/y with the sign of x, like math.Mod.
+func (a *RationalArithmetic) Mod(x, y Number) (Number, error) {
+	q, err := a.Quo(x, y)
+	if err != nil {
+		return nil, err
+	}
+	trunc := new(big.Rat).SetInt(a.Int(q))
+	return a.result(new(big.Rat).Sub(a.rat(x), trunc.Mul(trunc, a.rat(y))), x, y), nil
+}
+
+func (a *RationalArithmetic) Pow(x, y Number) (Number, error) {
+	base, exp := a.rat(x), a.rat(y)
+	exact := exp.Num().IsInt64() && abs64(exp.Num().Int64()) <= maxExactExponent
+	if exp.IsInt() && exact {
+		if exp.Sign() < 0 && base.Sign() == 0 {
+			return nil, ErrDivideByZero
+		}
+		return a.result(ratPow(base, exp.Num().Int64()), x, y), nil
+	}
+	switch base.Sign() {
+	case 0:
+		if exp.Sign() < 0 {
+			return nil, ErrDivideByZero
+		}
+		return a.result(new(big.Rat), x, y), nil
+	case -1:
+		if !exp.IsInt() {
+			return nil, errDomain
+		}
+	}
+	// A base whose numerator and denominator are perfect powers, such as
+	// 4/9 to the 1/2, has an exact root.
+	if exact && base.Sign() > 0 && exp.Denom().IsInt64() {
+		if root, ok := ratRoot(base, exp.Denom().Int64()); ok {
+			return a.result(ratPow(root, exp.Num().Int64()), x, y), nil
+		}
+	}
+	prec := floatPrec(a.Digits)
+	f, ok := floatPow(newFloat(prec).SetRat(new(big.Rat).Abs(base)), newFloat(prec).SetRat(exp))
+	if !ok {
+		return nil, ErrOverflow
+	}
+	if base.Sign() < 0 && exp.Num().Bit(0) == 1 {
+		f.Neg(f)
+	}
+	return a.fromFloat(f)
+}
+
+// ratPow returns r^n. r must not be zero if n is negative.
+func ratPow(r *big.Rat, n int64) *big.Rat {
+	if n < 0 {
+		r = new(big.Rat).Inv(r)
+		n = -n
+	}
+	e := big.NewInt(n)
+	num := new(big.Int).Exp(r.Num(), e, nil)
+	den := new(big.Int).Exp(r.Denom(), e, nil)
+	return new(big.Rat).SetFrac(num, den)
+}
+
+// ratRoot returns the k-th root of r, which is not negative, if its
+// numerator and denominator are both perfect k-th powers.
+func ratRoot(r *big.Rat, k int64) (*big.Rat, bool) {
+	num, ok := intRoot(r.Num(), k)
+	if !ok {
+		return nil, false
+	}
+	den, ok := intRoot(r.Denom(), k)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Rat).SetFrac(num, den), true
+}
+
+// intRoot returns the k-th root of n, which is not negative, if n is a
+// perfect k-th power.
+func intRoot(n *big.Int, k int64) (*big.Int, bool) {
+	if n.Cmp(big.NewInt(1)) <= 0 {
+		return new(big.Int).Set(n), true
+	}
+	// Any other n is at least 2, so its root is above 1, and below 2 once
+	// k is as large as its bit length.
+	if k >= int64(n.BitLen()) {
+		return nil, false
+	}
+	// Newton's method from a guess above the root falls to its floor
+	bk := big.NewInt(k)
+	k1 := big.NewInt(k - 1)
+	x := new(big.Int).Lsh(big.NewInt(1), uint((int64(n.BitLen())+k-1)/k))
+	for {
+		y := new(big.Int).Exp(x, k1, nil)
+		y.Quo(n, y)
+		y.Add(y, new(big.Int).Mul(k1, x))
+		y.Quo(y, bk)
+		if y.Cmp(x) >= 0 {
+			break
+		}
+		x = y
+	}
+	return x, new(big.Int).Exp(x, bk, nil).Cmp(n) == 0
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (a *RationalArithmetic) Neg(x Number) Number {
+	return a.result(new(big.Rat).Neg(a.rat(x)), x)
+}
+
+func (a *RationalArithmetic) Sign(x Number) int {
+	return a.rat(x).Sign()
+}
+
+func (a *RationalArithmetic) Cmp(x, y Number) int {
+	return a.rat(x).Cmp(a.rat(y))
+}
+
+func (a *RationalArithmetic) Floor(x Number) Number {
+	r := a.rat(x)
+	return a.result(new(big.Rat).SetInt(new(big.Int).Div(r.Num(), r.Denom())), x)
+}
+
+func (a *RationalArithmetic) Ceil(x Number) Number {
+	return a.Neg(a.Floor(a.Neg(x)))
+}
+
+// Round rounds half away from zero to an integer.
+func (a *RationalArithmetic) Round(x Number) Number {
+	half := big.NewRat(1, 2)
+	if a.Sign(x) < 0 {
+		return a.Neg(a.Floor(a.result(new(big.Rat).Add(a.rat(a.Neg(x)), half), x)))
+	}
+	return a.Floor(a.result(new(big.Rat).Add(a.rat(x), half), x))
+}
+
+// Sqrt is exact when numerator and denominator are both perfect squares.
+// Otherwise it is computed to Digits significant digits.
+func (a *RationalArithmetic) Sqrt(x Number) (Number, error) {
+	r := a.rat(x)
+	if r.Sign() < 0 {
+		return nil, errDomain
+	}
+	num := new(big.Int).Sqrt(r.Num())
+	den := new(big.Int).Sqrt(r.Denom())
+	if new(big.Int).Mul(num, num).Cmp(r.Num()) == 0 && new(big.Int).Mul(den, den).Cmp(r.Denom()) == 0 {
+		return a.result(new(big.Rat).SetFrac(num, den), x), nil
+	}
+	f := newFloat(floatPrec(a.Digits)).SetRat(r)
+	return a.fromFloat(f.Sqrt(f))
+}
@@ -0,0 +1,340 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// Keypad is a set of the keypads an operation has a key on.
+type Keypad uint8
+
+const (
+	StandardKeypad Keypad = 1 << iota
+	ScientificKeypad
+	ProgrammerKeypad
+	// StackKeypad holds the RPN stack keys, shown in every mode when RPN
+	// is on.
+	StackKeypad
+)
+
+// KeySettings are the keypad settings some keys depend on.
+type KeySettings struct {
+	// Shift is the number of bits the shift and rotate keys move by.
+	Shift uint
+}
+
+// Op describes an operation: its key, how it is written in expressions,
+// and how it is computed. The registry of operations generates the
+// keypads, the keyboard shortcuts, the functions and constants of
+// expressions, and the help screen.
+type Op struct {
+	// Name is how the operation is called in expressions and by Press,
+	// such as "sqrt". It is matched without regard to case.
+	Name string
+	// Symbol is the key label, such as "√". It defaults to Name.
+	Symbol string
+	// Help is a short description for the help screen and tooltips.
+	Help string
+	// Arity is the number of values the operation takes: 0 for constants
+	// and entry keys, 1 for functions of X and 2 for operators.
+	Arity int
+	// Domain describes where a function is undefined, such as "x < 0",
+	// for its error message.
+	Domain string
+	// Keypads are the keypads the operation has a key on.
+	Keypads Keypad
+	// Shortcut is the default keyboard shortcut, such as "Ctrl+S" or "&",
+	// in the modes of Keypads.
+	Shortcut string
+
+	// Real computes a function in float64. Exact, when set, works on the
+	// engine's Number directly so the result keeps the working precision.
+	// Precise, when set, computes on big.Float at the working precision
+	// instead, outside complex mode. Complex, when set, gives the principal
+	// value in complex mode.
+	Real    func(*Engine, float64) (float64, error)
+	Exact   func(*Engine, Number) (Number, error)
+	Precise func(*Engine, *big.Float) (*big.Float, error)
+	Complex func(*Engine, complex128) (complex128, error)
+	// Angle marks the functions of an angle, such as sin, whose argument
+	// is reduced by whole turns exactly before Precise computes them.
+	Angle bool
+	// Value gives the value of a constant at the working precision.
+	Value func(*Engine) Number
+	// Key is what the key does, for operations that are not a plain
+	// function or constant, such as operators and entry keys.
+	Key func(*Engine, KeySettings) error
+
+	// infix marks the operators that can be written between two values
+	// in an expression.
+	infix bool
+}
+
+// IsFunction reports whether op is a function of one value, which
+// expressions can call by name.
+func (op *Op) IsFunction() bool {
+	return op.Real != nil || op.Exact != nil
+}
+
+// IsConstant reports whether op is a constant, which expressions can use
+// by name.
+func (op *Op) IsConstant() bool {
+	return op.Value != nil
+}
+
+// Expression returns how op is written in an expression, such as
+// "sqrt(x)", "pi" or "x mod y", or "" for a key that has no written form.
+func (op *Op) Expression() string {
+	switch {
+	case op.IsFunction():
+		return op.Name + "(x)"
+	case op.IsConstant():
+		return op.Name
+	case op.infix:
+		return "x " + op.Name + " y"
+	}
+	return ""
+}
+
+var (
+	registry  []*Op
+	opsByName = map[string]*Op{}
+	// functions and expressionConstants are the functions and constants
+	// of the registry, by lower-case name.
+	functions           = map[string]*Op{}
+	expressionConstants = map[string]*Op{}
+)
+
+func init() {
+	for _, op := range builtinOps {
+		if err := Register(op); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register adds op to the end of the registry, such as a constant from a
+// constants pack. A function or constant can then be used in expressions
+// by name, and the keypads and help screen built afterwards show it.
+// Register is meant to be called at startup, before engines are in use.
+func Register(op *Op) error {
+	name := strings.ToLower(op.Name)
+	if name == "" {
+		return errors.New("operation without a name")
+	}
+	if _, ok := opsByName[name]; ok {
+		return fmt.Errorf("%s is already registered", op.Name)
+	}
+	named := op.IsFunction() || op.IsConstant()
+	if named && !isIdentifier(name) {
+		return fmt.Errorf("invalid function or constant name %q", op.Name)
+	}
+	if op.Symbol == "" {
+		op.Symbol = op.Name
+	}
+	registry = append(registry, op)
+	opsByName[name] = op
+	switch {
+	case op.IsFunction():
+		functions[name] = op
+	case op.IsConstant():
+		expressionConstants[name] = op
+		// A constant can also be written as its symbol, such as π.
+		if symbol := strings.ToLower(op.Symbol); isIdentifier(symbol) {
+			expressionConstants[symbol] = op
+		}
+	}
+	if op.Domain != "" {
+		domainConditions[op.Name] = op.Domain
+	}
+	return nil
+}
+
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if !(unicode.IsLetter(r) || r == '_' || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// Ops returns the registered operations in keypad order.
+func Ops() []*Op {
+	return append([]*Op(nil), registry...)
+}
+
+// LookupOp returns the operation called name.
+func LookupOp(name string) (*Op, bool) {
+	op, ok := opsByName[strings.ToLower(name)]
+	return op, ok
+}
+
+// Press is the key of the operation called name: a function applies to the
+// displayed value, a constant is recalled, and other keys do what their
+// Key does with the keypad settings s.
+func (e *Engine) Press(name string, s KeySettings) error {
+	op, ok := LookupOp(name)
+	if !ok {
+		return fmt.Errorf("unknown operation %q", name)
+	}
+	switch {
+	case op.Key != nil:
+		return op.Key(e, s)
+	case op.IsFunction():
+		return e.applyFunction(strings.ToLower(op.Name))
+	case op.IsConstant():
+		e.recallConstant(op.Value(e))
+	}
+	return e.Err
+}
+
+// key adapts an Engine method to Op.Key.
+func key(f func(*Engine)) func(*Engine, KeySettings) error {
+	return func(e *Engine, _ KeySettings) error {
+		f(e)
+		return e.Err
+	}
+}
+
+// operatorKey is the key of an arithmetic operator.
+func operatorKey(op Operation) func(*Engine, KeySettings) error {
+	return key(func(e *Engine) { e.SetOperation(op) })
+}
+
+// bitwiseKey is the key of a bitwise operator.
+func bitwiseKey(op BitwiseOperation) func(*Engine, KeySettings) error {
+	return key(func(e *Engine) { e.SetBitwiseOperation(op) })
+}
+
+// builtinOps are the built-in operations in keypad order: the scientific
+// keypad fills rows of five and the programmer keypad rows of four.
+var builtinOps = []*Op{
+	{Name: "sin", Help: "Sine", Keypads: ScientificKeypad, Shortcut: "Ctrl+S", Arity: 1,
+		Real: (*Engine).sin, Precise: (*Engine).preciseSin, Complex: (*Engine).complexSin,
+		Angle: true},
+	{Name: "cos", Help: "Cosine", Keypads: ScientificKeypad, Shortcut: "Ctrl+C", Arity: 1,
+		Real: (*Engine).cos, Precise: (*Engine).preciseCos, Complex: (*Engine).complexCos,
+		Angle: true},
+	{Name: "tan", Help: "Tangent", Keypads: ScientificKeypad, Shortcut: "Ctrl+T", Arity: 1,
+		Real: (*Engine).tan, Precise: (*Engine).preciseTan, Complex: (*Engine).complexTan,
+		Angle: true},
+	{Name: "log", Help: "Common logarithm", Keypads: ScientificKeypad, Shortcut: "Ctrl+L", Arity: 1, Domain: "x ≤ 0",
+		Real: (*Engine).log, Precise: (*Engine).preciseLog, Complex: (*Engine).complexLog},
+	{Name: "ln", Help: "Natural logarithm", Keypads: ScientificKeypad, Shortcut: "Ctrl+N", Arity: 1, Domain: "x ≤ 0",
+		Real: (*Engine).ln, Precise: (*Engine).preciseLn, Complex: (*Engine).complexLn},
+
+	{Name: "asin", Help: "Inverse sine", Keypads: ScientificKeypad, Arity: 1, Domain: "|x| > 1",
+		Real: (*Engine).asin, Precise: (*Engine).preciseAsin, Complex: (*Engine).complexAsin},
+	{Name: "acos", Help: "Inverse cosine", Keypads: ScientificKeypad, Arity: 1, Domain: "|x| > 1",
+		Real: (*Engine).acos, Precise: (*Engine).preciseAcos, Complex: (*Engine).complexAcos},
+	{Name: "atan", Help: "Inverse tangent", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).atan, Precise: (*Engine).preciseAtan, Complex: (*Engine).complexAtan},
+	{Name: "exp10", Symbol: "10ˣ", Help: "Ten to the power x", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).exp10, Exact: (*Engine).exactExp10, Complex: (*Engine).complexExp10},
+	{Name: "exp", Symbol: "eˣ", Help: "e to the power x", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).exp, Precise: (*Engine).preciseExp, Complex: (*Engine).complexExp},
+
+	{Name: "sinh", Help: "Hyperbolic sine", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).sinh, Precise: (*Engine).preciseSinh, Complex: (*Engine).complexSinh},
+	{Name: "cosh", Help: "Hyperbolic cosine", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).cosh, Precise: (*Engine).preciseCosh, Complex: (*Engine).complexCosh},
+	{Name: "tanh", Help: "Hyperbolic tangent", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).tanh, Precise: (*Engine).preciseTanh, Complex: (*Engine).complexTanh},
+	{Name: "sqr", Symbol: "x²", Help: "Square", Keypads: StandardKeypad | ScientificKeypad, Arity: 1,
+		Real: (*Engine).square, Exact: (*Engine).exactSquare, Complex: (*Engine).complexSquare},
+	{Name: "cube", Symbol: "x³", Help: "Cube", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).cube, Exact: (*Engine).exactCube, Complex: (*Engine).complexCube},
+
+	{Name: "asinh", Help: "Inverse hyperbolic sine", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).asinh, Precise: (*Engine).preciseAsinh, Complex: (*Engine).complexAsinh},
+	{Name: "acosh", Help: "Inverse hyperbolic cosine", Keypads: ScientificKeypad, Arity: 1, Domain: "x < 1",
+		Real: (*Engine).acosh, Precise: (*Engine).preciseAcosh, Complex: (*Engine).complexAcosh},
+	{Name: "atanh", Help: "Inverse hyperbolic tangent", Keypads: ScientificKeypad, Arity: 1, Domain: "|x| ≥ 1",
+		Real: (*Engine).atanh, Precise: (*Engine).preciseAtanh, Complex: (*Engine).complexAtanh},
+	{Name: "log2", Symbol: "log₂", Help: "Binary logarithm", Keypads: ScientificKeypad, Arity: 1, Domain: "x ≤ 0",
+		Real: (*Engine).log2, Precise: (*Engine).preciseLog2, Complex: (*Engine).complexLog2},
+	{Name: "exp2", Symbol: "2ˣ", Help: "Two to the power x", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).exp2, Exact: (*Engine).exactExp2, Complex: (*Engine).complexExp2},
+
+	{Name: "pi", Symbol: "π", Help: "The ratio of a circle's circumference to its diameter", Keypads: ScientificKeypad, Shortcut: "Ctrl+P",
+		Value: (*Engine).piValue},
+	{Name: "e", Help: "The base of the natural logarithm", Keypads: ScientificKeypad, Shortcut: "Ctrl+E",
+		Value: (*Engine).eValue},
+	{Name: "fact", Symbol: "n!", Help: "Factorial, also written x!", Keypads: ScientificKeypad, Arity: 1, Domain: "negative or non-integer x",
+		Real: (*Engine).factorial, Exact: (*Engine).exactFactorial},
+	{Name: "sqrt", Symbol: "√", Help: "Square root", Keypads: StandardKeypad | ScientificKeypad, Shortcut: "Ctrl+R", Arity: 1, Domain: "x < 0",
+		Real: (*Engine).sqrt, Exact: (*Engine).exactSqrt, Complex: (*Engine).complexSqrt},
+	{Name: "cbrt", Symbol: "∛", Help: "Cube root", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).cbrt, Precise: (*Engine).preciseCbrt, Complex: (*Engine).complexCbrt},
+
+	{Name: "(", Help: "Open a parenthesis", Keypads: ScientificKeypad, Shortcut: "(",
+		Key: key((*Engine).OpenParen)},
+	{Name: ")", Help: "Close a parenthesis", Keypads: ScientificKeypad, Shortcut: ")",
+		Key: key((*Engine).CloseParen)},
+	{Name: "^", Symbol: "xʸ", Help: "x to the power y", Keypads: ScientificKeypad, Shortcut: "^", Arity: 2, Domain: "x < 0 and non-integer y",
+		Key: operatorKey(OpPower), infix: true},
+	{Name: "mod", Help: "Remainder of x divided by y", Keypads: ScientificKeypad, Arity: 2, Domain: "complex operands",
+		Key: operatorKey(OpModulo), infix: true},
+	{Name: "EE", Symbol: "EXP", Help: "Enter an exponent of ten", Keypads: ScientificKeypad,
+		Key: key((*Engine).InputExponent)},
+
+	{Name: "abs", Symbol: "|x|", Help: "Absolute value", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).abs, Exact: (*Engine).exactAbs, Complex: (*Engine).complexAbs},
+	{Name: "floor", Symbol: "⌊x⌋", Help: "Round down", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).floor, Exact: (*Engine).exactFloor},
+	{Name: "ceil", Symbol: "⌈x⌉", Help: "Round up", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).ceil, Exact: (*Engine).exactCeil},
+	{Name: "round", Help: "Round to the nearest integer", Keypads: ScientificKeypad, Arity: 1,
+		Real: (*Engine).round, Exact: (*Engine).exactRound},
+	{Name: "recip", Symbol: "1/x", Help: "Reciprocal", Keypads: StandardKeypad | ScientificKeypad, Arity: 1,
+		Real: (*Engine).reciprocal, Exact: (*Engine).exactReciprocal, Complex: (*Engine).complexReciprocal},
+
+	{Name: "and", Symbol: "AND", Help: "Bitwise and", Keypads: ProgrammerKeypad, Shortcut: "&", Arity: 2,
+		Key: bitwiseKey(BitOpAnd)},
+	{Name: "or", Symbol: "OR", Help: "Bitwise or", Keypads: ProgrammerKeypad, Shortcut: "|", Arity: 2,
+		Key: bitwiseKey(BitOpOr)},
+	{Name: "xor", Symbol: "XOR", Help: "Bitwise exclusive or", Keypads: ProgrammerKeypad, Shortcut: "^", Arity: 2,
+		Key: bitwiseKey(BitOpXor)},
+	{Name: "not", Symbol: "NOT", Help: "Invert every bit", Keypads: ProgrammerKeypad, Shortcut: "~", Arity: 1,
+		Key: key((*Engine).Not)},
+
+	{Name: "nand", Symbol: "NAND", Help: "Bitwise not and", Keypads: ProgrammerKeypad, Arity: 2,
+		Key: bitwiseKey(BitOpNand)},
+	{Name: "nor", Symbol: "NOR", Help: "Bitwise not or", Keypads: ProgrammerKeypad, Arity: 2,
+		Key: bitwiseKey(BitOpNor)},
+	{Name: "shl", Symbol: "<<", Help: "Shift left by the shift amount", Keypads: ProgrammerKeypad, Shortcut: "<", Arity: 1,
+		Key: func(e *Engine, s KeySettings) error { e.LeftShift(s.Shift); return e.Err }},
+	{Name: "shr", Symbol: ">>", Help: "Shift right by the shift amount", Keypads: ProgrammerKeypad, Shortcut: ">", Arity: 1,
+		Key: func(e *Engine, s KeySettings) error { e.RightShift(s.Shift); return e.Err }},
+
+	{Name: "rol", Symbol: "RoL", Help: "Rotate left within the word by the shift amount", Keypads: ProgrammerKeypad, Arity: 1,
+		Key: func(e *Engine, s KeySettings) error { e.RotateLeft(s.Shift); return e.Err }},
+	{Name: "ror", Symbol: "RoR", Help: "Rotate right within the word by the shift amount", Keypads: ProgrammerKeypad, Arity: 1,
+		Key: func(e *Engine, s KeySettings) error { e.RotateRight(s.Shift); return e.Err }},
+	{Name: "popcount", Symbol: "Cnt", Help: "Count the set bits", Keypads: ProgrammerKeypad, Arity: 1,
+		Key: key((*Engine).CountBits)},
+	{Name: "twos", Symbol: "2's", Help: "Two's complement within the word", Keypads: ProgrammerKeypad, Arity: 1,
+		Key: key((*Engine).TwosComplement)},
+
+	{Name: "clz", Symbol: "LZ", Help: "Count the leading zeros of the word", Keypads: ProgrammerKeypad, Arity: 1,
+		Key: key((*Engine).LeadingZeros)},
+	{Name: "ctz", Symbol: "TZ", Help: "Count the trailing zeros", Keypads: ProgrammerKeypad, Arity: 1,
+		Key: key((*Engine).TrailingZeros)},
+	{Name: "byteswap", Symbol: "Swap", Help: "Reverse the bytes of the word", Keypads: ProgrammerKeypad, Arity: 1,
+		Key: key((*Engine).ByteSwap)},
+
+	{Name: "swap", Symbol: "x↔y", Help: "Swap X and Y", Keypads: StackKeypad,
+		Key: key((*Engine).Swap)},
+	{Name: "rolldown", Symbol: "R↓", Help: "Roll the stack down", Keypads: StackKeypad,
+		Key: key((*Engine).RollDown)},
+	{Name: "rollup", Symbol: "R↑", Help: "Roll the stack up", Keypads: StackKeypad,
+		Key: key((*Engine).RollUp)},
+	{Name: "drop", Symbol: "Drop", Help: "Drop X", Keypads: StackKeypad,
+		Key: key((*Engine).Drop)},
+	{Name: "lastx", Symbol: "LASTx", Help: "Recall X from before the last operation", Keypads: StackKeypad,
+		Key: key((*Engine).LastX)},
+}
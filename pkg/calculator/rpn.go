@@ -0,0 +1,258 @@
+package calculator
+
+import "strings"
+
+// DefaultStackDepth is the number of registers in the RPN stack of a new
+// Engine: X, Y, Z and T, as on HP calculators.
+const DefaultStackDepth = 4
+
+// SetRPN switches between algebraic entry and Reverse Polish Notation. In
+// RPN mode Enter copies X, the displayed value, up the stack, and the
+// operator keys combine Y and X at once instead of waiting for Calculate.
+// Functions of one value work on X in both modes. Switching drops any
+// expression being entered and keeps the displayed value as X.
+func (e *Engine) SetRPN(on bool) {
+	defer e.checkpoint()()
+	if e.RPN == on {
+		return
+	}
+	e.RPN = on
+	e.tokens = nil
+	e.parenDepth = 0
+	e.PendingOp = OpNone
+	e.stack = nil
+	e.fillStack()
+	e.lift = true
+	e.redisplay()
+}
+
+// SetStackDepth sets the number of RPN registers including X, such as
+// DefaultStackDepth, or 0 for a stack that grows as needed. Registers
+// beyond a smaller depth are lost.
+func (e *Engine) SetStackDepth(depth int) {
+	defer e.checkpoint()()
+	if depth < 0 {
+		depth = 0
+	} else if depth == 1 {
+		depth = 2
+	}
+	e.StackDepth = depth
+	e.fillStack()
+}
+
+// Stack returns the RPN registers above X, starting with Y.
+func (e *Engine) Stack() []Number {
+	return append([]Number(nil), e.stack...)
+}
+
+// fillStack fits a fixed-depth stack to StackDepth, padding it with zeros
+// so that every register holds a value.
+func (e *Engine) fillStack() {
+	if e.StackDepth == 0 {
+		return
+	}
+	stack := make([]Number, e.StackDepth-1)
+	n := copy(stack, e.stack)
+	for i := n; i < len(stack); i++ {
+		stack[i] = e.Zero()
+	}
+	e.stack = stack
+}
+
+// push moves n into Y and the registers above it up one. A fixed-depth
+// stack loses its top register.
+func (e *Engine) push(n Number) {
+	stack := append([]Number{n}, e.stack...)
+	if e.StackDepth > 0 && len(stack) > e.StackDepth-1 {
+		stack = stack[:e.StackDepth-1]
+	}
+	e.stack = stack
+}
+
+// pop removes and returns Y, moving the registers above it down one. A
+// fixed-depth stack keeps a copy of its top register, and an empty stack
+// gives zero.
+func (e *Engine) pop() Number {
+	if len(e.stack) == 0 {
+		return e.Zero()
+	}
+	y := e.stack[0]
+	stack := append([]Number(nil), e.stack[1:]...)
+	if e.StackDepth > 0 {
+		stack = append(stack, e.stack[len(e.stack)-1])
+	}
+	e.stack = stack
+	return y
+}
+
+// level returns the register i places above X, or zero past the top.
+func (e *Engine) level(i int) Number {
+	if i < len(e.stack) {
+		return e.stack[i]
+	}
+	return e.Zero()
+}
+
+// liftStack makes room for a new value in X in RPN mode, such as a number
+// starting to be typed or a recalled value, by pushing X up the stack.
+// Straight after Enter or CLx the new value replaces X instead.
+func (e *Engine) liftStack() {
+	if e.RPN && (e.lift || !e.NewInput) {
+		e.push(e.CurrentValue)
+	}
+	e.lift = true
+}
+
+// setX shows n as the finished value in X. A later number pushes it up.
+func (e *Engine) setX(n Number) {
+	e.CurrentValue = e.fit(n)
+	e.Display = e.formatNumber(n)
+	e.NewInput = true
+	e.operandEntered = true
+	e.lift = true
+	if e.Programmer {
+		e.setFlags()
+	}
+}
+
+// Enter is the RPN Enter key: it finishes the number being typed and
+// copies X into Y, so that the next number typed replaces X. In algebraic
+// mode it is Calculate.
+func (e *Engine) Enter() {
+	if !e.RPN {
+		e.Calculate()
+		return
+	}
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	e.push(e.CurrentValue)
+	e.setX(e.CurrentValue)
+	e.lift = false
+}
+
+// applyStackOperation is an operator key in RPN mode: Y and X are replaced
+// by Y op X, and the stack drops. If the operation fails the registers
+// above X are left as they were.
+func (e *Engine) applyStackOperation(op Operation) error {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return e.Err
+	}
+	x, y := e.CurrentValue, e.level(0)
+	e.carry, e.overflow = false, false
+	result, err := e.applyOperation(op, y, x)
+	expr := e.literal(y) + " " + opSymbol(op) + " " + e.literal(x)
+	node, _ := Parse(expr)
+	e.addHistory(expressionEntry(expr, node), result, err)
+	if err != nil {
+		return e.fail(err)
+	}
+	e.pop()
+	e.lastX = x
+	e.setX(result)
+	return nil
+}
+
+// applyStackFunction calls a user function of several arguments in RPN
+// mode. The last argument is X and the others come from the stack above
+// it, so 3 Enter 4 hyp is hyp(3, 4).
+func (e *Engine) applyStackFunction(f *UserFunction) error {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return e.Err
+	}
+	n := len(f.Params)
+	args := make([]Number, n)
+	texts := make([]string, n)
+	for i := range args {
+		if i == n-1 {
+			args[i] = e.CurrentValue
+		} else {
+			args[i] = e.level(n - 2 - i)
+		}
+		texts[i] = e.literal(args[i])
+	}
+	result, err := e.callUserFunction(f, args)
+	if err == nil {
+		result, err = e.checkRange(result)
+	}
+	expr := f.Name + "(" + strings.Join(texts, ", ") + ")"
+	node, _ := Parse(expr)
+	e.addHistory(expressionEntry(expr, node), result, err)
+	if err != nil {
+		return e.fail(err)
+	}
+	for range args[1:] {
+		e.pop()
+	}
+	e.lastX = args[n-1]
+	e.setX(result)
+	return nil
+}
+
+// Swap exchanges X and Y.
+func (e *Engine) Swap() {
+	defer e.checkpoint()()
+	if e.Err != nil || !e.RPN {
+		return
+	}
+	y := e.level(0)
+	stack := append([]Number(nil), e.stack...)
+	if len(stack) == 0 {
+		stack = append(stack, e.CurrentValue)
+	} else {
+		stack[0] = e.CurrentValue
+	}
+	e.stack = stack
+	e.setX(y)
+}
+
+// RollDown rotates the registers down: Y moves into X, and X to the top
+// of the stack.
+func (e *Engine) RollDown() {
+	defer e.checkpoint()()
+	if e.Err != nil || !e.RPN || len(e.stack) == 0 {
+		return
+	}
+	y := e.stack[0]
+	e.stack = append(append([]Number(nil), e.stack[1:]...), e.CurrentValue)
+	e.setX(y)
+}
+
+// RollUp rotates the registers up: the top of the stack moves into X, and
+// X into Y.
+func (e *Engine) RollUp() {
+	defer e.checkpoint()()
+	if e.Err != nil || !e.RPN || len(e.stack) == 0 {
+		return
+	}
+	top := e.stack[len(e.stack)-1]
+	e.stack = append([]Number{e.CurrentValue}, e.stack[:len(e.stack)-1]...)
+	e.setX(top)
+}
+
+// Drop discards X and drops the stack, so that Y moves into X.
+func (e *Engine) Drop() {
+	defer e.checkpoint()()
+	if e.Err != nil || !e.RPN {
+		return
+	}
+	e.setX(e.pop())
+}
+
+// LastX recalls the value X held before the last operation or function,
+// pushing the stack up.
+func (e *Engine) LastX() {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	e.liftStack()
+	if e.lastX == nil {
+		e.setX(e.Zero())
+		return
+	}
+	e.setX(e.lastX)
+}
@@ -1,7 +1,10 @@
 package calculator
 
 import (
+	"fmt"
 	"math"
+	"math/big"
+	"strings"
 )
 
 func (e *Engine) toRadians(angle float64) float64 {
@@ -26,246 +29,647 @@ func (e *Engine) fromRadians(rad float64) float64 {
 	}
 }
 
-func (e *Engine) Sin() {
-	e.CurrentValue = math.Sin(e.toRadians(e.CurrentValue))
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) callFunction(name string, x Number) (Number, error) {
+	if f, ok := e.userFunctions[name]; ok {
+		return e.callUserFunction(f, []Number{x})
+	}
+	fn, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	if c, ok := x.(*ComplexNumber); ok && !c.IsReal() {
+		result, err := e.callComplex(fn, c.z)
+		return result, e.domainError(err, name, x)
+	}
+	result, err := e.callReal(fn, x)
+	if err == errDomain && e.NumberMode == ModeComplex && fn.Complex != nil {
+		// Outside the real domain, such as the square root of a negative
+		// number; complex mode gives the complex result instead.
+		result, err = e.callComplex(fn, complex(x.Float64(), 0))
+	}
+	return result, e.domainError(err, name, x)
 }
 
-func (e *Engine) Cos() {
-	e.CurrentValue = math.Cos(e.toRadians(e.CurrentValue))
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) callReal(fn *Op, x Number) (Number, error) {
+	if fn.Precise != nil && e.NumberMode != ModeComplex {
+		return e.callPrecise(fn, x)
+	}
+	if fn.Exact != nil {
+		result, err := fn.Exact(e, x)
+		if err != nil {
+			return nil, err
+		}
+		return e.checkRange(result)
+	}
+	result, err := fn.Real(e, x.Float64())
+	if err != nil {
+		return nil, err
+	}
+	return e.fromFloatResult(result)
 }
 
-func (e *Engine) Tan() {
-	e.CurrentValue = math.Tan(e.toRadians(e.CurrentValue))
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+// callPrecise computes fn on big.Float at the working precision.
+func (e *Engine) callPrecise(fn *Op, x Number) (Number, error) {
+	if fn.Angle {
+		x = e.reduceTurns(x)
+	}
+	digits := e.workingDigits()
+	result, err := fn.Precise(e, e.toFloat(x, floatPrec(digits)))
+	if err != nil {
+		return nil, err
+	}
+	var n Number
+	switch a := e.arith.(type) {
+	case *DecimalArithmetic:
+		n, err = a.fromFloat(result)
+	case *RationalArithmetic:
+		n, err = a.fromFloat(result)
+	default:
+		n, err = e.arith.Parse(floatText(result, digits+2))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e.checkRange(n)
 }
 
-func (e *Engine) Asin() {
-	if e.CurrentValue < -1 || e.CurrentValue > 1 {
-		e.Display = "Error"
-		e.NewInput = true
-		return
+// workingDigits is the number of significant digits results are computed
+// to.
+func (e *Engine) workingDigits() int {
+	switch a := e.arith.(type) {
+	case *DecimalArithmetic:
+		return a.Digits
+	case *RationalArithmetic:
+		return a.Digits
 	}
-	e.CurrentValue = e.fromRadians(math.Asin(e.CurrentValue))
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	return e.Precision
 }
 
-func (e *Engine) Acos() {
-	if e.CurrentValue < -1 || e.CurrentValue > 1 {
-		e.Display = "Error"
-		e.NewInput = true
-		return
+// toFloat converts x to a big.Float of precision prec.
+func (e *Engine) toFloat(x Number, prec uint) *big.Float {
+	switch v := e.arith.Convert(x).(type) {
+	case *DecimalNumber:
+		return v.float(prec)
+	case *RationalNumber:
+		return newFloat(prec).SetRat(v.rat)
 	}
-	e.CurrentValue = e.fromRadians(math.Acos(e.CurrentValue))
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	return newFloat(prec).SetFloat64(x.Float64())
 }
 
-func (e *Engine) Atan() {
-	e.CurrentValue = e.fromRadians(math.Atan(e.CurrentValue))
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+// snapResidue gives zero for a result r of a periodic function that is
+// within the rounding error of its argument x, so that sin(π) and cos(90°)
+// come out as 0 rather than as residue such as 1e-20.
+func (e *Engine) snapResidue(r, x *big.Float) *big.Float {
+	limit := newFloat(x.Prec()).Abs(x)
+	limit.Quo(limit, newFloat(x.Prec()).SetInt(pow10(e.workingDigits()-1)))
+	if new(big.Float).Abs(r).Cmp(limit) < 0 {
+		return newFloat(r.Prec())
+	}
+	return r
 }
 
-func (e *Engine) Sinh() {
-	e.CurrentValue = math.Sinh(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+// snapFloat is snapResidue for float64, whose results carry 15 digits.
+func snapFloat(r, x float64) float64 {
+	if math.Abs(r) < math.Abs(x)*1e-15 {
+		return 0
+	}
+	return r
 }
 
-func (e *Engine) Cosh() {
-	e.CurrentValue = math.Cosh(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) callComplex(fn *Op, z complex128) (Number, error) {
+	if fn.Complex == nil {
+		return nil, errDomain
+	}
+	result, err := fn.Complex(e, z)
+	if err != nil {
+		return nil, err
+	}
+	return e.checkRange(newComplex(result))
 }
 
-func (e *Engine) Tanh() {
-	e.CurrentValue = math.Tanh(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+// applyFunction is a function key: it applies the function to the current
+// value, or enters the error state if it fails.
+func (e *Engine) applyFunction(name string) error {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return e.Err
+	}
+	operand := strings.TrimSuffix(strings.TrimPrefix(e.literal(e.CurrentValue), "("), ")")
+	x := e.CurrentValue
+	result, err := e.callFunction(name, x)
+	e.addHistory(HistoryEntry{
+		Expression: name + "(" + operand + ")",
+		Operator:   name,
+		Operands:   []string{operand},
+	}, result, err)
+	if err != nil {
+		return e.fail(err)
+	}
+	e.lastX = x
+	e.setX(result)
+	return nil
 }
 
-func (e *Engine) Asinh() {
-	e.CurrentValue = math.Asinh(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) sin(x float64) (float64, error) {
+	rad, quarter, whole := e.reduceTurnFloat(x)
+	if whole {
+		return float64(quarterSines[quarter]), nil
+	}
+	return snapFloat(math.Sin(rad), rad), nil
 }
 
-func (e *Engine) Acosh() {
-	if e.CurrentValue < 1 {
-		e.Display = "Error"
-		e.NewInput = true
-		return
+func (e *Engine) cos(x float64) (float64, error) {
+	rad, quarter, whole := e.reduceTurnFloat(x)
+	if whole {
+		return float64(quarterSines[(quarter+1)%4]), nil
 	}
-	e.CurrentValue = math.Acosh(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	return snapFloat(math.Cos(rad), rad), nil
 }
 
-func (e *Engine) Atanh() {
-	if e.CurrentValue <= -1 || e.CurrentValue >= 1 {
-		e.Display = "Error"
-		e.NewInput = true
-		return
+func (e *Engine) tan(x float64) (float64, error) {
+	rad, quarter, whole := e.reduceTurnFloat(x)
+	if whole {
+		if quarter%2 == 1 {
+			return 0, errDomain
+		}
+		return 0, nil
 	}
-	e.CurrentValue = math.Atanh(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	return snapFloat(math.Tan(rad), rad), nil
 }
 
-func (e *Engine) Log() {
-	if e.CurrentValue <= 0 {
-		e.Display = "Error"
-		e.NewInput = true
-		return
+// quarterSines are the sines of 0, 1, 2 and 3 quarter turns.
+var quarterSines = [4]int64{0, 1, 0, -1}
+
+// reduceTurnFloat is reduceTurn for float64, whose remainder math.Mod
+// computes exactly.
+func (e *Engine) reduceTurnFloat(x float64) (rad float64, quarter int, whole bool) {
+	half := float64(e.halfTurn())
+	if half == 0 {
+		return x, 0, false
 	}
-	e.CurrentValue = math.Log10(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	r := math.Mod(x, 2*half)
+	if math.Mod(r, half/2) == 0 {
+		return 0, (int(r/(half/2)) + 4) % 4, true
+	}
+	return r * math.Pi / half, 0, false
 }
 
-func (e *Engine) Ln() {
-	if e.CurrentValue <= 0 {
-		e.Display = "Error"
-		e.NewInput = true
-		return
+func (e *Engine) asin(x float64) (float64, error) {
+	if x < -1 || x > 1 {
+		return 0, errDomain
 	}
-	e.CurrentValue = math.Log(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	return e.fromRadians(math.Asin(x)), nil
 }
 
-func (e *Engine) Log2() {
-	if e.CurrentValue <= 0 {
-		e.Display = "Error"
-		e.NewInput = true
-		return
+func (e *Engine) acos(x float64) (float64, error) {
+	if x < -1 || x > 1 {
+		return 0, errDomain
 	}
-	e.CurrentValue = math.Log2(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	return e.fromRadians(math.Acos(x)), nil
 }
 
-func (e *Engine) Exp() {
-	e.CurrentValue = math.Exp(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) atan(x float64) (float64, error) {
+	return e.fromRadians(math.Atan(x)), nil
 }
 
-func (e *Engine) Exp10() {
-	e.CurrentValue = math.Pow(10, e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) sinh(x float64) (float64, error) {
+	return math.Sinh(x), nil
 }
 
-func (e *Engine) Exp2() {
-	e.CurrentValue = math.Pow(2, e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) cosh(x float64) (float64, error) {
+	return math.Cosh(x), nil
 }
 
-func (e *Engine) Sqrt() {
-	if e.CurrentValue < 0 {
-		e.Display = "Error"
-		e.NewInput = true
-		return
+func (e *Engine) tanh(x float64) (float64, error) {
+	return math.Tanh(x), nil
+}
+
+func (e *Engine) asinh(x float64) (float64, error) {
+	return math.Asinh(x), nil
+}
+
+func (e *Engine) acosh(x float64) (float64, error) {
+	if x < 1 {
+		return 0, errDomain
 	}
-	e.CurrentValue = math.Sqrt(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	return math.Acosh(x), nil
 }
 
-func (e *Engine) Cbrt() {
-	e.CurrentValue = math.Cbrt(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) atanh(x float64) (float64, error) {
+	if x <= -1 || x >= 1 {
+		return 0, errDomain
+	}
+	return math.Atanh(x), nil
 }
 
-func (e *Engine) Square() {
-	e.CurrentValue = e.CurrentValue * e.CurrentValue
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) log(x float64) (float64, error) {
+	if x <= 0 {
+		return 0, errDomain
+	}
+	return math.Log10(x), nil
 }
 
-func (e *Engine) Cube() {
-	e.CurrentValue = e.CurrentValue * e.CurrentValue * e.CurrentValue
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) ln(x float64) (float64, error) {
+	if x <= 0 {
+		return 0, errDomain
+	}
+	return math.Log(x), nil
 }
 
-func (e *Engine) Reciprocal() {
-	if e.CurrentValue == 0 {
-		e.Display = "Error"
-		e.NewInput = true
-		return
+func (e *Engine) log2(x float64) (float64, error) {
+	if x <= 0 {
+		return 0, errDomain
 	}
-	e.CurrentValue = 1 / e.CurrentValue
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	return math.Log2(x), nil
 }
 
-func (e *Engine) Factorial() {
-	n := int(e.CurrentValue)
-	if n < 0 || e.CurrentValue != float64(n) {
-		e.Display = "Error"
-		e.NewInput = true
-		return
+func (e *Engine) exp(x float64) (float64, error) {
+	return math.Exp(x), nil
+}
+
+func (e *Engine) exp10(x float64) (float64, error) {
+	return math.Pow(10, x), nil
+}
+
+func (e *Engine) exp2(x float64) (float64, error) {
+	return math.Pow(2, x), nil
+}
+
+func (e *Engine) sqrt(x float64) (float64, error) {
+	if x < 0 {
+		return 0, errDomain
+	}
+	return math.Sqrt(x), nil
+}
+
+func (e *Engine) cbrt(x float64) (float64, error) {
+	return math.Cbrt(x), nil
+}
+
+func (e *Engine) square(x float64) (float64, error) {
+	return x * x, nil
+}
+
+func (e *Engine) cube(x float64) (float64, error) {
+	return x * x * x, nil
+}
+
+func (e *Engine) reciprocal(x float64) (float64, error) {
+	if x == 0 {
+		return 0, ErrDivideByZero
+	}
+	return 1 / x, nil
+}
+
+func (e *Engine) factorial(x float64) (float64, error) {
+	n := int(x)
+	if n < 0 || x != float64(n) {
+		return 0, errDomain
 	}
 	if n > 170 {
-		e.Display = "Overflow"
-		e.NewInput = true
-		return
+		return 0, ErrOverflow
 	}
 	result := 1.0
 	for i := 2; i <= n; i++ {
 		result *= float64(i)
 	}
-	e.CurrentValue = result
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	return result, nil
 }
 
-func (e *Engine) Abs() {
-	e.CurrentValue = math.Abs(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) abs(x float64) (float64, error) {
+	return math.Abs(x), nil
 }
 
-func (e *Engine) Floor() {
-	e.CurrentValue = math.Floor(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) floor(x float64) (float64, error) {
+	return math.Floor(x), nil
 }
 
-func (e *Engine) Ceil() {
-	e.CurrentValue = math.Ceil(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) ceil(x float64) (float64, error) {
+	return math.Ceil(x), nil
 }
 
-func (e *Engine) Round() {
-	e.CurrentValue = math.Round(e.CurrentValue)
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+func (e *Engine) round(x float64) (float64, error) {
+	return math.Round(x), nil
+}
+
+// halfTurn is a half turn in the angle mode, or 0 for radians.
+func (e *Engine) halfTurn() int64 {
+	switch e.AngleMode {
+	case Degrees:
+		return 180
+	case Gradians:
+		return 200
+	}
+	return 0
+}
+
+// reduceTurns takes whole turns off x, an angle in degrees or gradians,
+// exactly, so that the rest is not lost to rounding when x is large, as in
+// sin(1e30 + 30).
+func (e *Engine) reduceTurns(x Number) Number {
+	half := e.halfTurn()
+	if half == 0 {
+		return x
+	}
+	r := new(RationalArithmetic).rat(x)
+	full := new(big.Int).Mul(big.NewInt(2*half), r.Denom())
+	return e.arith.Convert(newRational(new(big.Rat).SetFrac(new(big.Int).Rem(r.Num(), full), r.Denom())))
+}
+
+// reduceTurn gives an angle in degrees or gradians, less than a turn as
+// reduceTurns leaves it, in radians. For a whole number of quarter turns,
+// such as 90° or -300g, it gives that number modulo 4 instead, so that
+// sin, cos and tan can return their exact values.
+func (e *Engine) reduceTurn(x *big.Float) (rad *big.Float, quarter int, whole bool) {
+	half := e.halfTurn()
+	if half == 0 {
+		return x, 0, false
+	}
+	r, _ := x.Rat(nil)
+	if q := new(big.Rat).Quo(r, big.NewRat(half, 2)); q.IsInt() {
+		return nil, (int(q.Num().Int64()) + 4) % 4, true
+	}
+	w := x.Prec() + 32
+	rad = newFloat(w).SetRat(r)
+	rad.Mul(rad, floatPi(w))
+	return rad.Quo(rad, floatInt(half, w)), 0, false
+}
+
+func (e *Engine) preciseFromRadians(rad *big.Float) *big.Float {
+	half := e.halfTurn()
+	if half == 0 {
+		return rad
+	}
+	w := rad.Prec() + 32
+	x := newFloat(w).Mul(rad, floatInt(half, w))
+	return newFloat(rad.Prec()).Quo(x, floatPi(w))
+}
+
+func (e *Engine) preciseSin(x *big.Float) (*big.Float, error) {
+	rad, quarter, whole := e.reduceTurn(x)
+	if whole {
+		return floatInt(quarterSines[quarter], x.Prec()), nil
+	}
+	s, ok := floatSin(rad)
+	if !ok {
+		return nil, errDomain
+	}
+	return e.snapResidue(s, rad), nil
+}
+
+func (e *Engine) preciseCos(x *big.Float) (*big.Float, error) {
+	rad, quarter, whole := e.reduceTurn(x)
+	if whole {
+		return floatInt(quarterSines[(quarter+1)%4], x.Prec()), nil
+	}
+	c, ok := floatCos(rad)
+	if !ok {
+		return nil, errDomain
+	}
+	return e.snapResidue(c, rad), nil
+}
+
+func (e *Engine) preciseTan(x *big.Float) (*big.Float, error) {
+	s, err := e.preciseSin(x)
+	if err != nil {
+		return nil, err
+	}
+	c, _ := e.preciseCos(x)
+	if c.Sign() == 0 {
+		return nil, errDomain
+	}
+	return s.Quo(s, c), nil
+}
+
+func (e *Engine) preciseAsin(x *big.Float) (*big.Float, error) {
+	if new(big.Float).Abs(x).Cmp(big.NewFloat(1)) > 0 {
+		return nil, errDomain
+	}
+	return e.preciseFromRadians(floatAsin(x)), nil
+}
+
+func (e *Engine) preciseAcos(x *big.Float) (*big.Float, error) {
+	if new(big.Float).Abs(x).Cmp(big.NewFloat(1)) > 0 {
+		return nil, errDomain
+	}
+	return e.preciseFromRadians(floatAcos(x)), nil
+}
+
+func (e *Engine) preciseAtan(x *big.Float) (*big.Float, error) {
+	return e.preciseFromRadians(floatAtan(x)), nil
+}
+
+func (e *Engine) preciseSinh(x *big.Float) (*big.Float, error) {
+	r, ok := floatSinh(x)
+	if !ok {
+		return nil, ErrOverflow
+	}
+	return r, nil
+}
+
+func (e *Engine) preciseCosh(x *big.Float) (*big.Float, error) {
+	r, ok := floatCosh(x)
+	if !ok {
+		return nil, ErrOverflow
+	}
+	return r, nil
+}
+
+func (e *Engine) preciseTanh(x *big.Float) (*big.Float, error) {
+	return floatTanh(x), nil
+}
+
+func (e *Engine) preciseAsinh(x *big.Float) (*big.Float, error) {
+	return floatAsinh(x), nil
+}
+
+func (e *Engine) preciseAcosh(x *big.Float) (*big.Float, error) {
+	if x.Cmp(big.NewFloat(1)) < 0 {
+		return nil, errDomain
+	}
+	return floatAcosh(x), nil
+}
+
+func (e *Engine) preciseAtanh(x *big.Float) (*big.Float, error) {
+	if new(big.Float).Abs(x).Cmp(big.NewFloat(1)) >= 0 {
+		return nil, errDomain
+	}
+	return floatAtanh(x), nil
+}
+
+// preciseLogBase returns the logarithm of x to the base b.
+func preciseLogBase(x *big.Float, b int64) (*big.Float, error) {
+	if x.Sign() <= 0 {
+		return nil, errDomain
+	}
+	w := x.Prec() + 32
+	r := floatLog(newFloat(w).Set(x))
+	return newFloat(x.Prec()).Quo(r, floatLog(floatInt(b, w))), nil
+}
+
+func (e *Engine) preciseLog(x *big.Float) (*big.Float, error) {
+	return preciseLogBase(x, 10)
+}
+
+func (e *Engine) preciseLn(x *big.Float) (*big.Float, error) {
+	if x.Sign() <= 0 {
+		return nil, errDomain
+	}
+	return floatLog(x), nil
+}
+
+func (e *Engine) preciseLog2(x *big.Float) (*big.Float, error) {
+	return preciseLogBase(x, 2)
+}
+
+func (e *Engine) preciseExp(x *big.Float) (*big.Float, error) {
+	r, ok := floatExp(x)
+	if !ok {
+		return nil, ErrOverflow
+	}
+	return r, nil
+}
+
+func (e *Engine) preciseCbrt(x *big.Float) (*big.Float, error) {
+	if x.Sign() == 0 {
+		return x, nil
+	}
+	w := x.Prec() + 32
+	t := floatLog(newFloat(w).Abs(x))
+	r, _ := floatExp(t.Quo(t, floatInt(3, w)))
+	if x.Sign() < 0 {
+		r.Neg(r)
+	}
+	return newFloat(x.Prec()).Set(r), nil
+}
+
+func (e *Engine) exactExp10(x Number) (Number, error) {
+	return e.arith.Pow(e.FromInt64(10), x)
+}
+
+func (e *Engine) exactExp2(x Number) (Number, error) {
+	return e.arith.Pow(e.FromInt64(2), x)
+}
+
+func (e *Engine) exactSqrt(x Number) (Number, error) {
+	return e.arith.Sqrt(x)
+}
+
+func (e *Engine) exactSquare(x Number) (Number, error) {
+	return e.arith.Mul(x, x), nil
+}
+
+func (e *Engine) exactCube(x Number) (Number, error) {
+	return e.arith.Mul(e.arith.Mul(x, x), x), nil
+}
+
+func (e *Engine) exactReciprocal(x Number) (Number, error) {
+	if e.arith.Sign(x) == 0 {
+		return nil, ErrDivideByZero
+	}
+	return e.arith.Quo(e.FromInt64(1), x)
+}
+
+const maxFactorial = 5000
+
+func (e *Engine) exactFactorial(x Number) (Number, error) {
+	if e.arith.Sign(x) < 0 || !isInteger(e.arith, x) {
+		return nil, errDomain
+	}
+	if e.arith.Cmp(x, e.FromInt64(maxFactorial)) > 0 {
+		return nil, ErrOverflow
+	}
+	n := e.arith.Int(x).Int64()
+	if n < 2 {
+		return e.FromInt64(1), nil
+	}
+	return e.arith.FromInt(new(big.Int).MulRange(2, n)), nil
+}
+
+func (e *Engine) exactAbs(x Number) (Number, error) {
+	if e.arith.Sign(x) < 0 {
+		return e.arith.Neg(x), nil
+	}
+	return x, nil
+}
+
+func (e *Engine) exactFloor(x Number) (Number, error) {
+	return e.arith.Floor(x), nil
+}
+
+func (e *Engine) exactCeil(x Number) (Number, error) {
+	return e.arith.Ceil(x), nil
+}
+
+func (e *Engine) exactRound(x Number) (Number, error) {
+	return e.arith.Round(x), nil
+}
+
+func (e *Engine) Sin() error        { return e.applyFunction("sin") }
+func (e *Engine) Cos() error        { return e.applyFunction("cos") }
+func (e *Engine) Tan() error        { return e.applyFunction("tan") }
+func (e *Engine) Asin() error       { return e.applyFunction("asin") }
+func (e *Engine) Acos() error       { return e.applyFunction("acos") }
+func (e *Engine) Atan() error       { return e.applyFunction("atan") }
+func (e *Engine) Sinh() error       { return e.applyFunction("sinh") }
+func (e *Engine) Cosh() error       { return e.applyFunction("cosh") }
+func (e *Engine) Tanh() error       { return e.applyFunction("tanh") }
+func (e *Engine) Asinh() error      { return e.applyFunction("asinh") }
+func (e *Engine) Acosh() error      { return e.applyFunction("acosh") }
+func (e *Engine) Atanh() error      { return e.applyFunction("atanh") }
+func (e *Engine) Log() error        { return e.applyFunction("log") }
+func (e *Engine) Ln() error         { return e.applyFunction("ln") }
+func (e *Engine) Log2() error       { return e.applyFunction("log2") }
+func (e *Engine) Exp() error        { return e.applyFunction("exp") }
+func (e *Engine) Exp10() error      { return e.applyFunction("exp10") }
+func (e *Engine) Exp2() error       { return e.applyFunction("exp2") }
+func (e *Engine) Sqrt() error       { return e.applyFunction("sqrt") }
+func (e *Engine) Cbrt() error       { return e.applyFunction("cbrt") }
+func (e *Engine) Square() error     { return e.applyFunction("sqr") }
+func (e *Engine) Cube() error       { return e.applyFunction("cube") }
+func (e *Engine) Reciprocal() error { return e.applyFunction("recip") }
+func (e *Engine) Factorial() error  { return e.applyFunction("fact") }
+func (e *Engine) Abs() error        { return e.applyFunction("abs") }
+func (e *Engine) Floor() error      { return e.applyFunction("floor") }
+func (e *Engine) Ceil() error       { return e.applyFunction("ceil") }
+func (e *Engine) Round() error      { return e.applyFunction("round") }
+
+// Digits of π and e beyond any precision a user is likely to pick; the
+// arithmetic rounds them to the working precision.
+const (
+	piDigits = "3.1415926535897932384626433832795028841971693993751058209749445923078164062862089986280348253421170679"
+	eDigits  = "2.7182818284590452353602874713526624977572470936999595749669676277240766303535475945713821785251664274"
+)
+
+func (e *Engine) piValue() Number {
+	n, _ := e.arith.Parse(piDigits)
+	return n
+}
+
+func (e *Engine) eValue() Number {
+	n, _ := e.arith.Parse(eDigits)
+	return n
 }
 
 func (e *Engine) Pi() {
-	e.CurrentValue = math.Pi
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	e.recallConstant(e.piValue())
 }
 
 func (e *Engine) E() {
-	e.CurrentValue = math.E
-	e.Display = e.formatNumber(e.CurrentValue)
-	e.NewInput = true
+	e.recallConstant(e.eValue())
+}
+
+// recallConstant is a constant key: n becomes the displayed value.
+func (e *Engine) recallConstant(n Number) {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	e.liftStack()
+	e.setX(n)
 }
 
 func (e *Engine) SetAngleMode(mode AngleMode) {
+	defer e.checkpoint()()
 	e.AngleMode = mode
 }
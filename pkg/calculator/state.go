@@ -0,0 +1,169 @@
+package calculator
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// stateFormatVersion is written to the state file. A file with a newer
+// version is ignored.
+const stateFormatVersion = 1
+
+// engineState is the part of the engine kept between sessions. Values are
+// written with Number.String in the saved NumberMode.
+type engineState struct {
+	Version         int               `json:"v"`
+	NumberMode      NumberMode        `json:"mode"`
+	AngleMode       AngleMode         `json:"angle"`
+	Precision       int               `json:"precision"`
+	FractionDisplay FractionDisplay   `json:"fraction_display"`
+	ComplexDisplay  ComplexDisplay    `json:"complex_display"`
+	DisplayFormat   DisplayFormat     `json:"display_format"`
+	DisplayDigits   int               `json:"display_digits"`
+	SIPrefixes      bool              `json:"si_prefixes,omitempty"`
+	Memory          string            `json:"memory,omitempty"`
+	Ans             string            `json:"ans,omitempty"`
+	Variables       map[string]string `json:"variables,omitempty"`
+	RPN             bool              `json:"rpn,omitempty"`
+	StackDepth      int               `json:"stack_depth"`
+	Stack           []string          `json:"stack,omitempty"`
+	BitWidth        BitWidth          `json:"bit_width"`
+	Signed          bool              `json:"signed"`
+	Saturate        bool              `json:"saturate,omitempty"`
+}
+
+// DefaultStatePath returns state.json in DataDir.
+func DefaultStatePath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.json"), nil
+}
+
+// SaveState writes the variables, ans, memory, RPN stack, modes and the
+// programmer word to path.
+func (e *Engine) SaveState(path string) error {
+	state := engineState{
+		Version:         stateFormatVersion,
+		NumberMode:      e.NumberMode,
+		AngleMode:       e.AngleMode,
+		Precision:       e.Precision,
+		FractionDisplay: e.FractionDisplay,
+		ComplexDisplay:  e.ComplexDisplay,
+		DisplayFormat:   e.DisplayFormat,
+		DisplayDigits:   e.DisplayDigits,
+		SIPrefixes:      e.SIPrefixes,
+		Variables:       make(map[string]string, len(e.variables)),
+		RPN:             e.RPN,
+		StackDepth:      e.StackDepth,
+		BitWidth:        e.BitWidth,
+		Signed:          e.Signed,
+		Saturate:        e.Saturate,
+	}
+	if e.Memory != nil && e.arith.Sign(e.Memory) != 0 {
+		state.Memory = e.Memory.String()
+	}
+	if e.ans != nil {
+		state.Ans = e.ans.String()
+	}
+	for name, val := range e.variables {
+		state.Variables[name] = val.String()
+	}
+	if e.RPN {
+		state.Stack = append(state.Stack, e.CurrentValue.String())
+		for _, val := range e.stack {
+			state.Stack = append(state.Stack, val.String())
+		}
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// LoadState restores what SaveState wrote. A missing file leaves the
+// engine as it is. Loading is not an undo step.
+func (e *Engine) LoadState(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state := engineState{
+		DisplayDigits: DefaultDisplayDigits,
+		StackDepth:    DefaultStackDepth,
+		BitWidth:      Bits64,
+		Signed:        true,
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if state.Version < 1 || state.Version > stateFormatVersion {
+		return nil
+	}
+
+	e.inCall = true
+	defer func() { e.inCall = false }()
+
+	e.AngleMode = state.AngleMode
+	e.FractionDisplay = state.FractionDisplay
+	e.ComplexDisplay = state.ComplexDisplay
+	e.DisplayFormat = state.DisplayFormat
+	e.SIPrefixes = state.SIPrefixes
+	e.NumberMode = state.NumberMode
+	e.SetPrecision(max(state.Precision, 1))
+	e.DisplayDigits = min(max(state.DisplayDigits, 0), e.Precision)
+	if n, err := e.arith.Parse(state.Memory); err == nil {
+		e.Memory = n
+	}
+	if n, err := e.arith.Parse(state.Ans); err == nil {
+		e.ans = n
+	}
+	for name, text := range state.Variables {
+		n, err := e.arith.Parse(text)
+		if err != nil || checkVariableName(name) != nil {
+			continue
+		}
+		if e.variables == nil {
+			e.variables = make(map[string]Number)
+		}
+		e.variables[name] = n
+	}
+	e.Signed = state.Signed
+	e.Saturate = state.Saturate
+	e.SetBitWidth(state.BitWidth)
+	e.RPN = state.RPN
+	e.SetStackDepth(state.StackDepth)
+	if e.RPN {
+		e.loadStack(state.Stack)
+	}
+	e.undoStack = nil
+	e.redoStack = nil
+	return nil
+}
+
+// loadStack restores the RPN registers saved by SaveState, X first.
+func (e *Engine) loadStack(values []string) {
+	var stack []Number
+	for _, text := range values {
+		n, err := e.arith.Parse(text)
+		if err != nil {
+			n = e.Zero()
+		}
+		stack = append(stack, n)
+	}
+	e.stack = nil
+	if len(stack) > 0 {
+		e.CurrentValue = stack[0]
+		e.stack = stack[1:]
+	}
+	e.fillStack()
+	e.lift = true
+	e.redisplay()
+}
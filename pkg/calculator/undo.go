@@ -0,0 +1,236 @@
+package calculator
+
+// maxUndo is the number of steps Undo can go back.
+const maxUndo = 100
+
+// snapshot is the engine state saved before each mutating call.
+type snapshot struct {
+	display         string
+	err             error
+	currentValue    Number
+	storedValue     Number
+	pendingOp       Operation
+	newInput        bool
+	memory          Number
+	variables       map[string]Number
+	ans             Number
+	angleMode       AngleMode
+	numberBase      NumberBase
+	numberMode      NumberMode
+	precision       int
+	fractionDisplay FractionDisplay
+	complexDisplay  ComplexDisplay
+	displayFormat   DisplayFormat
+	displayDigits   int
+	siPrefixes      bool
+	locale          NumberLocale
+	arith           Arithmetic
+	tokens          []string
+	parenDepth      int
+	operandEntered  bool
+	rpn             bool
+	stackDepth      int
+	programmer      bool
+	bitWidth        BitWidth
+	signed          bool
+	saturate        bool
+	flags           Flags
+	stack           []Number
+	lastX           Number
+	lift            bool
+}
+
+// Numbers are never modified in place, so the snapshot can share them
+// with the engine.
+func (e *Engine) snapshot() snapshot {
+	return snapshot{
+		display:         e.Display,
+		err:             e.Err,
+		currentValue:    e.CurrentValue,
+		storedValue:     e.StoredValue,
+		pendingOp:       e.PendingOp,
+		newInput:        e.NewInput,
+		memory:          e.Memory,
+		variables:       copyVariables(e.variables),
+		ans:             e.ans,
+		angleMode:       e.AngleMode,
+		numberBase:      e.NumberBase,
+		numberMode:      e.NumberMode,
+		precision:       e.Precision,
+		fractionDisplay: e.FractionDisplay,
+		complexDisplay:  e.ComplexDisplay,
+		displayFormat:   e.DisplayFormat,
+		displayDigits:   e.DisplayDigits,
+		siPrefixes:      e.SIPrefixes,
+		locale:          e.Locale,
+		arith:           e.arith,
+		tokens:          append([]string(nil), e.tokens...),
+		parenDepth:      e.parenDepth,
+		operandEntered:  e.operandEntered,
+		rpn:             e.RPN,
+		stackDepth:      e.StackDepth,
+		programmer:      e.Programmer,
+		bitWidth:        e.BitWidth,
+		signed:          e.Signed,
+		saturate:        e.Saturate,
+		flags:           e.Flags,
+		stack:           e.stack,
+		lastX:           e.lastX,
+		lift:            e.lift,
+	}
+}
+
+func (e *Engine) restore(s snapshot) {
+	e.Display = s.display
+	e.Err = s.err
+	e.CurrentValue = s.currentValue
+	e.StoredValue = s.storedValue
+	e.PendingOp = s.pendingOp
+	e.NewInput = s.newInput
+	e.Memory = s.memory
+	e.variables = copyVariables(s.variables)
+	e.ans = s.ans
+	e.AngleMode = s.angleMode
+	e.NumberBase = s.numberBase
+	e.NumberMode = s.numberMode
+	e.Precision = s.precision
+	e.FractionDisplay = s.fractionDisplay
+	e.ComplexDisplay = s.complexDisplay
+	e.DisplayFormat = s.displayFormat
+	e.DisplayDigits = s.displayDigits
+	e.SIPrefixes = s.siPrefixes
+	e.Locale = s.locale
+	e.arith = s.arith
+	e.tokens = append([]string(nil), s.tokens...)
+	e.parenDepth = s.parenDepth
+	e.operandEntered = s.operandEntered
+	e.RPN = s.rpn
+	e.StackDepth = s.stackDepth
+	e.Programmer = s.programmer
+	e.BitWidth = s.bitWidth
+	e.Signed = s.signed
+	e.Saturate = s.saturate
+	e.Flags = s.flags
+	e.stack = s.stack
+	e.lastX = s.lastX
+	e.lift = s.lift
+}
+
+func (s snapshot) equal(t snapshot) bool {
+	if s.display != t.display || s.err != t.err || s.pendingOp != t.pendingOp || s.newInput != t.newInput ||
+		s.angleMode != t.angleMode || s.numberBase != t.numberBase || s.numberMode != t.numberMode ||
+		s.precision != t.precision || s.fractionDisplay != t.fractionDisplay ||
+		s.complexDisplay != t.complexDisplay || s.displayFormat != t.displayFormat ||
+		s.displayDigits != t.displayDigits || s.siPrefixes != t.siPrefixes || s.locale != t.locale || s.parenDepth != t.parenDepth ||
+		s.operandEntered != t.operandEntered || s.rpn != t.rpn || s.stackDepth != t.stackDepth ||
+		s.programmer != t.programmer || s.bitWidth != t.bitWidth || s.signed != t.signed || s.saturate != t.saturate || s.flags != t.flags ||
+		s.lift != t.lift || len(s.tokens) != len(t.tokens) || len(s.stack) != len(t.stack) {
+		return false
+	}
+	for i := range s.tokens {
+		if s.tokens[i] != t.tokens[i] {
+			return false
+		}
+	}
+	for i := range s.stack {
+		if !sameNumber(s.stack[i], t.stack[i]) {
+			return false
+		}
+	}
+	if len(s.variables) != len(t.variables) {
+		return false
+	}
+	for name, val := range s.variables {
+		if !sameNumber(val, t.variables[name]) {
+			return false
+		}
+	}
+	return sameNumber(s.currentValue, t.currentValue) &&
+		sameNumber(s.storedValue, t.storedValue) &&
+		sameNumber(s.memory, t.memory) &&
+		sameNumber(s.ans, t.ans) &&
+		sameNumber(s.lastX, t.lastX)
+}
+
+func copyVariables(vars map[string]Number) map[string]Number {
+	if vars == nil {
+		return nil
+	}
+	c := make(map[string]Number, len(vars))
+	for name, val := range vars {
+		c[name] = val
+	}
+	return c
+}
+
+func sameNumber(x, y Number) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return x == y || x.String() == y.String()
+}
+
+// checkpoint saves the state for Undo and returns a function to call when
+// the mutating call is done, as in
+//
+//	defer e.checkpoint()()
+//
+// Calls made from within another mutating call belong to it and are not
+// saved separately, and calls that change nothing leave no undo step.
+func (e *Engine) checkpoint() func() {
+	if e.inCall {
+		return func() {}
+	}
+	e.inCall = true
+	before := e.snapshot()
+	return func() {
+		e.inCall = false
+		if before.equal(e.snapshot()) {
+			return
+		}
+		e.undoStack = append(e.undoStack, before)
+		if len(e.undoStack) > maxUndo {
+			e.undoStack = e.undoStack[1:]
+		}
+		e.redoStack = nil
+	}
+}
+
+// Undo restores the state from before the last mutating call. It reports
+// whether there was anything to undo.
+func (e *Engine) Undo() bool {
+	if len(e.undoStack) == 0 {
+		return false
+	}
+	e.redoStack = append(e.redoStack, e.snapshot())
+	e.restore(e.undoStack[len(e.undoStack)-1])
+	e.undoStack = e.undoStack[:len(e.undoStack)-1]
+	return true
+}
+
+// Redo reapplies the last call undone. It reports whether there was
+// anything to redo.
+func (e *Engine) Redo() bool {
+	if len(e.redoStack) == 0 {
+		return false
+	}
+	e.undoStack = append(e.undoStack, e.snapshot())
+	e.restore(e.redoStack[len(e.redoStack)-1])
+	e.redoStack = e.redoStack[:len(e.redoStack)-1]
+	return true
+}
+
+// ClearUndo forgets the steps Undo and Redo would take, such as the
+// settings applied when the calculator starts.
+func (e *Engine) ClearUndo() {
+	e.undoStack = nil
+	e.redoStack = nil
+}
+
+func (e *Engine) CanUndo() bool {
+	return len(e.undoStack) > 0
+}
+
+func (e *Engine) CanRedo() bool {
+	return len(e.redoStack) > 0
+}
@@ -0,0 +1,225 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UserFunction is a function defined by the user, such as
+// "hyp(a, b) = sqrt(a^2 + b^2)".
+type UserFunction struct {
+	Name   string
+	Params []string
+	// Body is the expression as it was written.
+	Body string
+
+	body Node
+}
+
+// String returns the definition, which DefineFunction reads back.
+func (f *UserFunction) String() string {
+	return f.Name + "(" + strings.Join(f.Params, ", ") + ") = " + f.Body
+}
+
+// callFrame holds the arguments of a user function being evaluated.
+type callFrame struct {
+	function *UserFunction
+	args     map[string]Number
+}
+
+// DefineFunction adds or replaces a user function from its definition,
+// such as "f(x) = 3x^2 + 2x - 1". The body may call other user functions,
+// including ones not defined yet, but not itself, directly or through
+// others.
+func (e *Engine) DefineFunction(definition string) error {
+	node, err := Parse(definition)
+	if err != nil {
+		return err
+	}
+	define, ok := node.(*DefineNode)
+	if !ok {
+		return fmt.Errorf("%q is not a function definition", definition)
+	}
+	return e.defineFunction(define)
+}
+
+// DefineFunctions defines each of defs, such as the saved
+// Config.Functions, and returns the errors for those that fail.
+func (e *Engine) DefineFunctions(defs []string) error {
+	var errs []error
+	for _, def := range defs {
+		if err := e.DefineFunction(def); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", def, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Engine) defineFunction(n *DefineNode) error {
+	if err := checkVariableName(n.Name); err != nil {
+		return err
+	}
+	if _, ok := e.variables[n.Name]; ok {
+		return fmt.Errorf("%s is a variable", n.Name)
+	}
+	seen := make(map[string]bool, len(n.Params))
+	for _, param := range n.Params {
+		if err := checkVariableName(param); err != nil {
+			return err
+		}
+		if seen[param] {
+			return fmt.Errorf("%s is repeated in the parameters of %s", param, n.Name)
+		}
+		seen[param] = true
+	}
+	f := &UserFunction{Name: n.Name, Params: n.Params, Body: n.BodyText, body: n.Body}
+	if e.calls(f.body, f.Name, map[string]bool{}) {
+		return fmt.Errorf("%s cannot call itself", n.Name)
+	}
+	if e.userFunctions == nil {
+		e.userFunctions = make(map[string]*UserFunction)
+	}
+	e.userFunctions[f.Name] = f
+	return nil
+}
+
+// calls reports whether evaluating node would call the user function
+// name, following calls through the other user functions. visited holds
+// the functions already followed.
+func (e *Engine) calls(node Node, name string, visited map[string]bool) bool {
+	switch n := node.(type) {
+	case *UnaryNode:
+		return e.calls(n.Operand, name, visited)
+	case *FactorialNode:
+		return e.calls(n.Operand, name, visited)
+	case *BinaryNode:
+		return e.calls(n.Left, name, visited) || e.calls(n.Right, name, visited)
+	case *CallNode:
+		if n.Name == name {
+			return true
+		}
+		for _, arg := range n.Args {
+			if e.calls(arg, name, visited) {
+				return true
+			}
+		}
+		if f, ok := e.userFunctions[n.Name]; ok && !visited[n.Name] {
+			visited[n.Name] = true
+			return e.calls(f.body, name, visited)
+		}
+	}
+	return false
+}
+
+func (e *Engine) DeleteFunction(name string) {
+	delete(e.userFunctions, name)
+}
+
+// Function returns the user function called name.
+func (e *Engine) Function(name string) (*UserFunction, bool) {
+	f, ok := e.userFunctions[name]
+	return f, ok
+}
+
+// FunctionNames returns the names of the user functions in sorted order.
+func (e *Engine) FunctionNames() []string {
+	names := make([]string, 0, len(e.userFunctions))
+	for name := range e.userFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FunctionDefinitions returns the definitions of the user functions in
+// name order, as saved in Config.Functions.
+func (e *Engine) FunctionDefinitions() []string {
+	var defs []string
+	for _, name := range e.FunctionNames() {
+		defs = append(defs, e.userFunctions[name].String())
+	}
+	return defs
+}
+
+func (e *Engine) callUserFunction(f *UserFunction, args []Number) (Number, error) {
+	if len(args) != len(f.Params) {
+		noun := "arguments"
+		if len(f.Params) == 1 {
+			noun = "argument"
+		}
+		return nil, fmt.Errorf("%s takes %d %s, got %d", f.Name, len(f.Params), noun, len(args))
+	}
+	// Definitions cannot call themselves, but a function defined later
+	// can close a loop through one defined earlier.
+	for _, frame := range e.frames {
+		if frame.function.Name == f.Name {
+			return nil, fmt.Errorf("%s calls itself", f.Name)
+		}
+	}
+	frame := callFrame{function: f, args: make(map[string]Number, len(args))}
+	for i, param := range f.Params {
+		frame.args[param] = args[i]
+	}
+	e.frames = append(e.frames, frame)
+	defer func() { e.frames = e.frames[:len(e.frames)-1] }()
+	return e.EvaluateNode(f.body)
+}
+
+// argument returns the value of a parameter of the user function being
+// evaluated.
+func (e *Engine) argument(name string) (Number, bool) {
+	if len(e.frames) == 0 {
+		return nil, false
+	}
+	n, ok := e.frames[len(e.frames)-1].args[name]
+	return n, ok
+}
+
+// CallFunction is the keypad key for a user function. A function of one
+// argument applies to the displayed value like the built-in function keys.
+// For more arguments it starts a call in the expression, and InputComma
+// separates the arguments.
+func (e *Engine) CallFunction(name string) {
+	f, ok := e.userFunctions[name]
+	if !ok {
+		return
+	}
+	if len(f.Params) == 1 {
+		e.applyFunction(name)
+		return
+	}
+	if e.RPN {
+		e.applyStackFunction(f)
+		return
+	}
+	defer e.checkpoint()()
+	if e.operandEntered || e.endsWithOperand() {
+		if e.operandEntered {
+			e.tokens = append(e.tokens, e.operandText())
+		}
+		e.tokens = append(e.tokens, opSymbol(OpMultiply))
+	}
+	e.tokens = append(e.tokens, name, "(")
+	e.parenDepth++
+	e.NewInput = true
+	e.operandEntered = false
+}
+
+// InputComma ends an argument of a function call being entered.
+func (e *Engine) InputComma() {
+	defer e.checkpoint()()
+	if e.Err != nil {
+		return
+	}
+	if e.parenDepth == 0 {
+		return
+	}
+	if e.operandEntered || !e.endsWithOperand() {
+		e.tokens = append(e.tokens, e.operandText())
+	}
+	e.tokens = append(e.tokens, ",")
+	e.NewInput = true
+	e.operandEntered = false
+}
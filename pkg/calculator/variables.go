@@ -0,0 +1,129 @@
+package calculator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ansName is the variable holding the last result.
+const ansName = "ans"
+
+// checkVariableName reports why name cannot be used for a variable: it
+// must be an identifier that is not a constant, a function or ans.
+func checkVariableName(name string) error {
+	for i, r := range name {
+		if !(unicode.IsLetter(r) || r == '_' || i > 0 && unicode.IsDigit(r)) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("missing variable name")
+	}
+	if _, ok := expressionConstants[strings.ToLower(name)]; ok || name == "i" {
+		return fmt.Errorf("%s is a constant", name)
+	}
+	if isFunctionName(name) {
+		return fmt.Errorf("%s is a function", name)
+	}
+	if name == ansName || name == "mod" {
+		return fmt.Errorf("%s is reserved", name)
+	}
+	return nil
+}
+
+// SetVariable assigns n to the variable name.
+func (e *Engine) SetVariable(name string, n Number) error {
+	defer e.checkpoint()()
+	if err := checkVariableName(name); err != nil {
+		return err
+	}
+	if _, ok := e.userFunctions[name]; ok {
+		return fmt.Errorf("%s is a function", name)
+	}
+	if e.variables == nil {
+		e.variables = make(map[string]Number)
+	}
+	e.variables[name] = e.arith.Convert(n)
+	return nil
+}
+
+// Variable returns the value of a variable, including ans.
+func (e *Engine) Variable(name string) (Number, bool) {
+	if name == ansName {
+		return e.Ans(), true
+	}
+	n, ok := e.variables[name]
+	return n, ok
+}
+
+func (e *Engine) DeleteVariable(name string) {
+	defer e.checkpoint()()
+	delete(e.variables, name)
+}
+
+// VariableNames returns the names of the variables in sorted order, not
+// including ans.
+func (e *Engine) VariableNames() []string {
+	names := make([]string, 0, len(e.variables))
+	for name := range e.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Ans returns the result of the last calculation, or zero before the
+// first.
+func (e *Engine) Ans() Number {
+	if e.ans == nil {
+		return e.Zero()
+	}
+	return e.ans
+}
+
+// RecallVariable makes the value of a variable the current value, clearing
+// any error.
+func (e *Engine) RecallVariable(name string) {
+	defer e.checkpoint()()
+	n, ok := e.Variable(name)
+	if !ok {
+		return
+	}
+	e.Err = nil
+	e.liftStack()
+	e.CurrentValue = n
+	e.Display = e.formatNumber(n)
+	e.NewInput = true
+	e.operandEntered = true
+}
+
+// Execute evaluates a typed line: an expression, an assignment such as
+// "rate = 0.0375", or a function definition such as "f(x) = 3x^2". Like
+// Calculate, the result becomes the current value and ans, and is recorded
+// in the history. A definition has no result, so Execute returns nil.
+// Other lines start afresh from any error, and enter the error state if
+// they fail. Numbers may be written in the locale, such as "2,5 * 3" with
+// a decimal comma.
+func (e *Engine) Execute(line string) (Number, error) {
+	defer e.checkpoint()()
+	line = e.Locale.readExpression(line)
+	node, err := Parse(line)
+	if define, ok := node.(*DefineNode); ok {
+		return nil, e.defineFunction(define)
+	}
+	e.Err = nil
+	e.carry, e.overflow = false, false
+	var result Number
+	if err == nil {
+		result, err = e.EvaluateNode(node)
+	}
+	e.addHistory(expressionEntry(line, node), result, err)
+	if err != nil {
+		return nil, e.fail(err)
+	}
+	e.liftStack()
+	e.setX(result)
+	return result, nil
+}
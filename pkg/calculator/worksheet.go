@@ -0,0 +1,99 @@
+package calculator
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// WorksheetExt is the file extension of worksheets.
+const WorksheetExt = ".calc"
+
+// Worksheet is a recurring calculation kept as plain text, such as a
+// budget check. Each line is an expression, an assignment or a function
+// definition, as typed in the calculator, and # starts a comment:
+//
+//	# Monthly budget
+//	rent = 1250
+//	food = 90 * 4.3   # weekly shop
+//	rent + food
+//
+// Lines are evaluated top to bottom in one engine, so later lines can use
+// the variables, functions and ans of earlier ones.
+type Worksheet struct {
+	Lines []WorksheetLine
+}
+
+// WorksheetLine is one line of a worksheet.
+type WorksheetLine struct {
+	// Number is the line number in the file, from 1.
+	Number int
+	// Input is the calculation on the line without its comment. It is
+	// empty for a blank line or one holding only a comment.
+	Input string
+	// Comment is the text after #, without it.
+	Comment string
+	// Entry is the history record of the calculation once the worksheet
+	// has run. A function definition has none unless it failed, when
+	// Entry holds the Error.
+	Entry *HistoryEntry
+}
+
+// Failed reports whether the calculation on the line failed.
+func (l WorksheetLine) Failed() bool {
+	return l.Entry != nil && l.Entry.Failed()
+}
+
+// ParseWorksheet reads a worksheet. It does not evaluate it.
+func ParseWorksheet(r io.Reader) (*Worksheet, error) {
+	ws := &Worksheet{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		input, comment, _ := strings.Cut(scanner.Text(), "#")
+		ws.Lines = append(ws.Lines, WorksheetLine{
+			Number:  n,
+			Input:   strings.TrimSpace(input),
+			Comment: strings.TrimSpace(comment),
+		})
+	}
+	return ws, scanner.Err()
+}
+
+// LoadWorksheet reads the worksheet file at path.
+func LoadWorksheet(path string) (*Worksheet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseWorksheet(f)
+}
+
+// RunWorksheet evaluates the lines of ws in order, as Execute would, and
+// records the history entry of each in its Entry. A line that fails does
+// not stop the ones after it. It returns the number of lines that failed.
+func (e *Engine) RunWorksheet(ws *Worksheet) int {
+	failed := 0
+	for i := range ws.Lines {
+		line := &ws.Lines[i]
+		line.Entry = nil
+		if line.Input == "" {
+			continue
+		}
+		node, _ := Parse(e.Locale.readExpression(line.Input))
+		_, err := e.Execute(line.Input)
+		if _, ok := node.(*DefineNode); ok {
+			if err != nil {
+				line.Entry = &HistoryEntry{Expression: line.Input, Error: err.Error()}
+			}
+		} else {
+			entry := e.History[len(e.History)-1]
+			line.Entry = &entry
+		}
+		if line.Failed() {
+			failed++
+		}
+	}
+	return failed
+}